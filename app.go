@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"flexsupport/internal/auth"
 	cfg "flexsupport/internal/config"
 	db "flexsupport/internal/domain"
 	"flexsupport/internal/lib/logger"
+	"flexsupport/internal/mail"
+	"flexsupport/internal/notify"
 	"flexsupport/internal/router"
+	"flexsupport/internal/sms"
 )
 
 var log *slog.Logger
@@ -33,9 +39,67 @@ func App(ctx context.Context, stdout io.Writer, getenv func(string, string) stri
 	default:
 		log = slog.New(slog.NewJSONHandler(stdout, logOptions))
 	}
-	r := router.NewRouter(log, config)
-	db.NewDB(ctx, config.DatabaseUrl)
+	slog.SetDefault(log)
+	if config.SecretKey == "" {
+		if !local {
+			return errors.New("SECRET_KEY must be set in production")
+		}
+		key, _, err := auth.NewToken()
+		if err != nil {
+			return err
+		}
+		config.SecretKey = key
+		log.Warn("SECRET_KEY is not set; password reset and verification links stop working on restart")
+	}
+	database := db.NewDB(ctx, config.DatabaseUrl)
+	if config.MigrateOnBoot {
+		if err := database.Migrate(ctx); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+	transport, err := newMailTransport(config)
+	if err != nil {
+		return err
+	}
+	mailWorker, err := mail.NewWorker(log, database, transport, config.MailFrom, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	go mailWorker.Run(ctx)
+
+	// Integrations set to the fake sms provider only work outside production,
+	// where their texts are logged
+	texts := sms.Providers{AllowedHosts: sms.ParseHosts(config.SMSAPIHosts)}
+	if local {
+		texts.Fake = sms.NewLogProvider(log)
+	}
+	textWorker := notify.NewTextWorker(log, database, database, database, texts, 5*time.Second)
+	go textWorker.Run(ctx)
+
+	r := router.NewRouter(log, config, database, texts)
 
 	fmt.Println("Starting server on :8080")
 	return http.ListenAndServe(":8080", r)
 }
+
+// newMailTransport picks how the mail worker delivers queued messages
+func newMailTransport(config *cfg.Config) (mail.Sender, error) {
+	switch config.MailTransport {
+	case "log":
+		return mail.NewLogSender(log), nil
+	case "file":
+		return mail.NewFileSender(config.MailDir)
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, errors.New("SMTP_HOST must be set when MAIL_TRANSPORT is smtp")
+		}
+		return mail.NewSMTPSender(mail.SMTPConfig{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", config.MailTransport)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"flexsupport/internal/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrOIDCState is returned when the callback does not match the flow started
+// in this browser: a forged or replayed callback, or an expired flow cookie
+var ErrOIDCState = errors.New("oidc state mismatch")
+
+// OIDCFlow is what the browser must carry from the redirect to the identity
+// provider back to the callback
+type OIDCFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+}
+
+// OIDCClaims are the ID token claims used to find or provision the user
+type OIDCClaims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	HostedDomain  string `json:"hd"`
+}
+
+// OIDCClient runs the authorization code flow with PKCE against any issuer
+// that publishes a discovery document. Providers are discovered once per issuer.
+type OIDCClient struct {
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	providers map[string]*oidc.Provider
+}
+
+// NewOIDCClient returns a client that talks to identity providers through
+// httpClient, or http.DefaultClient when nil
+func NewOIDCClient(httpClient *http.Client) *OIDCClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OIDCClient{
+		httpClient: httpClient,
+		providers:  make(map[string]*oidc.Provider),
+	}
+}
+
+// Discover fetches the issuer's discovery document, caching the result
+func (c *OIDCClient) Discover(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	c.mu.Lock()
+	provider, ok := c.providers[issuer]
+	c.mu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, c.httpClient), issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", issuer, err)
+	}
+	c.mu.Lock()
+	c.providers[issuer] = provider
+	c.mu.Unlock()
+	return provider, nil
+}
+
+// AuthCodeURL starts a sign-in, returning the identity provider URL to send
+// the browser to and the flow to keep until the callback
+func (c *OIDCClient) AuthCodeURL(ctx context.Context, cfg models.OIDCConfig, redirectURL, next string) (string, OIDCFlow, error) {
+	provider, err := c.Discover(ctx, cfg.Issuer)
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+	state, _, err := NewToken()
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+	nonce, _, err := NewToken()
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+	flow := OIDCFlow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		Next:     next,
+	}
+	url := oauthConfig(provider, cfg, redirectURL).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(flow.Verifier),
+	)
+	return url, flow, nil
+}
+
+// Exchange completes a sign-in: it checks state, redeems the code with the
+// PKCE verifier and verifies the ID token's signature, audience and nonce
+func (c *OIDCClient) Exchange(ctx context.Context, cfg models.OIDCConfig, redirectURL string, flow OIDCFlow, state, code string) (OIDCClaims, error) {
+	if flow.State == "" || state != flow.State {
+		return OIDCClaims{}, ErrOIDCState
+	}
+	provider, err := c.Discover(ctx, cfg.Issuer)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	ctx = oidc.ClientContext(ctx, c.httpClient)
+	token, err := oauthConfig(provider, cfg, redirectURL).Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("failed to redeem authorization code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return OIDCClaims{}, errors.New("token response has no id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return OIDCClaims{}, ErrOIDCState
+	}
+
+	var claims OIDCClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return OIDCClaims{}, fmt.Errorf("failed to read id_token claims: %w", err)
+	}
+	claims.Issuer, claims.Subject = idToken.Issuer, idToken.Subject
+	return claims, nil
+}
+
+func oauthConfig(provider *oidc.Provider, cfg models.OIDCConfig, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flexsupport/internal/auth/oidctest"
+	"flexsupport/internal/models"
+)
+
+const redirectURL = "https://shop.example.com/sso/callback"
+
+var alice = oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+
+func newIdP(t *testing.T) (*oidctest.IdP, models.OIDCConfig) {
+	t.Helper()
+	idp, err := oidctest.New()
+	if err != nil {
+		t.Fatalf("oidctest.New() error = %v", err)
+	}
+	t.Cleanup(idp.Close)
+	return idp, models.OIDCConfig{Issuer: idp.Issuer(), ClientID: "flexsupport", ClientSecret: "secret"}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp, cfg := newIdP(t)
+	client := NewOIDCClient(nil)
+	ctx := context.Background()
+
+	authURL, flow, err := client.AuthCodeURL(ctx, cfg, redirectURL, "/tickets")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	state, code, err := idp.Authorize(authURL, alice)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	claims, err := client.Exchange(ctx, cfg, redirectURL, flow, state, code)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := OIDCClaims{Issuer: idp.Issuer(), Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if claims != want {
+		t.Errorf("Exchange() = %+v, want %+v", claims, want)
+	}
+	if flow.Next != "/tickets" {
+		t.Errorf("flow.Next = %q, want /tickets", flow.Next)
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	idp, cfg := newIdP(t)
+	client := NewOIDCClient(nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		tamper func(flow *OIDCFlow, state, code *string)
+		// want is the error expected, or nil for any
+		want error
+	}{
+		{"state from another flow", func(flow *OIDCFlow, state, code *string) { *state = "forged" }, ErrOIDCState},
+		{"flow cookie missing", func(flow *OIDCFlow, state, code *string) { *flow = OIDCFlow{} }, ErrOIDCState},
+		{"wrong pkce verifier", func(flow *OIDCFlow, state, code *string) { flow.Verifier = "not-the-verifier" }, nil},
+		{"nonce from another flow", func(flow *OIDCFlow, state, code *string) { flow.Nonce = "other" }, ErrOIDCState},
+		{"unknown code", func(flow *OIDCFlow, state, code *string) { *code = "made-up" }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, flow, err := client.AuthCodeURL(ctx, cfg, redirectURL, "")
+			if err != nil {
+				t.Fatalf("AuthCodeURL() error = %v", err)
+			}
+			state, code, err := idp.Authorize(authURL, alice)
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			tt.tamper(&flow, &state, &code)
+
+			_, err = client.Exchange(ctx, cfg, redirectURL, flow, state, code)
+			if err == nil {
+				t.Fatal("Exchange() succeeded, want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Exchange() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeRedeemsCodeOnce(t *testing.T) {
+	idp, cfg := newIdP(t)
+	client := NewOIDCClient(nil)
+	ctx := context.Background()
+
+	authURL, flow, err := client.AuthCodeURL(ctx, cfg, redirectURL, "")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	state, code, err := idp.Authorize(authURL, alice)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if _, err := client.Exchange(ctx, cfg, redirectURL, flow, state, code); err != nil {
+		t.Fatalf("first Exchange() error = %v", err)
+	}
+	if _, err := client.Exchange(ctx, cfg, redirectURL, flow, state, code); err == nil {
+		t.Error("replayed Exchange() succeeded, want an error")
+	}
+}
@@ -0,0 +1,84 @@
+// Package auth holds the primitives shared by every sign-in flow: password
+// hashing and the random tokens used for sessions and emailed links.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// MinPasswordLength is the shortest password accepted when one is set
+const MinPasswordLength = 10
+
+// argon2id parameters, per the OWASP recommendation of m=19 MiB, t=2, p=1
+const (
+	argonTime    = 2
+	argonMemory  = 19 * 1024
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+var errMalformedHash = errors.New("malformed password hash")
+
+// dummyHash is compared against when the account does not exist, so a failed
+// sign-in takes the same time whether or not the email is registered
+var dummyHash, _ = HashPassword("flexsupport-dummy-password")
+
+// HashPassword returns the argon2id hash of password in the PHC string format,
+// e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword reports whether password matches hash. An empty hash, as for
+// an account that only signs in through SSO, never matches.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		_, _ = verify(dummyHash, password)
+		return false
+	}
+	ok, err := verify(hash, password)
+	return err == nil && ok
+}
+
+func verify(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errMalformedHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errMalformedHash
+	}
+	other := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
@@ -0,0 +1,17 @@
+// Package backoff spaces out the retries of the background workers
+package backoff
+
+import "time"
+
+// Delay doubles the wait after each failed attempt, from a minute up to six
+// hours
+func Delay(attempts int) time.Duration {
+	const limit = 6 * time.Hour
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 10 {
+		return limit
+	}
+	return min(time.Minute<<(attempts-1), limit)
+}
@@ -0,0 +1,353 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/sms"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ ports.CustomerRepository = (*DB)(nil)
+
+const customerColumns = `
+	c.id, c.tenant_id, c.name, c.phone, coalesce(c.email, '') as email,
+	c.created_at, c.updated_at`
+
+// ordersCount counts the customer's tickets, only in projectIDs unless it is
+// nil. Its placeholder is the next one after args, which it extends.
+func ordersCount(args *[]any, projectIDs []string) string {
+	orders := "t.customer_id = c.id"
+	if projectIDs != nil {
+		*args = append(*args, projectIDs)
+		orders += fmt.Sprintf(" and t.project_id = any($%d::text[]::uuid[])", len(*args))
+	}
+	return "(select count(*) from tickets t where " + orders + ") as total_orders"
+}
+
+// ListCustomers returns customers matching the search by name, phone or
+// email, most recently updated first
+func (db *DB) ListCustomers(ctx context.Context, filter models.CustomerFilter) ([]models.Customer, error) {
+	customers := make([]models.Customer, 0)
+	err := db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		args := []any{filter.TenantID}
+		query := `
+		select ` + customerColumns + `,
+			` + ordersCount(&args, filter.ProjectIDs) + `
+		from customers c
+		where c.tenant_id = $1`
+		if filter.Search != "" {
+			countryCode, err := smsCountryCode(ctx, tx, filter.TenantID)
+			if err != nil {
+				return err
+			}
+			args = append(args, "%"+filter.Search+"%", models.PhoneKey(filter.Search), customerPhoneKey(filter.Search, countryCode))
+			query += fmt.Sprintf(` and (
+				c.name ilike $%[1]d or c.email ilike $%[1]d or c.phone ilike $%[1]d or
+				($%[2]d <> '' and (c.phone_key like '%%' || $%[2]d || '%%' or c.phone_key = $%[3]d))
+			)`, len(args)-2, len(args)-1, len(args))
+		}
+		query += " order by c.updated_at desc"
+		if filter.Limit > 0 {
+			args = append(args, filter.Limit)
+			query += fmt.Sprintf(" limit $%d", len(args))
+		}
+		return tx.SelectContext(ctx, &customers, query, args...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customers: %w", err)
+	}
+	return customers, nil
+}
+
+// GetCustomer loads a customer, counting only their tickets in projectIDs
+// unless it is nil
+func (db *DB) GetCustomer(ctx context.Context, tenantID, id string, projectIDs []string) (models.Customer, error) {
+	var customer models.Customer
+	args := []any{tenantID, id}
+	query := `
+	select ` + customerColumns + `,
+		` + ordersCount(&args, projectIDs) + `
+	from customers c
+	where c.tenant_id = $1 and c.id = $2`
+	if err := db.GetContext(ctx, &customer, query, args...); err != nil {
+		if isNotFound(err) {
+			return models.Customer{}, ports.ErrNotFound
+		}
+		return models.Customer{}, fmt.Errorf("failed to get customer %s: %w", id, err)
+	}
+	return customer, nil
+}
+
+// customerPhoneKey returns the number customers are matched on: its E.164 form, as
+// texts are sent to, or just its digits when it has no such form
+func customerPhoneKey(phone, countryCode string) string {
+	if key, err := sms.NormalizePhone(phone, countryCode); err == nil {
+		return key
+	}
+	return models.PhoneKey(phone)
+}
+
+// smsCountryCode returns the default country code of the tenant's sms
+// integration, or "" when there is none
+func smsCountryCode(ctx context.Context, tx *sqlx.Tx, tenantID string) (string, error) {
+	var code string
+	err := tx.GetContext(ctx, &code, `
+	select coalesce(config->>'default_country_code', '') from integrations
+	where tenant_id = $1 and integration_type = $2
+	order by created_at
+	limit 1`, tenantID, models.IntegrationSMS)
+	if err != nil && !isNotFound(err) {
+		return "", fmt.Errorf("failed to load default country code: %w", err)
+	}
+	return code, nil
+}
+
+// saveCustomer links the ticket to a customer and brings the customer's
+// details up to date with it. ticket.CustomerID picks the customer when set
+// and it still shares the ticket's phone number or email; otherwise one with
+// the same phone number, then email, is used, and a new one is created when
+// there is none. Details another customer already has are
+// left as they were, so the unique indexes never fail the ticket.
+func saveCustomer(ctx context.Context, tx *sqlx.Tx, ticket *models.Ticket) error {
+	countryCode, err := smsCountryCode(ctx, tx, ticket.TenantID)
+	if err != nil {
+		return err
+	}
+	phoneKey := customerPhoneKey(ticket.CustomerPhone, countryCode)
+	email := models.NormalizeEmail(ticket.CustomerEmail)
+	if phoneKey == "" && email == "" {
+		ticket.CustomerID = nil
+		return nil
+	}
+
+	var id string
+	if ticket.CustomerID != nil {
+		id = *ticket.CustomerID
+	}
+	for attempt := 0; id == ""; attempt++ {
+		err := tx.GetContext(ctx, &id, `
+		select id from customers
+		where tenant_id = $1 and (phone_key = nullif($2, '') or email = nullif($3, '')::citext)
+		order by phone_key = nullif($2, '') desc nulls last, created_at
+		limit 1`, ticket.TenantID, phoneKey, email)
+		if err == nil {
+			break
+		}
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to match customer: %w", err)
+		}
+		if attempt > 0 {
+			return fmt.Errorf("failed to create customer for ticket %s", ticket.ID)
+		}
+		// A concurrent ticket may create the same customer; then nothing is
+		// inserted and the next pass finds theirs
+		err = tx.GetContext(ctx, &id, `
+		insert into customers (tenant_id, name, phone, phone_key, email)
+		values ($1, $2, $3, nullif($4, ''), nullif($5, '')::citext)
+		on conflict do nothing
+		returning id`, ticket.TenantID, ticket.CustomerName, ticket.CustomerPhone, phoneKey, email)
+		if err == nil {
+			ticket.CustomerID = &id
+			return nil
+		}
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to create customer: %w", err)
+		}
+	}
+
+	query := `
+	update customers c set
+		name = $3,
+		phone = case when p.free then $4 else c.phone end,
+		phone_key = case when p.free then $5 else c.phone_key end,
+		email = case when e.free then $6::citext else c.email end,
+		updated_at = now()
+	from
+		(select $5 <> '' and not exists (
+			select 1 from customers o where o.tenant_id = $2 and o.phone_key = $5 and o.id <> $1
+		) as free) p,
+		(select $6 <> '' and not exists (
+			select 1 from customers o where o.tenant_id = $2 and o.email = $6::citext and o.id <> $1
+		) as free) e
+	where c.id = $1 and c.tenant_id = $2
+		and (c.phone_key = nullif($5, '') or c.email = nullif($6, '')::citext)
+	returning c.id`
+	err = tx.GetContext(ctx, &id, query, id, ticket.TenantID, ticket.CustomerName, ticket.CustomerPhone, phoneKey, email)
+	if isNotFound(err) && ticket.CustomerID != nil {
+		// The picked customer is gone or is someone else now; match on the
+		// details instead
+		ticket.CustomerID = nil
+		return saveCustomer(ctx, tx, ticket)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update customer %s: %w", id, err)
+	}
+	ticket.CustomerID = &id
+	return nil
+}
+
+// duplicateCustomerPairs finds pairs sharing the last ten digits of their
+// phone numbers, the same email once dots and +tags before the @ are
+// ignored, or similar names by pg_trgm's % operator. Each kind of match is
+// its own join so the name match can use the trigram index.
+const duplicateCustomerPairs = `
+	with keyed as (
+		select c.id, c.name,
+			nullif(right(c.phone_key, 10), '') as phone_tail,
+			regexp_replace(split_part(lower(c.email::text), '@', 1), '\+.*$|\.', '', 'g')
+				|| '@' || split_part(lower(c.email::text), '@', 2) as email_key
+		from customers c
+		where c.tenant_id = $1
+	),
+	pairs as (
+		select a.id as a_id, b.id as b_id from keyed a join keyed b on a.id < b.id and a.phone_tail = b.phone_tail
+		union
+		select a.id, b.id from keyed a join keyed b on a.id < b.id and a.email_key = b.email_key
+		union
+		select a.id, b.id from customers a
+		join customers b on b.tenant_id = a.tenant_id and a.id < b.id and a.name % b.name
+		where a.tenant_id = $1
+	)`
+
+func (db *DB) FindDuplicateCustomers(ctx context.Context, tenantID string, limit int) ([]models.DuplicateCustomers, error) {
+	query := duplicateCustomerPairs + `
+	select
+		a.id as "a.id", a.tenant_id as "a.tenant_id", a.name as "a.name", a.phone as "a.phone",
+		coalesce(a.email, '') as "a.email", a.created_at as "a.created_at", a.updated_at as "a.updated_at",
+		(select count(*) from tickets t where t.customer_id = a.id) as "a.total_orders",
+		b.id as "b.id", b.tenant_id as "b.tenant_id", b.name as "b.name", b.phone as "b.phone",
+		coalesce(b.email, '') as "b.email", b.created_at as "b.created_at", b.updated_at as "b.updated_at",
+		(select count(*) from tickets t where t.customer_id = b.id) as "b.total_orders",
+		coalesce(ka.phone_tail = kb.phone_tail, false) as same_phone,
+		coalesce(ka.email_key = kb.email_key, false) as same_email,
+		similarity(a.name, b.name) as name_similarity
+	from pairs p
+	join customers a on a.id = p.a_id
+	join customers b on b.id = p.b_id
+	join keyed ka on ka.id = a.id
+	join keyed kb on kb.id = b.id
+	order by
+		coalesce(ka.phone_tail = kb.phone_tail or ka.email_key = kb.email_key, false) desc,
+		similarity(a.name, b.name) desc
+	limit $2`
+
+	var rows []struct {
+		A              models.Customer `db:"a"`
+		B              models.Customer `db:"b"`
+		SamePhone      bool            `db:"same_phone"`
+		SameEmail      bool            `db:"same_email"`
+		NameSimilarity float64         `db:"name_similarity"`
+	}
+	if err := db.SelectContext(ctx, &rows, query, tenantID, limit); err != nil {
+		return nil, fmt.Errorf("failed to find duplicate customers: %w", err)
+	}
+	duplicates := make([]models.DuplicateCustomers, 0, len(rows))
+	for _, row := range rows {
+		duplicates = append(duplicates, models.DuplicateCustomers{
+			Customer:       row.A,
+			Other:          row.B,
+			SamePhone:      row.SamePhone,
+			SameEmail:      row.SameEmail,
+			NameSimilarity: row.NameSimilarity,
+		})
+	}
+	return duplicates, nil
+}
+
+// MergeCustomers moves the merged customer's tickets, and with them their
+// comments and sent notifications, to the kept customer in one transaction.
+// The kept customer takes the merged one's phone and email where it has none,
+// and the merged customer is deleted. merge.KeptCustomerID,
+// MergedCustomerID, TenantID and MergedByUserID must be set; the rest is
+// filled in. Every moved ticket gets a customer_merged event.
+func (db *DB) MergeCustomers(ctx context.Context, merge *models.CustomerMerge) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		var locked []struct {
+			ID       string  `db:"id"`
+			Name     string  `db:"name"`
+			Phone    string  `db:"phone"`
+			PhoneKey *string `db:"phone_key"`
+			Email    string  `db:"email"`
+		}
+		err := tx.SelectContext(ctx, &locked, `
+		select id, name, phone, phone_key, coalesce(email, '') as email
+		from customers
+		where tenant_id = $1 and id in ($2, $3)
+		order by id
+		for update`, merge.TenantID, merge.KeptCustomerID, merge.MergedCustomerID)
+		if err != nil {
+			return fmt.Errorf("failed to lock customers: %w", err)
+		}
+		if len(locked) != 2 {
+			return ports.ErrNotFound
+		}
+		var mergedPhoneKey string
+		for _, c := range locked {
+			if c.ID == merge.MergedCustomerID {
+				merge.MergedName, merge.MergedPhone, merge.MergedEmail = c.Name, c.Phone, c.Email
+				if c.PhoneKey != nil {
+					mergedPhoneKey = *c.PhoneKey
+				}
+			}
+		}
+
+		ticketIDs := make([]string, 0)
+		err = tx.SelectContext(ctx, &ticketIDs, `
+		update tickets set customer_id = $3
+		where tenant_id = $1 and customer_id = $2
+		returning id`, merge.TenantID, merge.MergedCustomerID, merge.KeptCustomerID)
+		if err != nil {
+			return fmt.Errorf("failed to move tickets: %w", err)
+		}
+		merge.TicketCount = len(ticketIDs)
+
+		if _, err := tx.ExecContext(ctx, "delete from customers where id = $1", merge.MergedCustomerID); err != nil {
+			return fmt.Errorf("failed to delete customer %s: %w", merge.MergedCustomerID, err)
+		}
+		_, err = tx.ExecContext(ctx, `
+		update customers set
+			phone = case when phone_key is null then $2 else phone end,
+			phone_key = coalesce(phone_key, nullif($3, '')),
+			email = coalesce(email, nullif($4, '')::citext),
+			updated_at = now()
+		where id = $1`, merge.KeptCustomerID, merge.MergedPhone, mergedPhoneKey, merge.MergedEmail)
+		if err != nil {
+			return fmt.Errorf("failed to update customer %s: %w", merge.KeptCustomerID, err)
+		}
+
+		query := `
+		insert into customer_merges (
+			tenant_id, kept_customer_id, merged_customer_id,
+			merged_name, merged_phone, merged_email, ticket_ids, merged_by_user_id
+		) values ($1, $2, $3, $4, $5, nullif($6, '')::citext, $7::text[]::uuid[], $8)
+		returning id, created_at`
+		row := tx.QueryRowxContext(ctx, query,
+			merge.TenantID, merge.KeptCustomerID, merge.MergedCustomerID,
+			merge.MergedName, merge.MergedPhone, merge.MergedEmail, ticketIDs, merge.MergedByUserID,
+		)
+		if err := row.Scan(&merge.ID, &merge.CreatedAt); err != nil {
+			return fmt.Errorf("failed to record customer merge: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		insert into ticket_events (tenant_id, ticket_id, actor_user_id, type, payload)
+		select $1, id, $2, $3, jsonb_build_object(
+			'merge_id', $4::text,
+			'from_customer_id', $5::text,
+			'from_name', $6::text,
+			'to_customer_id', $7::text
+		)
+		from unnest($8::text[]::uuid[]) as id`,
+			merge.TenantID, merge.MergedByUserID, models.EventCustomerMerged, merge.ID,
+			merge.MergedCustomerID, merge.MergedName, merge.KeptCustomerID, ticketIDs,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record merge events: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,22 @@
+package db
+
+import "testing"
+
+func TestCustomerPhoneKey(t *testing.T) {
+	tests := []struct {
+		phone, countryCode, want string
+	}{
+		{"(541) 555-0123", "1", "+15415550123"},
+		{"+1 541 555 0123", "1", "+15415550123"},
+		{"07700 900123", "44", "+447700900123"},
+		{"+44 7700 900123", "", "+447700900123"},
+		{"541-555-0123", "", "5415550123"},
+		{"ext. 12", "1", "12"},
+		{"", "1", ""},
+	}
+	for _, tt := range tests {
+		if got := customerPhoneKey(tt.phone, tt.countryCode); got != tt.want {
+			t.Errorf("customerPhoneKey(%q, %q) = %q, want %q", tt.phone, tt.countryCode, got, tt.want)
+		}
+	}
+}
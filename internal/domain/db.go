@@ -2,12 +2,20 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"time"
+
+	"flexsupport/internal/middleware"
+
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
-	"time"
 )
 
+// DB wraps the connection pool. Its BeginTxx, GetContext, SelectContext and
+// ExecContext scope every statement to the tenant in the request context so
+// the row-level security policies (migration 0008) apply; other sqlx methods
+// run unscoped and see no tenant-owned rows.
 type DB struct {
 	*sqlx.DB
 }
@@ -24,3 +32,78 @@ func NewDB(ctx context.Context, connectionString string) *DB {
 	}
 	return &DB{DB: sqlDB}
 }
+
+// BeginTxx starts a transaction with app.tenant_id set to the tenant in ctx,
+// if any, for the lifetime of the transaction
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	tenantID, err := middleware.TenantID(ctx)
+	if err != nil {
+		return tx, nil
+	}
+	if _, err := tx.ExecContext(ctx, "select set_config('app.tenant_id', $1, true)", tenantID); err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("failed to set tenant: %w", err)
+	}
+	return tx, nil
+}
+
+func (db *DB) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// inTenantTx runs fn in a tenant-scoped transaction, committing if it returns
+// nil. Without a tenant in ctx there is nothing to scope, so fn gets a plain
+// transaction and the policies hide every tenant-owned row.
+func (db *DB) inTenantTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// inBypassTx runs fn in a transaction that skips the row-level security
+// policies, committing if it returns nil. It is only for background work that
+// acts on every tenant's rows, like delivering queued mail.
+func (db *DB) inBypassTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "select set_config('app.bypass_rls', 'on', true)"); err != nil {
+		return fmt.Errorf("failed to bypass row-level security: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
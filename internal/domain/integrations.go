@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+const integrationColumns = `id, tenant_id, integration_type, name, enabled, config, created_at`
+
+func (db *DB) GetIntegration(ctx context.Context, tenantID string, integrationType models.IntegrationType, name string) (models.Integration, error) {
+	query := `
+	select ` + integrationColumns + `
+	from integrations
+	where tenant_id = $1 and integration_type = $2 and name = $3`
+
+	var integration models.Integration
+	if err := db.GetContext(ctx, &integration, query, tenantID, integrationType, name); err != nil {
+		if isNotFound(err) {
+			return models.Integration{}, ports.ErrNotFound
+		}
+		return models.Integration{}, fmt.Errorf("failed to get %s integration %q: %w", integrationType, name, err)
+	}
+	return integration, nil
+}
+
+// SaveIntegration creates the integration or replaces the config of the
+// existing one with the same type and name
+func (db *DB) SaveIntegration(ctx context.Context, integration *models.Integration) error {
+	config := "{}"
+	if len(integration.Config) > 0 {
+		config = string(integration.Config)
+	}
+	query := `
+	insert into integrations (tenant_id, integration_type, name, enabled, config)
+	values ($1, $2, $3, $4, $5::jsonb)
+	on conflict (tenant_id, integration_type, name)
+	do update set enabled = excluded.enabled, config = excluded.config
+	returning id, created_at`
+
+	err := db.GetContext(ctx, integration, query,
+		integration.TenantID, integration.Type, integration.Name, integration.Enabled, config,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save %s integration %q: %w", integration.Type, integration.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const invitationColumns = `
+	i.id, i.tenant_id, i.user_id, i.role_id, i.token_hash, i.invited_by_user_id,
+	i.created_at, i.expires_at, i.accepted_at, i.revoked_at,
+	u.email, u.name, coalesce(r.name, '') as role_name, coalesce(ib.name, '') as invited_by`
+
+const invitationFrom = `
+	from invitations i
+	join users u on u.id = i.user_id
+	left join roles r on r.id = i.role_id
+	left join users ib on ib.id = i.invited_by_user_id`
+
+var _ ports.InvitationRepository = (*DB)(nil)
+
+// CreateInvitation records an invitation and marks the user as invited to the
+// tenant. Earlier invitations to the same user stop working.
+func (db *DB) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		revoke := `
+		update invitations set revoked_at = now()
+		where tenant_id = $1 and user_id = $2 and accepted_at is null and revoked_at is null`
+		if _, err := tx.ExecContext(ctx, revoke, invitation.TenantID, invitation.UserID); err != nil {
+			return fmt.Errorf("failed to revoke earlier invitations: %w", err)
+		}
+
+		membership := `
+		insert into tenant_memberships (tenant_id, user_id, status)
+		values ($1, $2, 'invited')
+		on conflict (tenant_id, user_id) do nothing`
+		if _, err := tx.ExecContext(ctx, membership, invitation.TenantID, invitation.UserID); err != nil {
+			return fmt.Errorf("failed to add invited membership: %w", err)
+		}
+
+		insert := `
+		insert into invitations (tenant_id, user_id, role_id, token_hash, invited_by_user_id, expires_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at`
+		err := tx.QueryRowxContext(ctx, insert,
+			invitation.TenantID, invitation.UserID, invitation.RoleID, invitation.TokenHash,
+			invitation.InvitedByUserID, invitation.ExpiresAt,
+		).Scan(&invitation.ID, &invitation.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create invitation: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListInvitations returns the tenant's invitations that have been neither
+// accepted nor revoked, including expired ones
+func (db *DB) ListInvitations(ctx context.Context, tenantID string) ([]models.Invitation, error) {
+	query := "select " + invitationColumns + invitationFrom + `
+	where i.tenant_id = $1 and i.accepted_at is null and i.revoked_at is null
+	order by i.created_at desc`
+
+	invitations := make([]models.Invitation, 0)
+	if err := db.SelectContext(ctx, &invitations, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+func (db *DB) GetInvitationByToken(ctx context.Context, tenantID, tokenHash string) (models.Invitation, error) {
+	query := "select " + invitationColumns + invitationFrom + " where i.tenant_id = $1 and i.token_hash = $2"
+
+	var invitation models.Invitation
+	if err := db.GetContext(ctx, &invitation, query, tenantID, tokenHash); err != nil {
+		if isNotFound(err) {
+			return models.Invitation{}, ports.ErrNotFound
+		}
+		return models.Invitation{}, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// RevokeInvitation stops a pending invitation from working and removes the
+// invited membership it created
+func (db *DB) RevokeInvitation(ctx context.Context, tenantID, id string) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		var userID string
+		query := `
+		update invitations set revoked_at = now()
+		where tenant_id = $1 and id = $2 and accepted_at is null and revoked_at is null
+		returning user_id`
+		if err := tx.GetContext(ctx, &userID, query, tenantID, id); err != nil {
+			if isNotFound(err) {
+				return ports.ErrNotFound
+			}
+			return fmt.Errorf("failed to revoke invitation %s: %w", id, err)
+		}
+
+		membership := "delete from tenant_memberships where tenant_id = $1 and user_id = $2 and status = 'invited'"
+		if _, err := tx.ExecContext(ctx, membership, tenantID, userID); err != nil {
+			return fmt.Errorf("failed to remove invited membership: %w", err)
+		}
+		return nil
+	})
+}
+
+// AcceptInvitation uses up the invitation and makes the invitee an active
+// member with the invited role. passwordHash, when set, becomes the user's
+// password. Returns ports.ErrConflict if the invitation was accepted, revoked
+// or expired in the meantime, so a token works only once.
+func (db *DB) AcceptInvitation(ctx context.Context, invitation models.Invitation, passwordHash string) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		update invitations set accepted_at = now()
+		where id = $1 and accepted_at is null and revoked_at is null and expires_at > now()`
+		result, err := tx.ExecContext(ctx, query, invitation.ID)
+		if err != nil {
+			return fmt.Errorf("failed to accept invitation %s: %w", invitation.ID, err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to accept invitation %s: %w", invitation.ID, err)
+		} else if rows == 0 {
+			return ports.ErrConflict
+		}
+
+		// Following the emailed link proves the address
+		user := "update users set email_verified = true, password_hash = coalesce(nullif($2, ''), password_hash) where id = $1"
+		if _, err := tx.ExecContext(ctx, user, invitation.UserID, passwordHash); err != nil {
+			return fmt.Errorf("failed to update user %s: %w", invitation.UserID, err)
+		}
+
+		membership := `
+		update tenant_memberships set status = 'active'
+		where tenant_id = $1 and user_id = $2 and status = 'invited'`
+		if _, err := tx.ExecContext(ctx, membership, invitation.TenantID, invitation.UserID); err != nil {
+			return fmt.Errorf("failed to activate membership: %w", err)
+		}
+
+		if invitation.RoleID != nil {
+			role := `
+			insert into membership_roles (tenant_id, user_id, role_id)
+			values ($1, $2, $3)
+			on conflict do nothing`
+			if _, err := tx.ExecContext(ctx, role, invitation.TenantID, invitation.UserID, *invitation.RoleID); err != nil {
+				return fmt.Errorf("failed to grant invited role: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -2,7 +2,10 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -10,150 +13,365 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 //go:embed migrations/*.sql
 var migrationFiles embed.FS
 
+// migrationLockID is the pg_advisory_lock key held while migrating, so that
+// replicas booting at the same time apply migrations one at a time
+const migrationLockID int64 = 0x666c6578737570 // "flexsup"
+
+const createMigrationsTable = `
+create table if not exists schema_migrations (
+  version bigint primary key,
+  name text not null,
+  checksum text not null default '',
+  applied_at timestamptz not null default now()
+);
+alter table schema_migrations add column if not exists checksum text not null default '';`
+
+var (
+	// ErrChecksumMismatch is returned when an applied migration file has been edited
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	// ErrNoDownMigration is returned when rolling back a version without a .down.sql file
+	ErrNoDownMigration = errors.New("no down migration")
+	// ErrUnknownMigration is returned when a requested version has no embedded migration
+	ErrUnknownMigration = errors.New("unknown migration version")
+)
+
+// Migration is a numbered schema change loaded from NNNN_name.sql, with the
+// optional NNNN_name.down.sql that reverts it
 type Migration struct {
-	Version int64
-	Name    string
-	SQL     string
+	Version  int64
+	Name     string
+	SQL      string
+	DownSQL  string
+	Checksum string
+}
+
+// MigrationStatus describes whether a migration has been applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool
+}
+
+type appliedMigration struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Migrate applies every pending embedded migration
+func (db *DB) Migrate(ctx context.Context) error {
+	return db.MigrateTo(ctx, 0)
+}
+
+// MigrateTo applies pending migrations up to and including target, or all of
+// them when target is 0. Each migration runs in its own transaction while a
+// session-level advisory lock is held, and the checksums of already applied
+// migrations are verified before anything runs.
+func (db *DB) MigrateTo(ctx context.Context, target int64) error {
+	return db.withMigrationLock(ctx, func(conn *sqlx.Conn, migrations []Migration, applied map[int64]appliedMigration) error {
+		if target != 0 && !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == target }) {
+			return fmt.Errorf("%w: %d", ErrUnknownMigration, target)
+		}
+		for _, migration := range migrations {
+			if target != 0 && migration.Version > target {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := applyMigration(ctx, conn, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback reverts the most recently applied steps migrations, newest first
+func (db *DB) Rollback(ctx context.Context, steps int) error {
+	return db.withMigrationLock(ctx, func(conn *sqlx.Conn, migrations []Migration, applied map[int64]appliedMigration) error {
+		return rollback(ctx, conn, migrations, applied, steps)
+	})
+}
+
+// Redo reverts the most recently applied migration and applies it again
+func (db *DB) Redo(ctx context.Context) error {
+	return db.withMigrationLock(ctx, func(conn *sqlx.Conn, migrations []Migration, applied map[int64]appliedMigration) error {
+		latest, ok := latestApplied(migrations, applied)
+		if !ok {
+			return errors.New("no applied migrations to redo")
+		}
+		if err := rollback(ctx, conn, migrations, applied, 1); err != nil {
+			return err
+		}
+		return applyMigration(ctx, conn, latest)
+	})
 }
 
-func (db *DB) getAppliedMigrations(ctx context.Context) (map[int64]bool, error) {
-	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+// MigrationStatuses lists every embedded migration alongside whether and when
+// it was applied
+func (db *DB) MigrationStatuses(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := db.withMigrationLock(ctx, func(conn *sqlx.Conn, migrations []Migration, applied map[int64]appliedMigration) error {
+		statuses = make([]MigrationStatus, 0, len(migrations))
+		for _, migration := range migrations {
+			status := MigrationStatus{Migration: migration}
+			if row, ok := applied[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = row.AppliedAt
+				status.Modified = row.Checksum != "" && row.Checksum != migration.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	}, skipChecksums)
+	return statuses, err
+}
+
+type lockOption int
+
+const skipChecksums lockOption = iota
+
+// withMigrationLock pins a connection, takes the advisory lock, bootstraps
+// schema_migrations and hands fn the embedded and applied migrations
+func (db *DB) withMigrationLock(
+	ctx context.Context,
+	fn func(conn *sqlx.Conn, migrations []Migration, applied map[int64]appliedMigration) error,
+	opts ...lockOption,
+) error {
+	conn, err := db.Connx(ctx)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	slog.Debug("Waiting for migration lock")
+	if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
 	}
 	defer func() {
-		err = rows.Close()
-		if err != nil {
-			slog.Error("Failed to close rows", "error", err)
-			return
+		// use a fresh context so the lock is released even if ctx was cancelled
+		if _, err := conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", migrationLockID); err != nil {
+			slog.Error("Failed to release migration lock", "error", err)
 		}
 	}()
 
-	applied := make(map[int64]bool)
-	for rows.Next() {
-		var version int64
-		if err := rows.Scan(&version); err != nil {
-			return nil, err
-		}
-		applied[version] = true
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
 	}
-	slog.Info("Applied migrations", "count", len(applied))
-	return applied, rows.Err()
-}
 
-func (db *DB) runMigrations(ctx context.Context) error {
-	applied, err := db.getAppliedMigrations(ctx)
+	migrations, err := loadMigrations()
 	if err != nil {
-		return NewIgnorableError("failed to get applied migrations: " + err.Error())
+		return fmt.Errorf("failed to load migrations: %w", err)
 	}
 
-	migrations, err := loadMigrations()
+	applied, err := getAppliedMigrations(ctx, conn)
 	if err != nil {
-		return NewIgnorableError("failed to load migrations: " + err.Error())
+		return fmt.Errorf("failed to get applied migrations: %w", err)
 	}
 
-	tx, err := db.Beginx()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	if !slices.Contains(opts, skipChecksums) {
+		if err := verifyChecksums(migrations, applied); err != nil {
+			return err
+		}
+	}
+
+	return fn(conn, migrations, applied)
+}
+
+func getAppliedMigrations(ctx context.Context, conn *sqlx.Conn) (map[int64]appliedMigration, error) {
+	rows := make([]appliedMigration, 0)
+	query := "SELECT version, name, checksum, applied_at FROM schema_migrations"
+	if err := conn.SelectContext(ctx, &rows, query); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
 	}
+	slog.Debug("Applied migrations", "count", len(applied))
+	return applied, nil
+}
+
+// verifyChecksums refuses to continue if a migration that was already applied
+// no longer matches the embedded file
+func verifyChecksums(migrations []Migration, applied map[int64]appliedMigration) error {
 	for _, migration := range migrations {
-		if applied[migration.Version] {
+		row, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+		if row.Checksum == "" {
+			// applied before checksums were recorded; trust it
 			continue
 		}
-		slog.Info("Applying migration",
-			slog.Int64("version", migration.Version),
-			slog.String("name", migration.Name))
-		if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+		if row.Checksum != migration.Checksum {
+			return fmt.Errorf("%w: version %d (%s) was edited after it was applied",
+				ErrChecksumMismatch, migration.Version, migration.Name)
 		}
+	}
+	return nil
+}
 
-		insertSQL := "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+func latestApplied(migrations []Migration, applied map[int64]appliedMigration) (Migration, bool) {
+	for _, migration := range slices.Backward(migrations) {
+		if _, ok := applied[migration.Version]; ok {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
 
-		_, err = tx.ExecContext(ctx, insertSQL, migration.Version, migration.Name)
-		if err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("migration %d failed: %w", migration.Version, err)
+func rollback(ctx context.Context, conn *sqlx.Conn, migrations []Migration, applied map[int64]appliedMigration, steps int) error {
+	byVersion := make(map[int64]Migration, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+
+	for _, version := range versions[:min(steps, len(versions))] {
+		migration, ok := byVersion[version]
+		if !ok {
+			return fmt.Errorf("%w: %d is applied but not embedded in this build", ErrUnknownMigration, version)
+		}
+		if err := revertMigration(ctx, conn, migration); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+func applyMigration(ctx context.Context, conn *sqlx.Conn, migration Migration) error {
+	slog.Info("Applying migration",
+		slog.Int64("version", migration.Version),
+		slog.String("name", migration.Name))
+
+	insertSQL := "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)"
+	return inTx(ctx, conn, migration, migration.SQL, insertSQL, migration.Version, migration.Name, migration.Checksum)
+}
+
+func revertMigration(ctx context.Context, conn *sqlx.Conn, migration Migration) error {
+	if strings.TrimSpace(migration.DownSQL) == "" {
+		return fmt.Errorf("%w for version %d (%s)", ErrNoDownMigration, migration.Version, migration.Name)
 	}
+	slog.Info("Reverting migration",
+		slog.Int64("version", migration.Version),
+		slog.String("name", migration.Name))
+
+	deleteSQL := "DELETE FROM schema_migrations WHERE version = $1"
+	return inTx(ctx, conn, migration, migration.DownSQL, deleteSQL, migration.Version)
+}
 
+// inTx runs a migration script and its schema_migrations bookkeeping
+// statement in a single transaction
+func inTx(ctx context.Context, conn *sqlx.Conn, migration Migration, script, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// migrations act on every tenant's rows, so they skip the row-level security policies
+	if _, err := tx.ExecContext(ctx, "select set_config('app.bypass_rls', 'on', true)"); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("failed to bypass row-level security: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
+	}
 	return nil
 }
 
+// loadMigrations reads the embedded NNNN_name.sql files and pairs each with
+// its NNNN_name.down.sql, if one exists
 func loadMigrations() ([]Migration, error) {
 	entries, err := migrationFiles.ReadDir("migrations")
 	if err != nil {
 		return nil, err
 	}
 
-	slog.Info("Loading migrations")
-	slog.Info("Found migrations", "count", len(entries))
-	migrations := make([]Migration, 0, len(entries))
+	slog.Debug("Found migration files", "count", len(entries))
+	byVersion := make(map[int64]*Migration, len(entries))
 	for _, entry := range entries {
-		slog.Info(entry.Name())
-		if !strings.HasSuffix(entry.Name(), ".sql") {
-			slog.Info("Skipping migration", "name", entry.Name())
+		fileName := entry.Name()
+		if !strings.HasSuffix(fileName, ".sql") {
+			slog.Warn("Skipping migration", "name", fileName)
 			continue
 		}
 
-		parts := strings.SplitN(entry.Name(), "_", 2)
+		parts := strings.SplitN(fileName, "_", 2)
 		if len(parts) < 2 {
-			slog.Info("Skipping migration", "name", entry.Name())
-			continue
+			return nil, fmt.Errorf("migration %s is not named NNNN_name.sql", fileName)
 		}
 
 		version, err := strconv.ParseInt(parts[0], 10, 64)
 		if err != nil {
-			slog.Info("Skipping migration", "name", entry.Name())
-			continue
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", fileName, err)
 		}
 
-		content, err := migrationFiles.ReadFile(filepath.Join("migrations", entry.Name()))
+		content, err := migrationFiles.ReadFile(filepath.Join("migrations", fileName))
 		if err != nil {
-			slog.Error("Failed to read migration file", "name", entry.Name(), "error", err)
+			slog.Error("Failed to read migration file", "name", fileName, "error", err)
 			return nil, err
 		}
 
-		name := strings.TrimSuffix(parts[1], ".sql")
+		down := strings.HasSuffix(fileName, ".down.sql")
+		name := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(parts[1], ".sql"), ".down"), ".up")
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, migration.Name, name)
+		}
 
-		migrations = append(migrations, Migration{
-			Version: version,
-			Name:    name,
-			SQL:     string(content),
-		})
+		if down {
+			migration.DownSQL = string(content)
+			continue
+		}
+		if migration.SQL != "" {
+			return nil, fmt.Errorf("duplicate migration version %d", version)
+		}
+		sum := sha256.Sum256(content)
+		migration.SQL = string(content)
+		migration.Checksum = hex.EncodeToString(sum[:])
 	}
 
-	if len(migrations) == 0 {
-		return migrations, nil
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.SQL == "" {
+			return nil, fmt.Errorf("migration %d (%s) has a down file but no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
 	}
 
 	sort.Slice(migrations, func(i, j int) bool {
 		return migrations[i].Version < migrations[j].Version
 	})
-	migrations = slices.Clip(migrations)
 
 	return migrations, nil
 }
-
-type IgnorableError struct {
-	msg string
-}
-
-func (ie IgnorableError) Error() string {
-	return ie.msg
-}
-
-func NewIgnorableError(message string) error {
-	return &IgnorableError{msg: message}
-}
-
-var ErrIgnorable = &IgnorableError{}
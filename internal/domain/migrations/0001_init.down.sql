@@ -0,0 +1,21 @@
+drop table if exists tenant_domains;
+drop table if exists integrations;
+drop table if exists tenant_settings;
+drop table if exists ticket_events;
+drop table if exists ticket_comments;
+drop table if exists ticket_field_values;
+drop table if exists tickets;
+drop table if exists request_type_fields;
+drop table if exists custom_field_options;
+drop table if exists custom_fields;
+drop table if exists request_types;
+drop table if exists project_memberships;
+drop table if exists project_portal_settings;
+drop table if exists projects;
+drop table if exists membership_roles;
+drop table if exists role_permissions;
+drop table if exists permissions;
+drop table if exists roles;
+drop table if exists tenant_memberships;
+drop table if exists tenants;
+drop table if exists users;
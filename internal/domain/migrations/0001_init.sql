@@ -106,6 +106,45 @@ create table if not exists request_types (
 );
 
 create index on request_types (tenant_id, project_id);
+
+create table if not exists custom_fields (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+
+  key text not null,            -- stable programmatic key: "asset_tag"
+  name text not null,           -- display name: "Asset Tag"
+  description text,
+
+  field_type text not null,     -- 'text','textarea','number','bool','date','datetime',
+                                -- 'select','multiselect','user','group' (future)
+
+  is_archived boolean not null default false,
+
+  created_at timestamptz not null default now(),
+
+  unique (tenant_id, key)
+);
+
+
+create index if not exists custom_fields_tenant_idx
+  on custom_fields (tenant_id);
+
+
+create table if not exists custom_field_options (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  field_id uuid not null references custom_fields(id) on delete cascade,
+
+  value text not null,       -- stable value stored in ticket
+  label text not null,       -- display label
+  sort_order int not null default 0,
+  is_archived boolean not null default false,
+
+  unique (field_id, value)
+);
+
+create index on custom_field_options (tenant_id, field_id);
+
 create table if not exists request_type_fields (
   tenant_id uuid not null references tenants(id) on delete cascade,
   request_type_id uuid not null references request_types(id) on delete cascade,
@@ -159,44 +198,6 @@ create index if not exists tickets_tenant_requester_idx
 create index if not exists tickets_tenant_assigned_idx
   on tickets (tenant_id, assigned_to_user_id);
 
-create table if not exists custom_fields (
-  id uuid primary key default gen_random_uuid(),
-  tenant_id uuid not null references tenants(id) on delete cascade,
-
-  key text not null,            -- stable programmatic key: "asset_tag"
-  name text not null,           -- display name: "Asset Tag"
-  description text,
-
-  field_type text not null,     -- 'text','textarea','number','bool','date','datetime',
-                                -- 'select','multiselect','user','group' (future)
-
-  is_archived boolean not null default false,
-
-  created_at timestamptz not null default now(),
-
-  unique (tenant_id, key)
-);
-
-
-create index if not exists custom_fields_tenant_idx
-  on custom_fields (tenant_id);
-
-
-create table if not exists custom_field_options (
-  id uuid primary key default gen_random_uuid(),
-  tenant_id uuid not null references tenants(id) on delete cascade,
-  field_id uuid not null references custom_fields(id) on delete cascade,
-
-  value text not null,       -- stable value stored in ticket
-  label text not null,       -- display label
-  sort_order int not null default 0,
-  is_archived boolean not null default false,
-
-  unique (field_id, value)
-);
-
-create index on custom_field_options (tenant_id, field_id);
-
 create table if not exists ticket_field_values (
   tenant_id uuid not null references tenants(id) on delete cascade,
   ticket_id uuid not null references tickets(id) on delete cascade,
@@ -273,9 +274,3 @@ create table if not exists tenant_domains (
 
 create index if not exists tenant_domains_tenant_idx
   on tenant_domains (tenant_id);
-
-create table if not exists schema_migrations (
-  version integer primary key,
-  name text not null,
-  applied_at timestamptz not null default now() 
-);
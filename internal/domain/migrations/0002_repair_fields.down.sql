@@ -0,0 +1,15 @@
+drop index if exists tickets_tenant_customer_phone_idx;
+drop index if exists tickets_tenant_due_date_idx;
+
+alter table tickets
+  drop column if exists due_date,
+  drop column if exists estimated_cost,
+  drop column if exists internal_notes,
+  drop column if exists serial_number,
+  drop column if exists item_model,
+  drop column if exists item_brand,
+  drop column if exists item_type,
+  drop column if exists customer_email,
+  drop column if exists customer_phone,
+  drop column if exists customer_name,
+  drop column if exists external_tag;
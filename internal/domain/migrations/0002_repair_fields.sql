@@ -0,0 +1,22 @@
+-- Repair-shop details every ticket carries are first-class columns so they
+-- can be searched, indexed and validated; anything tenant specific belongs
+-- in custom_fields / ticket_field_values instead.
+alter table tickets
+  add column if not exists external_tag text,
+  add column if not exists customer_name text not null default '',
+  add column if not exists customer_phone text not null default '',
+  add column if not exists customer_email citext not null default '',
+  add column if not exists item_type text not null default '',
+  add column if not exists item_brand text not null default '',
+  add column if not exists item_model text not null default '',
+  add column if not exists serial_number text not null default '',
+  add column if not exists internal_notes text not null default '',
+  add column if not exists estimated_cost numeric(12, 2) not null default 0,
+  add column if not exists due_date date;
+
+create index if not exists tickets_tenant_due_date_idx
+  on tickets (tenant_id, due_date)
+  where closed_at is null;
+
+create index if not exists tickets_tenant_customer_phone_idx
+  on tickets (tenant_id, customer_phone);
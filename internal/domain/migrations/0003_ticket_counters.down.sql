@@ -0,0 +1 @@
+drop table if exists project_ticket_counters;
@@ -0,0 +1,15 @@
+-- One counter row per project hands out sequential ticket numbers. The row is
+-- locked by the allocating upsert until the ticket insert commits, so
+-- concurrent creates in the same project queue up instead of colliding.
+create table if not exists project_ticket_counters (
+  project_id uuid primary key references projects(id) on delete cascade,
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  last_number bigint not null default 0
+);
+
+insert into project_ticket_counters (project_id, tenant_id, last_number)
+select p.id, p.tenant_id, coalesce(max(t.ticket_number), 0)
+from projects p
+left join tickets t on t.project_id = p.id
+group by p.id, p.tenant_id
+on conflict (project_id) do nothing;
@@ -0,0 +1,2 @@
+alter table tickets
+  drop column if exists item_details;
@@ -0,0 +1,3 @@
+-- Free-text description of the item when item_type is 'other'
+alter table tickets
+  add column if not exists item_details text not null default '';
@@ -0,0 +1,31 @@
+-- Each project owns its status workflow as a list of allowed from -> to
+-- moves. Projects without rows fall back to models.DefaultStatusTransitions.
+create table if not exists project_status_transitions (
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  project_id uuid not null references projects(id) on delete cascade,
+  from_status text not null,
+  to_status text not null,
+  primary key (project_id, from_status, to_status),
+  check (from_status <> to_status)
+);
+
+create index if not exists project_status_transitions_tenant_idx
+  on project_status_transitions (tenant_id);
+
+insert into project_status_transitions (tenant_id, project_id, from_status, to_status)
+select p.tenant_id, p.id, d.from_status, d.to_status
+from projects p
+cross join (values
+  ('new', 'in_progress'),
+  ('in_progress', 'waiting_parts'),
+  ('in_progress', 'ready'),
+  ('waiting_parts', 'in_progress'),
+  ('ready', 'in_progress'),
+  ('ready', 'completed'),
+  ('completed', 'in_progress')
+) as d (from_status, to_status)
+on conflict do nothing;
+
+-- Tickets closed before closed_at was maintained by the service
+update tickets set closed_at = updated_at
+where status = 'completed' and closed_at is null;
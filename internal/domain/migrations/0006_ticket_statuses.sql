@@ -0,0 +1,33 @@
+-- Statuses are defined per tenant, optionally overridden per project. The
+-- category drives behaviour: open and waiting tickets count as active, done
+-- tickets are closed. colour names a badge palette entry, see models.StatusColours.
+create table if not exists ticket_statuses (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  project_id uuid references projects(id) on delete cascade, -- null = every project
+  key text not null,
+  label text not null,
+  colour text not null default 'gray',
+  category text not null check (category in ('open', 'waiting', 'done')),
+  sort_order int not null default 0,
+  is_archived boolean not null default false,
+  created_at timestamptz not null default now()
+);
+
+create unique index if not exists ticket_statuses_scope_key_idx
+  on ticket_statuses (tenant_id, coalesce(project_id, '00000000-0000-0000-0000-000000000000'::uuid), key);
+
+create index if not exists ticket_statuses_tenant_idx
+  on ticket_statuses (tenant_id, sort_order);
+
+insert into ticket_statuses (tenant_id, key, label, colour, category, sort_order)
+select t.id, d.key, d.label, d.colour, d.category, d.sort_order
+from tenants t
+cross join (values
+  ('new', 'New', 'blue', 'open', 10),
+  ('in_progress', 'In Progress', 'yellow', 'open', 20),
+  ('waiting_parts', 'Waiting for Parts', 'orange', 'waiting', 30),
+  ('ready', 'Ready for Pickup', 'green', 'waiting', 40),
+  ('completed', 'Completed', 'gray', 'done', 50)
+) as d (key, label, colour, category, sort_order)
+on conflict do nothing;
@@ -0,0 +1,16 @@
+-- Parts and materials used on a ticket. unit_cost is per item; the line total
+-- is quantity * unit_cost and the ticket total is derived, never stored.
+create table if not exists ticket_parts (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  ticket_id uuid not null references tickets(id) on delete cascade,
+  name text not null,
+  quantity int not null default 1 check (quantity > 0),
+  unit_cost numeric(12,2) not null default 0 check (unit_cost >= 0),
+  added_by_user_id uuid references users(id),
+  created_at timestamptz not null default now(),
+  updated_at timestamptz not null default now()
+);
+
+create index if not exists ticket_parts_ticket_idx
+  on ticket_parts (tenant_id, ticket_id, created_at);
@@ -0,0 +1,22 @@
+do $$
+declare
+  t text;
+begin
+  foreach t in array array[
+    'tenant_memberships', 'roles', 'membership_roles',
+    'projects', 'project_memberships', 'project_ticket_counters',
+    'project_status_transitions', 'request_types', 'request_type_fields',
+    'custom_fields', 'custom_field_options',
+    'tickets', 'ticket_field_values', 'ticket_comments', 'ticket_events',
+    'ticket_statuses', 'ticket_parts',
+    'tenant_settings', 'integrations', 'project_portal_settings', 'role_permissions'
+  ] loop
+    execute format('drop policy if exists tenant_isolation on %I', t);
+    execute format('alter table %I no force row level security', t);
+    execute format('alter table %I disable row level security', t);
+  end loop;
+end
+$$;
+
+drop function if exists app_bypass_rls();
+drop function if exists app_current_tenant();
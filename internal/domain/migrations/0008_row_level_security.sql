@@ -0,0 +1,64 @@
+-- Row-level security: every tenant-owned table only exposes the rows of the
+-- tenant named by app.tenant_id, which the app sets with set_config(..., true)
+-- at the start of each request transaction. With no tenant set nothing is
+-- visible. The migration runner sets app.bypass_rls for its own transactions.
+--
+-- Policies are forced so they also apply to the table owner, but superusers
+-- and roles with bypassrls skip them: the app must connect as a plain role.
+create or replace function app_current_tenant() returns uuid
+  language sql stable
+  as $$ select nullif(current_setting('app.tenant_id', true), '')::uuid $$;
+
+create or replace function app_bypass_rls() returns boolean
+  language sql stable
+  as $$ select coalesce(current_setting('app.bypass_rls', true), '') = 'on' $$;
+
+do $$
+declare
+  t text;
+begin
+  foreach t in array array[
+    'tenant_memberships', 'roles', 'membership_roles',
+    'projects', 'project_memberships', 'project_ticket_counters',
+    'project_status_transitions', 'request_types', 'request_type_fields',
+    'custom_fields', 'custom_field_options',
+    'tickets', 'ticket_field_values', 'ticket_comments', 'ticket_events',
+    'ticket_statuses', 'ticket_parts',
+    'tenant_settings', 'integrations'
+  ] loop
+    execute format('alter table %I enable row level security', t);
+    execute format('alter table %I force row level security', t);
+    execute format('drop policy if exists tenant_isolation on %I', t);
+    execute format(
+      'create policy tenant_isolation on %I
+         using (app_bypass_rls() or tenant_id = app_current_tenant())
+         with check (app_bypass_rls() or tenant_id = app_current_tenant())',
+      t
+    );
+  end loop;
+end
+$$;
+
+-- project_portal_settings has no tenant_id of its own; it follows its project
+alter table project_portal_settings enable row level security;
+alter table project_portal_settings force row level security;
+drop policy if exists tenant_isolation on project_portal_settings;
+create policy tenant_isolation on project_portal_settings
+  using (app_bypass_rls() or exists (
+    select 1 from projects p where p.id = project_id and p.tenant_id = app_current_tenant()
+  ))
+  with check (app_bypass_rls() or exists (
+    select 1 from projects p where p.id = project_id and p.tenant_id = app_current_tenant()
+  ));
+
+-- role_permissions likewise follows its role
+alter table role_permissions enable row level security;
+alter table role_permissions force row level security;
+drop policy if exists tenant_isolation on role_permissions;
+create policy tenant_isolation on role_permissions
+  using (app_bypass_rls() or exists (
+    select 1 from roles r where r.id = role_id and r.tenant_id = app_current_tenant()
+  ))
+  with check (app_bypass_rls() or exists (
+    select 1 from roles r where r.id = role_id and r.tenant_id = app_current_tenant()
+  ));
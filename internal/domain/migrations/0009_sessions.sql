@@ -0,0 +1,19 @@
+-- Server-side sessions for email/password sign-in. id is the SHA-256 of the
+-- random cookie token; the token itself is never stored.
+--
+-- Sessions are looked up before the user is known and a password reset must
+-- end them in every tenant, so the table is not under row-level security.
+-- Queries always filter on tenant_id instead.
+create table if not exists sessions (
+  id text primary key,
+  user_id uuid not null references users(id) on delete cascade,
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  user_agent text not null default '',
+  ip_address text not null default '',
+  created_at timestamptz not null default now(),
+  last_seen_at timestamptz not null default now(),
+  expires_at timestamptz not null
+);
+
+create index if not exists sessions_user_idx on sessions (user_id);
+create index if not exists sessions_expires_idx on sessions (expires_at);
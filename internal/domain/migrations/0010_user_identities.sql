@@ -0,0 +1,12 @@
+-- Accounts at external identity providers (OIDC issuer + subject) linked to a
+-- user. Like users, identities are global rather than per tenant.
+create table if not exists user_identities (
+  user_id uuid not null references users(id) on delete cascade,
+  issuer text not null,
+  subject text not null,
+  email citext not null,
+  created_at timestamptz not null default now(),
+  primary key (issuer, subject)
+);
+
+create index if not exists user_identities_user_idx on user_identities (user_id);
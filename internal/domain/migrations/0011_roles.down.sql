@@ -0,0 +1,9 @@
+drop trigger if exists tenants_seed_roles on tenants;
+drop function if exists seed_tenant_roles_trigger();
+drop function if exists seed_tenant_roles(uuid);
+
+delete from roles where is_system;
+delete from permissions where key in (
+  'ticket.read', 'ticket.create', 'ticket.write', 'ticket.status',
+  'project.admin', 'member.manage', 'tenant.admin'
+);
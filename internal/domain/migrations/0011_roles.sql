@@ -0,0 +1,75 @@
+-- The permission catalogue and the system roles every tenant starts with.
+-- Permission keys are checked in code (models.Permission); roles are data, so
+-- tenants may add their own.
+insert into permissions (key, description) values
+  ('ticket.read', 'View tickets, their notes, parts and history'),
+  ('ticket.create', 'Open new tickets'),
+  ('ticket.write', 'Edit tickets and add parts and notes'),
+  ('ticket.status', 'Move tickets through the workflow'),
+  ('project.admin', 'Manage projects, statuses and workflows'),
+  ('member.manage', 'Invite staff and change their roles'),
+  ('tenant.admin', 'Manage shop settings and integrations')
+on conflict (key) do update set description = excluded.description;
+
+-- seed_tenant_roles creates the system roles for a tenant. It scopes itself to
+-- that tenant for the row-level security policies and restores the caller's
+-- tenant afterwards, so it is safe to call from a trigger.
+create or replace function seed_tenant_roles(tenant uuid) returns void
+  language plpgsql
+  as $$
+declare
+  previous text := current_setting('app.tenant_id', true);
+begin
+  perform set_config('app.tenant_id', tenant::text, true);
+
+  insert into roles (tenant_id, name, is_system) values
+    (tenant, 'Owner', true),
+    (tenant, 'Technician', true),
+    (tenant, 'Front Desk', true),
+    (tenant, 'Viewer', true)
+  on conflict (tenant_id, name) do nothing;
+
+  insert into role_permissions (role_id, permission_key)
+  select r.id, p.key
+  from roles r
+  join (values
+    ('Owner', 'ticket.read'), ('Owner', 'ticket.create'), ('Owner', 'ticket.write'),
+    ('Owner', 'ticket.status'), ('Owner', 'project.admin'), ('Owner', 'member.manage'),
+    ('Owner', 'tenant.admin'),
+    ('Technician', 'ticket.read'), ('Technician', 'ticket.write'), ('Technician', 'ticket.status'),
+    ('Front Desk', 'ticket.read'), ('Front Desk', 'ticket.create'), ('Front Desk', 'ticket.write'),
+    ('Front Desk', 'ticket.status'),
+    ('Viewer', 'ticket.read')
+  ) as p(role, key) on p.role = r.name
+  where r.tenant_id = tenant and r.is_system
+  on conflict do nothing;
+
+  perform set_config('app.tenant_id', coalesce(previous, ''), true);
+end
+$$;
+
+create or replace function seed_tenant_roles_trigger() returns trigger
+  language plpgsql
+  as $$
+begin
+  perform seed_tenant_roles(new.id);
+  return new;
+end
+$$;
+
+drop trigger if exists tenants_seed_roles on tenants;
+create trigger tenants_seed_roles
+  after insert on tenants
+  for each row execute function seed_tenant_roles_trigger();
+
+select seed_tenant_roles(id) from tenants;
+
+-- Existing members had full access before roles were enforced; keep it that way
+insert into membership_roles (tenant_id, user_id, role_id)
+select m.tenant_id, m.user_id, r.id
+from tenant_memberships m
+join roles r on r.tenant_id = m.tenant_id and r.name = 'Owner'
+where not exists (
+  select 1 from membership_roles mr
+  where mr.tenant_id = m.tenant_id and mr.user_id = m.user_id
+);
@@ -0,0 +1,4 @@
+-- Nothing to undo: the memberships added by the up migration cannot be told
+-- apart from ones added since, and removing them all would lock users out of
+-- their projects.
+select 1;
@@ -0,0 +1,10 @@
+-- Ticket lists are now limited to the projects a user belongs to. Every
+-- member saw every project before, so add each member of a tenant to each of
+-- its projects that is not archived, whatever their role.
+-- The down migration does nothing: these rows cannot be told apart from ones
+-- added since.
+insert into project_memberships (tenant_id, project_id, user_id)
+select m.tenant_id, p.id, m.user_id
+from tenant_memberships m
+join projects p on p.tenant_id = m.tenant_id and not p.is_archived
+on conflict do nothing;
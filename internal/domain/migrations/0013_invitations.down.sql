@@ -0,0 +1,2 @@
+delete from tenant_memberships where status = 'invited';
+drop table if exists invitations;
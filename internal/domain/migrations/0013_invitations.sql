@@ -0,0 +1,24 @@
+-- Invitations to join a tenant. The invitee's user row and an 'invited'
+-- membership are created up front; accepting the link activates the
+-- membership. token_hash is the SHA-256 of the emailed token.
+create table if not exists invitations (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  user_id uuid not null references users(id) on delete cascade,
+  role_id uuid references roles(id) on delete set null,
+  token_hash text not null unique,
+  invited_by_user_id uuid references users(id) on delete set null,
+  created_at timestamptz not null default now(),
+  expires_at timestamptz not null,
+  accepted_at timestamptz,
+  revoked_at timestamptz
+);
+
+create index if not exists invitations_tenant_user_idx on invitations (tenant_id, user_id);
+
+alter table invitations enable row level security;
+alter table invitations force row level security;
+drop policy if exists tenant_isolation on invitations;
+create policy tenant_isolation on invitations
+  using (app_bypass_rls() or tenant_id = app_current_tenant())
+  with check (app_bypass_rls() or tenant_id = app_current_tenant());
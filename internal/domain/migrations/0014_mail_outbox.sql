@@ -0,0 +1,30 @@
+-- Outgoing email. Messages are queued here in the request's transaction and
+-- delivered by a background worker, which retries failures with backoff.
+-- from_name and from_email are copied from tenant_settings when queued; the
+-- worker falls back to MAIL_FROM when they are empty.
+create table if not exists mail_outbox (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  from_name text,
+  from_email citext,
+  to_address citext not null,
+  subject text not null,
+  text_body text not null,
+  html_body text,
+  status text not null default 'pending', -- 'pending', 'sent', 'failed'
+  attempts int not null default 0,
+  last_error text,
+  next_attempt_at timestamptz not null default now(),
+  created_at timestamptz not null default now(),
+  sent_at timestamptz
+);
+
+create index if not exists mail_outbox_pending_idx
+  on mail_outbox (next_attempt_at) where status = 'pending';
+
+alter table mail_outbox enable row level security;
+alter table mail_outbox force row level security;
+drop policy if exists tenant_isolation on mail_outbox;
+create policy tenant_isolation on mail_outbox
+  using (app_bypass_rls() or tenant_id = app_current_tenant())
+  with check (app_bypass_rls() or tenant_id = app_current_tenant());
@@ -0,0 +1,3 @@
+drop table if exists notification_opt_outs;
+drop table if exists notification_templates;
+alter table ticket_statuses drop column if exists notify_customer;
@@ -0,0 +1,45 @@
+-- Customers are told when their ticket enters a status flagged with
+-- notify_customer; Ready for Pickup is flagged by default. Tenants can word
+-- the message per status and channel in notification_templates, otherwise
+-- built-in wording is used. Addresses in notification_opt_outs never get
+-- these messages.
+alter table ticket_statuses add column if not exists notify_customer boolean not null default false;
+update ticket_statuses set notify_customer = true where key = 'ready';
+
+create table if not exists notification_templates (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  status_key text not null,
+  channel text not null check (channel in ('email', 'sms')),
+  subject text not null default '', -- unused for sms
+  body text not null,
+  updated_at timestamptz not null default now(),
+  unique (tenant_id, status_key, channel)
+);
+
+-- address is a lowercased email for the email channel and an E.164 number for sms
+create table if not exists notification_opt_outs (
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  channel text not null check (channel in ('email', 'sms')),
+  address citext not null,
+  created_at timestamptz not null default now(),
+  primary key (tenant_id, channel, address)
+);
+
+do $$
+declare
+  t text;
+begin
+  foreach t in array array['notification_templates', 'notification_opt_outs'] loop
+    execute format('alter table %I enable row level security', t);
+    execute format('alter table %I force row level security', t);
+    execute format('drop policy if exists tenant_isolation on %I', t);
+    execute format(
+      'create policy tenant_isolation on %I
+         using (app_bypass_rls() or tenant_id = app_current_tenant())
+         with check (app_bypass_rls() or tenant_id = app_current_tenant())',
+      t
+    );
+  end loop;
+end
+$$;
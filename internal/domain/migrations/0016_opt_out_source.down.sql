@@ -0,0 +1 @@
+alter table notification_opt_outs drop column if exists source;
@@ -0,0 +1,5 @@
+-- Records who stopped the messages. Customers opt out by texting STOP and
+-- only they can opt back in; staff can only lift pauses made by staff.
+alter table notification_opt_outs
+  add column if not exists source text not null default 'staff'
+  check (source in ('staff', 'customer'));
@@ -0,0 +1,2 @@
+alter table tickets drop column if exists customer_id;
+drop table if exists customers;
@@ -0,0 +1,58 @@
+-- Customers are kept once per tenant and tickets point at them. Contact
+-- details are still copied onto each ticket as they were at the time.
+-- phone_key is the phone number's digits, so "(541) 555-0123" and
+-- "541.555.0123" are the same customer; email is matched case-insensitively.
+create table if not exists customers (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  name text not null,
+  phone text not null default '',
+  phone_key text,
+  email citext,
+  created_at timestamptz not null default now(),
+  updated_at timestamptz not null default now()
+);
+
+create unique index if not exists customers_tenant_phone_key on customers (tenant_id, phone_key) where phone_key is not null;
+create unique index if not exists customers_tenant_email_key on customers (tenant_id, email) where email is not null;
+
+alter table tickets add column if not exists customer_id uuid references customers(id) on delete set null;
+create index if not exists tickets_customer_idx on tickets (customer_id);
+
+alter table customers enable row level security;
+alter table customers force row level security;
+drop policy if exists tenant_isolation on customers;
+create policy tenant_isolation on customers
+  using (app_bypass_rls() or tenant_id = app_current_tenant())
+  with check (app_bypass_rls() or tenant_id = app_current_tenant());
+
+-- One customer per phone number from existing tickets, named as on the
+-- latest one. An email already taken by another number is left off.
+insert into customers (tenant_id, name, phone, phone_key, email, created_at)
+select distinct on (t.tenant_id, regexp_replace(t.customer_phone, '[^0-9]', '', 'g'))
+  t.tenant_id, t.customer_name, t.customer_phone,
+  regexp_replace(t.customer_phone, '[^0-9]', '', 'g'),
+  nullif(t.customer_email, ''), t.created_at
+from tickets t
+where regexp_replace(t.customer_phone, '[^0-9]', '', 'g') <> ''
+order by t.tenant_id, regexp_replace(t.customer_phone, '[^0-9]', '', 'g'), t.created_at desc
+on conflict do nothing;
+
+insert into customers (tenant_id, name, phone, phone_key, email, created_at)
+select distinct on (t.tenant_id, t.customer_email)
+  t.tenant_id, t.customer_name, t.customer_phone,
+  nullif(regexp_replace(t.customer_phone, '[^0-9]', '', 'g'), ''),
+  t.customer_email, t.created_at
+from tickets t
+where t.customer_email <> ''
+order by t.tenant_id, t.customer_email, t.created_at desc
+on conflict do nothing;
+
+update tickets t set customer_id = (
+  select c.id from customers c
+  where c.tenant_id = t.tenant_id
+    and (c.phone_key = regexp_replace(t.customer_phone, '[^0-9]', '', 'g') or c.email = nullif(t.customer_email, ''))
+  order by c.phone_key = regexp_replace(t.customer_phone, '[^0-9]', '', 'g') desc nulls last
+  limit 1
+)
+where t.customer_id is null;
@@ -0,0 +1,2 @@
+drop table if exists customer_merges;
+drop index if exists customers_name_trgm_idx;
@@ -0,0 +1,28 @@
+-- Duplicate customers are found by phone, email and name similarity and
+-- merged by an admin. customer_merges keeps what the merged customer looked
+-- like and which tickets moved, since the row itself is deleted.
+create extension if not exists pg_trgm;
+
+create index if not exists customers_name_trgm_idx on customers using gin (name gin_trgm_ops);
+
+create table if not exists customer_merges (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  kept_customer_id uuid references customers(id) on delete set null,
+  merged_customer_id uuid not null,
+  merged_name text not null,
+  merged_phone text not null,
+  merged_email citext,
+  ticket_ids uuid[] not null default '{}',
+  merged_by_user_id uuid references users(id) on delete set null,
+  created_at timestamptz not null default now()
+);
+
+create index if not exists customer_merges_tenant_idx on customer_merges (tenant_id, created_at);
+
+alter table customer_merges enable row level security;
+alter table customer_merges force row level security;
+drop policy if exists tenant_isolation on customer_merges;
+create policy tenant_isolation on customer_merges
+  using (app_bypass_rls() or tenant_id = app_current_tenant())
+  with check (app_bypass_rls() or tenant_id = app_current_tenant());
@@ -0,0 +1 @@
+drop table if exists sms_outbox;
@@ -0,0 +1,26 @@
+-- Outgoing text messages, queued in the request's transaction like
+-- mail_outbox and delivered by a background worker through the tenant's sms
+-- integration, which retries failures with backoff. The integration's
+-- settings are read when each text is sent, so they are not copied here.
+create table if not exists sms_outbox (
+  id uuid primary key default gen_random_uuid(),
+  tenant_id uuid not null references tenants(id) on delete cascade,
+  to_address text not null, -- E.164
+  body text not null,
+  status text not null default 'pending', -- 'pending', 'sent', 'failed'
+  attempts int not null default 0,
+  last_error text,
+  next_attempt_at timestamptz not null default now(),
+  created_at timestamptz not null default now(),
+  sent_at timestamptz
+);
+
+create index if not exists sms_outbox_pending_idx
+  on sms_outbox (next_attempt_at) where status = 'pending';
+
+alter table sms_outbox enable row level security;
+alter table sms_outbox force row level security;
+drop policy if exists tenant_isolation on sms_outbox;
+create policy tenant_isolation on sms_outbox
+  using (app_bypass_rls() or tenant_id = app_current_tenant())
+  with check (app_bypass_rls() or tenant_id = app_current_tenant());
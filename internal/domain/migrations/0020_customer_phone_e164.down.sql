@@ -0,0 +1,6 @@
+update customers c set phone_key = regexp_replace(c.phone, '[^0-9]', '', 'g')
+where c.phone_key like '+%'
+  and not exists (
+    select 1 from customers o
+    where o.tenant_id = c.tenant_id and o.phone_key = regexp_replace(c.phone, '[^0-9]', '', 'g')
+  );
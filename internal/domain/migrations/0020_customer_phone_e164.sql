@@ -0,0 +1,40 @@
+-- Customers are now matched on the E.164 form of their numbers, as texts are
+-- sent to, taking the sms integration's default country code for numbers
+-- entered without one. This re-keys existing customers the way
+-- sms.NormalizePhone does; numbers with no E.164 form keep their digits.
+-- When two customers now have the same number the oldest takes the key and
+-- the others keep their digits, for the duplicates list to pair them up.
+with numbers as (
+  select c.id, c.tenant_id, c.created_at,
+    btrim(c.phone) like '+%' as international,
+    btrim(c.phone) ~ '^[-0-9+ ()./]*$' as valid,
+    regexp_replace(c.phone, '[^0-9]', '', 'g') as digits,
+    coalesce((
+      select i.config->>'default_country_code' from integrations i
+      where i.tenant_id = c.tenant_id and i.integration_type = 'sms'
+      order by i.created_at
+      limit 1
+    ), '') as country_code
+  from customers c
+  where c.phone_key is not null
+),
+keyed as (
+  select id, tenant_id, created_at, valid,
+    case
+      when international then digits
+      when digits like '00%' then substr(digits, 3)
+      when country_code = '' then null
+      when country_code = '1' and length(digits) = 11 and digits like '1%' then digits
+      else country_code || regexp_replace(digits, '^0', '')
+    end as number
+  from numbers
+),
+e164 as (
+  select id, '+' || number as phone_key,
+    row_number() over (partition by tenant_id, number order by created_at) as rank
+  from keyed
+  where valid and length(number) between 8 and 15 and number not like '0%'
+)
+update customers c set phone_key = e.phone_key
+from e164 e
+where c.id = e.id and e.rank = 1;
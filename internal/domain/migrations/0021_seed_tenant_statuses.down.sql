@@ -0,0 +1,3 @@
+drop trigger if exists tenants_seed_statuses on tenants;
+drop function if exists seed_tenant_statuses_trigger();
+drop function if exists seed_tenant_statuses(uuid);
@@ -0,0 +1,42 @@
+-- 0006 seeded the default statuses only for the tenants that existed then.
+-- seed_tenant_statuses gives a tenant those defaults, scoping itself to the
+-- tenant like seed_tenant_roles, and a trigger runs it for every new tenant.
+-- Tenants can then add, rename and reorder their statuses.
+create or replace function seed_tenant_statuses(tenant uuid) returns void
+  language plpgsql
+  as $$
+declare
+  previous text := current_setting('app.tenant_id', true);
+begin
+  perform set_config('app.tenant_id', tenant::text, true);
+
+  insert into ticket_statuses (tenant_id, key, label, colour, category, sort_order, notify_customer) values
+    (tenant, 'new', 'New', 'blue', 'open', 10, false),
+    (tenant, 'in_progress', 'In Progress', 'yellow', 'open', 20, false),
+    (tenant, 'waiting_parts', 'Waiting for Parts', 'orange', 'waiting', 30, false),
+    (tenant, 'ready', 'Ready for Pickup', 'green', 'waiting', 40, true),
+    (tenant, 'completed', 'Completed', 'gray', 'done', 50, false)
+  on conflict do nothing;
+
+  perform set_config('app.tenant_id', coalesce(previous, ''), true);
+end
+$$;
+
+create or replace function seed_tenant_statuses_trigger() returns trigger
+  language plpgsql
+  as $$
+begin
+  perform seed_tenant_statuses(new.id);
+  return new;
+end
+$$;
+
+drop trigger if exists tenants_seed_statuses on tenants;
+create trigger tenants_seed_statuses
+  after insert on tenants
+  for each row execute function seed_tenant_statuses_trigger();
+
+-- Tenants created since 0006 have no statuses at all
+select seed_tenant_statuses(t.id)
+from tenants t
+where not exists (select 1 from ticket_statuses s where s.tenant_id = t.id);
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+var _ ports.NotificationRepository = (*DB)(nil)
+
+const notificationTemplateColumns = `id, tenant_id, status_key, channel, subject, body, updated_at`
+
+func (db *DB) GetNotificationTemplate(ctx context.Context, tenantID string, status models.Status, channel models.NotificationChannel) (models.NotificationTemplate, error) {
+	query := `
+	select ` + notificationTemplateColumns + `
+	from notification_templates
+	where tenant_id = $1 and status_key = $2 and channel = $3`
+
+	var template models.NotificationTemplate
+	if err := db.GetContext(ctx, &template, query, tenantID, status, channel); err != nil {
+		if isNotFound(err) {
+			return models.NotificationTemplate{}, ports.ErrNotFound
+		}
+		return models.NotificationTemplate{}, fmt.Errorf("failed to get %s template for %s: %w", channel, status, err)
+	}
+	return template, nil
+}
+
+func (db *DB) ListNotificationTemplates(ctx context.Context, tenantID string) ([]models.NotificationTemplate, error) {
+	query := `
+	select ` + notificationTemplateColumns + `
+	from notification_templates
+	where tenant_id = $1
+	order by status_key, channel`
+
+	templates := make([]models.NotificationTemplate, 0)
+	if err := db.SelectContext(ctx, &templates, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list notification templates: %w", err)
+	}
+	return templates, nil
+}
+
+// SaveNotificationTemplate creates or replaces the tenant's template for the
+// status and channel
+func (db *DB) SaveNotificationTemplate(ctx context.Context, template *models.NotificationTemplate) error {
+	query := `
+	insert into notification_templates (tenant_id, status_key, channel, subject, body)
+	values ($1, $2, $3, $4, $5)
+	on conflict (tenant_id, status_key, channel)
+	do update set subject = excluded.subject, body = excluded.body, updated_at = now()
+	returning id, updated_at`
+
+	err := db.GetContext(ctx, template, query,
+		template.TenantID, template.StatusKey, template.Channel, template.Subject, template.Body,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save %s template for %s: %w", template.Channel, template.StatusKey, err)
+	}
+	return nil
+}
+
+// SetStatusNotify flags whether customers are notified when their ticket
+// enters the tenant-wide status and any project overrides of it
+func (db *DB) SetStatusNotify(ctx context.Context, tenantID string, status models.Status, notify bool) error {
+	query := `
+	update ticket_statuses set notify_customer = $3
+	where tenant_id = $1 and key = $2`
+
+	result, err := db.ExecContext(ctx, query, tenantID, status, notify)
+	if err != nil {
+		return fmt.Errorf("failed to update status %s: %w", status, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+// GetOptOut returns the opt-out stopping messages on the channel to the
+// address, or ports.ErrNotFound when they are allowed
+func (db *DB) GetOptOut(ctx context.Context, tenantID string, channel models.NotificationChannel, address string) (models.OptOut, error) {
+	query := `
+	select tenant_id, channel, address, source, created_at
+	from notification_opt_outs
+	where tenant_id = $1 and channel = $2 and address = $3`
+
+	var optOut models.OptOut
+	if err := db.GetContext(ctx, &optOut, query, tenantID, channel, address); err != nil {
+		if isNotFound(err) {
+			return models.OptOut{}, ports.ErrNotFound
+		}
+		return models.OptOut{}, fmt.Errorf("failed to get %s opt-out: %w", channel, err)
+	}
+	return optOut, nil
+}
+
+// SetOptOut adds the address to, or removes it from, the channel's opt-outs.
+// Staff cannot remove an opt-out the customer asked for.
+func (db *DB) SetOptOut(ctx context.Context, tenantID string, channel models.NotificationChannel, address string, optOut bool, source models.OptOutSource) error {
+	query := `
+	delete from notification_opt_outs
+	where tenant_id = $1 and channel = $2 and address = $3
+		and ($4 = 'customer' or source = 'staff')`
+	if optOut {
+		// a customer's own opt-out replaces a staff pause, never the reverse
+		query = `
+		insert into notification_opt_outs (tenant_id, channel, address, source)
+		values ($1, $2, $3, $4)
+		on conflict (tenant_id, channel, address)
+		do update set source = excluded.source
+		where excluded.source = 'customer'`
+	}
+
+	if _, err := db.ExecContext(ctx, query, tenantID, channel, address, source); err != nil {
+		return fmt.Errorf("failed to update %s opt-out: %w", channel, err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+
+	"flexsupport/internal/models"
+)
+
+// The notification switch on /admin/notifications works for a tenant created
+// after the statuses were first seeded
+func TestNewTenantStatusNotify(t *testing.T) {
+	db := testDB(t)
+	d := seedTenant(t, db, "delta")
+
+	for _, notify := range []bool{false, true} {
+		if err := db.SetStatusNotify(d.ctx, d.tenant.ID, models.StatusInProgress, notify); err != nil {
+			t.Fatalf("SetStatusNotify(%t) error = %v", notify, err)
+		}
+		statuses, err := db.ListStatuses(d.ctx, d.tenant.ID, "")
+		if err != nil {
+			t.Fatalf("ListStatuses() error = %v", err)
+		}
+		status, ok := models.FindStatus(statuses, models.StatusInProgress)
+		if !ok || status.NotifyCustomer != notify {
+			t.Errorf("in_progress after SetStatusNotify(%t) = %+v, found %t", notify, status, ok)
+		}
+	}
+}
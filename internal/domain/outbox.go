@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flexsupport/internal/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const outboxColumns = `id, tenant_id, from_name, from_email, to_address, subject, text_body, html_body,
+	status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+// EnqueueMail queues a message for delivery, sent from the tenant's outbound
+// address if it has one
+func (db *DB) EnqueueMail(ctx context.Context, mail *models.OutboxMail) error {
+	query := `
+	insert into mail_outbox (tenant_id, from_name, from_email, to_address, subject, text_body, html_body)
+	values (
+		$1,
+		(select outbound_from_name from tenant_settings where tenant_id = $1),
+		(select outbound_from_email from tenant_settings where tenant_id = $1),
+		$2, $3, $4, $5
+	)
+	returning ` + outboxColumns
+
+	err := db.GetContext(ctx, mail, query, mail.TenantID, mail.To, mail.Subject, mail.Text, mail.HTML)
+	if err != nil {
+		return fmt.Errorf("failed to queue mail: %w", err)
+	}
+	return nil
+}
+
+// ClaimMail returns up to limit pending messages that are due and pushes
+// their next attempt back by lease, so another worker does not pick them up
+// while they are being sent. A worker that dies mid-send leaves them to be
+// retried once the lease runs out.
+func (db *DB) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	query := `
+	update mail_outbox
+	set next_attempt_at = now() + $2 * interval '1 second', attempts = attempts + 1
+	where id in (
+		select id from mail_outbox
+		where status = 'pending' and next_attempt_at <= now()
+		order by next_attempt_at
+		limit $1
+		for update skip locked
+	)
+	returning ` + outboxColumns
+
+	var mails []models.OutboxMail
+	err := db.inBypassTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &mails, query, limit, lease.Seconds())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim mail: %w", err)
+	}
+	return mails, nil
+}
+
+func (db *DB) MarkMailSent(ctx context.Context, id string) error {
+	query := `
+	update mail_outbox
+	set status = 'sent', sent_at = now(), last_error = null
+	where id = $1`
+
+	err := db.inBypassTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark mail %s sent: %w", id, err)
+	}
+	return nil
+}
+
+// MarkMailFailed records a failed attempt. The message is retried at retryAt,
+// or given up on when it is nil.
+func (db *DB) MarkMailFailed(ctx context.Context, id, reason string, retryAt *time.Time) error {
+	query := `
+	update mail_outbox
+	set last_error = $2,
+		status = case when $3::timestamptz is null then 'failed' else 'pending' end,
+		next_attempt_at = coalesce($3, next_attempt_at)
+	where id = $1`
+
+	err := db.inBypassTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, id, reason, retryAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark mail %s failed: %w", id, err)
+	}
+	return nil
+}
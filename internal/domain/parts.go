@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const partColumns = `
+	tp.id, tp.tenant_id, tp.ticket_id, tp.name, tp.quantity, tp.unit_cost,
+	tp.added_by_user_id, coalesce(u.name, '') as added_by, tp.created_at, tp.updated_at`
+
+// partPayload is the ticket_events payload written for every parts change
+type partPayload struct {
+	PartID   string       `json:"part_id"`
+	Name     string       `json:"name"`
+	Quantity int          `json:"quantity"`
+	UnitCost float64      `json:"unit_cost"`
+	Previous *partPayload `json:"previous,omitempty"`
+}
+
+func newPartPayload(part models.Part) *partPayload {
+	return &partPayload{
+		PartID:   part.ID,
+		Name:     part.Name,
+		Quantity: part.Quantity,
+		UnitCost: part.Cost,
+	}
+}
+
+func (db *DB) ListParts(ctx context.Context, ticketID string) ([]models.Part, error) {
+	query := `
+	select ` + partColumns + `
+	from ticket_parts tp
+	left join users u on u.id = tp.added_by_user_id
+	where tp.ticket_id = $1
+	order by tp.created_at, tp.id`
+
+	parts := make([]models.Part, 0)
+	if err := db.SelectContext(ctx, &parts, query, ticketID); err != nil {
+		return nil, fmt.Errorf("failed to list parts for ticket %s: %w", ticketID, err)
+	}
+	return parts, nil
+}
+
+// AddPart inserts the part and records a part_added event in the same transaction
+func (db *DB) AddPart(ctx context.Context, part *models.Part) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+	insert into ticket_parts (tenant_id, ticket_id, name, quantity, unit_cost, added_by_user_id)
+	values ($1, $2, $3, $4, $5, $6)
+	returning id, created_at, updated_at`
+
+	row := tx.QueryRowxContext(ctx, query,
+		part.TenantID, part.TicketID, part.Name, part.Quantity, part.Cost, part.AddedByUserID,
+	)
+	if err := row.Scan(&part.ID, &part.AddedAt, &part.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to add part to ticket %s: %w", part.TicketID, err)
+	}
+
+	if err := addPartEvent(ctx, tx, *part, models.EventPartAdded, part.AddedByUserID, newPartPayload(*part)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePart saves the part's name, quantity and cost and records a
+// part_updated event holding the previous values
+func (db *DB) UpdatePart(ctx context.Context, part *models.Part, actorUserID *string) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	previous, err := getPartForUpdate(ctx, tx, part.TicketID, part.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	update ticket_parts set
+		name = $3,
+		quantity = $4,
+		unit_cost = $5,
+		updated_at = now()
+	where id = $1 and ticket_id = $2
+	returning tenant_id, created_at, updated_at`
+
+	row := tx.QueryRowxContext(ctx, query, part.ID, part.TicketID, part.Name, part.Quantity, part.Cost)
+	if err := row.Scan(&part.TenantID, &part.AddedAt, &part.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update part %s: %w", part.ID, err)
+	}
+
+	payload := newPartPayload(*part)
+	payload.Previous = newPartPayload(previous)
+	payload.Previous.PartID = ""
+	if err := addPartEvent(ctx, tx, *part, models.EventPartUpdated, actorUserID, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeletePart removes the part from the ticket and records a part_removed event
+func (db *DB) DeletePart(ctx context.Context, ticketID, partID string, actorUserID *string) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	part, err := getPartForUpdate(ctx, tx, ticketID, partID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "delete from ticket_parts where id = $1", partID); err != nil {
+		return fmt.Errorf("failed to delete part %s: %w", partID, err)
+	}
+
+	if err := addPartEvent(ctx, tx, part, models.EventPartRemoved, actorUserID, newPartPayload(part)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getPartForUpdate(ctx context.Context, tx *sqlx.Tx, ticketID, partID string) (models.Part, error) {
+	query := `
+	select tp.id, tp.tenant_id, tp.ticket_id, tp.name, tp.quantity, tp.unit_cost,
+		tp.added_by_user_id, '' as added_by, tp.created_at, tp.updated_at
+	from ticket_parts tp
+	where tp.id = $1 and tp.ticket_id = $2
+	for update`
+
+	var part models.Part
+	if err := tx.GetContext(ctx, &part, query, partID, ticketID); err != nil {
+		if isNotFound(err) {
+			return models.Part{}, ports.ErrNotFound
+		}
+		return models.Part{}, fmt.Errorf("failed to get part %s: %w", partID, err)
+	}
+	return part, nil
+}
+
+func addPartEvent(ctx context.Context, tx *sqlx.Tx, part models.Part, eventType models.EventType, actorUserID *string, payload *partPayload) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	return addEvent(ctx, tx, &models.TicketEvent{
+		TenantID:    part.TenantID,
+		TicketID:    part.TicketID,
+		ActorUserID: actorUserID,
+		Type:        eventType,
+		Payload:     raw,
+	})
+}
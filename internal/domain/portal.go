@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ ports.PortalRepository = (*DB)(nil)
+
+// GetPortalSettings returns the tenant's portal settings. Tenants without a
+// tenant_settings row get a disabled portal.
+func (db *DB) GetPortalSettings(ctx context.Context, tenantID string) (models.PortalSettings, error) {
+	settings := models.PortalSettings{TenantID: tenantID}
+	err := db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		select tenant_id, public_portal_enabled,
+			coalesce(portal_title, '') as portal_title,
+			coalesce(portal_welcome_text, '') as portal_welcome_text
+		from tenant_settings
+		where tenant_id = $1`
+		if err := tx.GetContext(ctx, &settings, query, tenantID); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to get portal settings: %w", err)
+		}
+
+		query = `
+		select p.id as project_id, p.key, p.name, coalesce(ps.enabled, false) as enabled
+		from projects p
+		left join project_portal_settings ps on ps.project_id = p.id
+		where p.tenant_id = $1 and not p.is_archived
+		order by p.name`
+		settings.Projects = make([]models.PortalProject, 0)
+		if err := tx.SelectContext(ctx, &settings.Projects, query, tenantID); err != nil {
+			return fmt.Errorf("failed to list portal projects: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.PortalSettings{}, err
+	}
+	return settings, nil
+}
+
+// SavePortalSettings stores the portal settings and the switch for every
+// project listed in settings.Projects
+func (db *DB) SavePortalSettings(ctx context.Context, settings *models.PortalSettings) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		insert into tenant_settings (tenant_id, public_portal_enabled, portal_title, portal_welcome_text)
+		values ($1, $2, nullif($3, ''), nullif($4, ''))
+		on conflict (tenant_id) do update set
+			public_portal_enabled = excluded.public_portal_enabled,
+			portal_title = excluded.portal_title,
+			portal_welcome_text = excluded.portal_welcome_text`
+		_, err := tx.ExecContext(ctx, query, settings.TenantID, settings.Enabled, settings.Title, settings.WelcomeText)
+		if err != nil {
+			return fmt.Errorf("failed to save portal settings: %w", err)
+		}
+
+		query = `
+		insert into project_portal_settings (project_id, enabled)
+		select p.id, $3
+		from projects p
+		where p.tenant_id = $1 and p.id = $2
+		on conflict (project_id) do update set enabled = excluded.enabled`
+		for _, project := range settings.Projects {
+			if _, err := tx.ExecContext(ctx, query, settings.TenantID, project.ProjectID, project.Enabled); err != nil {
+				return fmt.Errorf("failed to save portal setting for project %s: %w", project.ProjectID, err)
+			}
+		}
+		return nil
+	})
+}
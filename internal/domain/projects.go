@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const projectColumns = `
+	p.id, p.tenant_id, p.key, p.name, coalesce(p.description, '') as description,
+	p.is_archived, p.created_at,
+	(
+		select rt.id from request_types rt
+		where rt.project_id = p.id and not rt.is_archived
+		order by rt.sort_order, rt.name
+		limit 1
+	) as default_request_type_id`
+
+var _ ports.ProjectRepository = (*DB)(nil)
+
+func (db *DB) ListProjects(ctx context.Context, tenantID string) ([]models.Project, error) {
+	query := "select " + projectColumns + " from projects p where p.tenant_id = $1 and not p.is_archived order by p.name"
+
+	projects := make([]models.Project, 0)
+	if err := db.SelectContext(ctx, &projects, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	return projects, nil
+}
+
+func (db *DB) GetProject(ctx context.Context, tenantID, id string) (models.Project, error) {
+	var project models.Project
+	query := "select " + projectColumns + " from projects p where p.tenant_id = $1 and p.id = $2"
+	if err := db.GetContext(ctx, &project, query, tenantID, id); err != nil {
+		if isNotFound(err) {
+			return models.Project{}, ports.ErrNotFound
+		}
+		return models.Project{}, fmt.Errorf("failed to get project %s: %w", id, err)
+	}
+	return project, nil
+}
+
+// ListStatusTransitions returns the project's workflow. An empty result means
+// the project uses models.DefaultStatusTransitions.
+func (db *DB) ListStatusTransitions(ctx context.Context, projectID string) ([]models.StatusTransition, error) {
+	query := `
+	select project_id, from_status, to_status
+	from project_status_transitions
+	where project_id = $1
+	order by from_status, to_status`
+
+	transitions := make([]models.StatusTransition, 0)
+	if err := db.SelectContext(ctx, &transitions, query, projectID); err != nil {
+		return nil, fmt.Errorf("failed to list status transitions for project %s: %w", projectID, err)
+	}
+	return transitions, nil
+}
+
+// ListStatuses returns the statuses available in a project, with project rows
+// overriding tenant-wide rows of the same key, in sort order. An empty
+// projectID returns only the tenant-wide statuses.
+func (db *DB) ListStatuses(ctx context.Context, tenantID, projectID string) ([]models.TicketStatus, error) {
+	query := `
+	select * from (
+		select distinct on (s.key)
+			s.id, s.tenant_id, s.project_id, s.key, s.label, s.colour, s.category,
+			s.sort_order, s.is_archived, s.notify_customer
+		from ticket_statuses s
+		where s.tenant_id = $1
+			and (s.project_id is null or s.project_id = nullif($2, '')::uuid)
+		order by s.key, s.project_id nulls last
+	) s
+	where not s.is_archived
+	order by s.sort_order, s.label`
+
+	statuses := make([]models.TicketStatus, 0)
+	if err := db.SelectContext(ctx, &statuses, query, tenantID, projectID); err != nil {
+		return nil, fmt.Errorf("failed to list statuses: %w", err)
+	}
+	return statuses, nil
+}
+
+// CreateStatus adds a tenant-wide status at the end of the list. It fails with
+// ports.ErrConflict when the tenant already has a status with the key, even
+// an archived one.
+func (db *DB) CreateStatus(ctx context.Context, status *models.TicketStatus) error {
+	query := `
+	insert into ticket_statuses (tenant_id, key, label, colour, category, sort_order)
+	select $1, $2, $3, $4, $5, coalesce(max(sort_order), 0) + 10
+	from ticket_statuses
+	where tenant_id = $1
+	on conflict do nothing
+	returning id, sort_order`
+
+	err := db.GetContext(ctx, status, query,
+		status.TenantID, status.Key, status.Label, status.Colour, status.Category,
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return ports.ErrConflict
+		}
+		return fmt.Errorf("failed to create status %s: %w", status.Key, err)
+	}
+	return nil
+}
+
+// UpdateStatus saves a tenant-wide status's label and colour. The key stays,
+// as tickets and workflows refer to it.
+func (db *DB) UpdateStatus(ctx context.Context, status *models.TicketStatus) error {
+	query := `
+	update ticket_statuses set label = $3, colour = $4
+	where tenant_id = $1 and id = $2 and project_id is null`
+
+	result, err := db.ExecContext(ctx, query, status.TenantID, status.ID, status.Label, status.Colour)
+	if err != nil {
+		return fmt.Errorf("failed to update status %s: %w", status.ID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+// ReorderStatuses sorts the tenant-wide statuses in the order of ids
+func (db *DB) ReorderStatuses(ctx context.Context, tenantID string, ids []string) error {
+	query := `
+	update ticket_statuses set sort_order = $3
+	where tenant_id = $1 and id = $2 and project_id is null`
+
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		for i, id := range ids {
+			if _, err := tx.ExecContext(ctx, query, tenantID, id, (i+1)*10); err != nil {
+				return fmt.Errorf("failed to reorder status %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListUserProjects returns the active projects the user is a member of
+func (db *DB) ListUserProjects(ctx context.Context, tenantID, userID string) ([]models.Project, error) {
+	query := "select " + projectColumns + `
+	from projects p
+	join project_memberships pm on pm.project_id = p.id and pm.user_id = $2
+	where p.tenant_id = $1 and not p.is_archived
+	order by p.name`
+
+	projects := make([]models.Project, 0)
+	if err := db.SelectContext(ctx, &projects, query, tenantID, userID); err != nil {
+		return nil, fmt.Errorf("failed to list projects for user %s: %w", userID, err)
+	}
+	return projects, nil
+}
+
+func (db *DB) ListProjectMembers(ctx context.Context, tenantID, projectID string) ([]models.ProjectMember, error) {
+	query := `
+	select pm.project_id, pm.user_id, u.name, u.email, pm.created_at
+	from project_memberships pm
+	join users u on u.id = pm.user_id
+	where pm.tenant_id = $1 and pm.project_id = $2
+	order by u.name, u.email`
+
+	members := make([]models.ProjectMember, 0)
+	if err := db.SelectContext(ctx, &members, query, tenantID, projectID); err != nil {
+		return nil, fmt.Errorf("failed to list members of project %s: %w", projectID, err)
+	}
+	return members, nil
+}
+
+// AddProjectMember lets a member of the tenant work in the project
+func (db *DB) AddProjectMember(ctx context.Context, tenantID, projectID, userID string) error {
+	query := `
+	insert into project_memberships (tenant_id, project_id, user_id)
+	select $1, $2, m.user_id
+	from tenant_memberships m
+	where m.tenant_id = $1 and m.user_id = $3
+	on conflict do nothing`
+
+	result, err := db.ExecContext(ctx, query, tenantID, projectID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to add user %s to project %s: %w", userID, projectID, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		// Either already a member or not in the tenant
+		member, err := db.IsActiveMember(ctx, tenantID, userID)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return ports.ErrNotFound
+		}
+	}
+	return nil
+}
+
+func (db *DB) RemoveProjectMember(ctx context.Context, tenantID, projectID, userID string) error {
+	query := "delete from project_memberships where tenant_id = $1 and project_id = $2 and user_id = $3"
+	if _, err := db.ExecContext(ctx, query, tenantID, projectID, userID); err != nil {
+		return fmt.Errorf("failed to remove user %s from project %s: %w", userID, projectID, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ ports.RequestTypeRepository = (*DB)(nil)
+
+const requestTypeColumns = `
+	rt.id, rt.tenant_id, rt.project_id, rt.key, rt.name,
+	coalesce(rt.description, '') as description, rt.sort_order`
+
+// ListRequestTypes returns the request types of the tenant's active projects
+// with their fields, in form order
+func (db *DB) ListRequestTypes(ctx context.Context, tenantID string) ([]models.RequestType, error) {
+	query := `
+	select ` + requestTypeColumns + `
+	from request_types rt
+	join projects p on p.id = rt.project_id
+	where rt.tenant_id = $1 and not rt.is_archived and not p.is_archived
+	order by p.name, rt.sort_order, rt.name`
+
+	types := make([]models.RequestType, 0)
+	err := db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.SelectContext(ctx, &types, query, tenantID); err != nil {
+			return fmt.Errorf("failed to list request types: %w", err)
+		}
+		return loadRequestTypeFields(ctx, tx, tenantID, types)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+func (db *DB) GetRequestType(ctx context.Context, tenantID, id string) (models.RequestType, error) {
+	query := `
+	select ` + requestTypeColumns + `
+	from request_types rt
+	where rt.tenant_id = $1 and rt.id = $2 and not rt.is_archived`
+
+	types := make([]models.RequestType, 1)
+	err := db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &types[0], query, tenantID, id); err != nil {
+			if isNotFound(err) {
+				return ports.ErrNotFound
+			}
+			return fmt.Errorf("failed to get request type %s: %w", id, err)
+		}
+		return loadRequestTypeFields(ctx, tx, tenantID, types)
+	})
+	if err != nil {
+		return models.RequestType{}, err
+	}
+	return types[0], nil
+}
+
+// loadRequestTypeFields fills in each type's unarchived fields and their options
+func loadRequestTypeFields(ctx context.Context, tx *sqlx.Tx, tenantID string, types []models.RequestType) error {
+	if len(types) == 0 {
+		return nil
+	}
+	ids := make([]string, len(types))
+	for i, t := range types {
+		ids[i] = t.ID
+	}
+
+	var rows []struct {
+		RequestTypeID string `db:"request_type_id"`
+		models.RequestTypeField
+	}
+	query := `
+	select rtf.request_type_id, f.id, f.tenant_id, f.key, f.name,
+		coalesce(f.description, '') as description, f.field_type, f.is_archived,
+		rtf.sort_order, rtf.required, rtf.requester_visible
+	from request_type_fields rtf
+	join custom_fields f on f.id = rtf.field_id
+	where rtf.tenant_id = $1 and rtf.request_type_id = any($2::text[]::uuid[]) and not f.is_archived
+	order by rtf.sort_order, f.name`
+	if err := tx.SelectContext(ctx, &rows, query, tenantID, ids); err != nil {
+		return fmt.Errorf("failed to list request type fields: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	options := make([]models.FieldOption, 0)
+	optionsQuery := `
+	select field_id, value, label, sort_order
+	from custom_field_options
+	where tenant_id = $1 and not is_archived
+	order by sort_order, label`
+	if err := tx.SelectContext(ctx, &options, optionsQuery, tenantID); err != nil {
+		return fmt.Errorf("failed to list custom field options: %w", err)
+	}
+	byField := make(map[string][]models.FieldOption)
+	for _, option := range options {
+		byField[option.FieldID] = append(byField[option.FieldID], option)
+	}
+
+	byType := make(map[string][]models.RequestTypeField, len(types))
+	for _, row := range rows {
+		row.Options = byField[row.ID]
+		byType[row.RequestTypeID] = append(byType[row.RequestTypeID], row.RequestTypeField)
+	}
+	for i := range types {
+		types[i].Fields = byType[types[i].ID]
+	}
+	return nil
+}
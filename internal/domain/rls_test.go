@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// The tests in this file need a Postgres database they may migrate and write
+// to, reached through TEST_DATABASE_URL as a role the row-level security
+// policies apply to, i.e. not a superuser and without bypassrls. They are
+// skipped when it is not set.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	db := NewDB(ctx, url)
+	t.Cleanup(func() { _ = db.Close() })
+
+	var bypasses bool
+	if err := db.DB.GetContext(ctx, &bypasses, "select rolsuper or rolbypassrls from pg_roles where rolname = current_user"); err != nil {
+		t.Fatalf("failed to check the database role: %v", err)
+	}
+	if bypasses {
+		t.Fatal("TEST_DATABASE_URL connects as a role that skips row-level security")
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
+
+// bypassTx runs fn in a committed transaction that skips the policies, as
+// the migration runner's do
+func bypassTx(ctx context.Context, db *DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "select set_config('app.bypass_rls', 'on', true)"); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tenantData is one tenant with a ticket that has a comment and a custom
+// field value
+type tenantData struct {
+	ctx     context.Context
+	tenant  models.Tenant
+	ticket  models.Ticket
+	comment models.WorkNote
+	fieldID string
+}
+
+// seedTenant creates the tenant, its project, request type and custom field
+// bypassing the policies, as onboarding does, then adds the ticket, comment and
+// field value as the tenant. Everything is deleted when the test ends.
+func seedTenant(t *testing.T, db *DB, name string) tenantData {
+	t.Helper()
+	bg := context.Background()
+	slug := name + "-" + strings.ToLower(rand.Text()[:10])
+	var d tenantData
+	var projectID, requestTypeID string
+	err := bypassTx(bg, db, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(bg, &d.tenant, "insert into tenants (slug, name) values ($1, $2) returning id, slug, name", slug, name); err != nil {
+			return err
+		}
+		if err := tx.GetContext(bg, &projectID, "insert into projects (tenant_id, key, name) values ($1, 'REPAIR', 'Repairs') returning id", d.tenant.ID); err != nil {
+			return err
+		}
+		if err := tx.GetContext(bg, &requestTypeID, `
+		insert into request_types (tenant_id, project_id, key, name)
+		values ($1, $2, 'repair', 'Repair') returning id`, d.tenant.ID, projectID); err != nil {
+			return err
+		}
+		return tx.GetContext(bg, &d.fieldID, `
+		insert into custom_fields (tenant_id, key, name, field_type)
+		values ($1, 'asset_tag', 'Asset Tag', 'text') returning id`, d.tenant.ID)
+	})
+	if err != nil {
+		t.Fatalf("failed to seed tenant %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		err := bypassTx(bg, db, func(tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(bg, "delete from tickets where tenant_id = $1", d.tenant.ID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(bg, "delete from tenants where id = $1", d.tenant.ID)
+			return err
+		})
+		if err != nil {
+			t.Errorf("failed to delete tenant %s: %v", name, err)
+		}
+	})
+
+	d.ctx = mw.WithTenant(bg, d.tenant)
+	d.ticket = models.Ticket{
+		TenantID:      d.tenant.ID,
+		ProjectID:     projectID,
+		RequestTypeID: requestTypeID,
+		Title:         name + " laptop",
+		Status:        models.StatusNew,
+		CustomerName:  name + " customer",
+		CustomerPhone: "+15415550123",
+	}
+	if err := db.CreateTicket(d.ctx, &d.ticket); err != nil {
+		t.Fatalf("CreateTicket() for %s error = %v", name, err)
+	}
+	d.comment = models.WorkNote{TenantID: d.tenant.ID, TicketID: d.ticket.ID, Content: name + " note"}
+	if err := db.AddComment(d.ctx, &d.comment); err != nil {
+		t.Fatalf("AddComment() for %s error = %v", name, err)
+	}
+	value := []models.FieldValue{{FieldID: d.fieldID, Value: json.RawMessage(`{"text":"` + name + `"}`)}}
+	if err := db.SetFieldValues(d.ctx, d.tenant.ID, d.ticket.ID, value); err != nil {
+		t.Fatalf("SetFieldValues() for %s error = %v", name, err)
+	}
+	return d
+}
+
+func TestTenantIsolation(t *testing.T) {
+	db := testDB(t)
+	a := seedTenant(t, db, "alpha")
+	b := seedTenant(t, db, "bravo")
+
+	// A sees its own data
+	if _, err := db.GetTicket(a.ctx, a.tenant.ID, a.ticket.ID); err != nil {
+		t.Fatalf("GetTicket() of own ticket error = %v", err)
+	}
+	if comments, err := db.ListComments(a.ctx, a.ticket.ID); err != nil || len(comments) != 1 {
+		t.Fatalf("ListComments() of own ticket = %v, %v, want one comment", comments, err)
+	}
+	if values, err := db.ListFieldValues(a.ctx, a.ticket.ID); err != nil || len(values) != 1 {
+		t.Fatalf("ListFieldValues() of own ticket = %v, %v, want one value", values, err)
+	}
+
+	// GetContext: B's ticket does not exist for A, even when asked for by B's
+	// tenant ID
+	for _, tenantID := range []string{a.tenant.ID, b.tenant.ID} {
+		if _, err := db.GetTicket(a.ctx, tenantID, b.ticket.ID); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("GetTicket(%s) of the other tenant's ticket error = %v, want ErrNotFound", tenantID, err)
+		}
+	}
+
+	// SelectContext
+	tickets, err := db.ListTickets(a.ctx, models.TicketFilter{TenantID: b.tenant.ID})
+	if err != nil || len(tickets) != 0 {
+		t.Errorf("ListTickets() of the other tenant = %v, %v, want none", tickets, err)
+	}
+	comments, err := db.ListComments(a.ctx, b.ticket.ID)
+	if err != nil || len(comments) != 0 {
+		t.Errorf("ListComments() of the other tenant's ticket = %v, %v, want none", comments, err)
+	}
+	values, err := db.ListFieldValues(a.ctx, b.ticket.ID)
+	if err != nil || len(values) != 0 {
+		t.Errorf("ListFieldValues() of the other tenant's ticket = %v, %v, want none", values, err)
+	}
+
+	// ExecContext: writes to B's rows match nothing
+	for _, query := range []string{
+		"update tickets set title = 'taken' where id = $1",
+		"update ticket_comments set body = 'taken' where ticket_id = $1",
+		"delete from ticket_field_values where ticket_id = $1",
+	} {
+		result, err := db.ExecContext(a.ctx, query, b.ticket.ID)
+		if err != nil {
+			t.Fatalf("ExecContext(%q) error = %v", query, err)
+		}
+		if rows, _ := result.RowsAffected(); rows != 0 {
+			t.Errorf("ExecContext(%q) changed %d of the other tenant's rows", query, rows)
+		}
+	}
+	// and rows cannot be written into B
+	note := models.WorkNote{TenantID: b.tenant.ID, TicketID: b.ticket.ID, Content: "planted"}
+	if err := db.AddComment(a.ctx, &note); err == nil {
+		t.Error("AddComment() into the other tenant succeeded")
+	}
+	planted := []models.FieldValue{{FieldID: b.fieldID, Value: json.RawMessage(`{"text":"planted"}`)}}
+	if err := db.SetFieldValues(a.ctx, b.tenant.ID, b.ticket.ID, planted); err == nil {
+		t.Error("SetFieldValues() into the other tenant succeeded")
+	}
+
+	// BeginTxx: a raw transaction is scoped too
+	tx, err := db.BeginTxx(a.ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTxx() error = %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var tenants []string
+	if err := tx.SelectContext(a.ctx, &tenants, `
+	select distinct tenant_id from tickets
+	union select distinct tenant_id from ticket_comments
+	union select distinct tenant_id from ticket_field_values`); err != nil {
+		t.Fatalf("select in BeginTxx() error = %v", err)
+	}
+	if len(tenants) != 1 || tenants[0] != a.tenant.ID {
+		t.Errorf("transaction saw tenants %v, want only %s", tenants, a.tenant.ID)
+	}
+
+	// B's data is untouched
+	if ticket, err := db.GetTicket(b.ctx, b.tenant.ID, b.ticket.ID); err != nil || ticket.Title != b.ticket.Title {
+		t.Errorf("other tenant's ticket = %+v, %v, want it unchanged", ticket, err)
+	}
+	if comments, err := db.ListComments(b.ctx, b.ticket.ID); err != nil || len(comments) != 1 || comments[0].Content != b.comment.Content {
+		t.Errorf("other tenant's comments = %v, %v, want them unchanged", comments, err)
+	}
+	if values, err := db.ListFieldValues(b.ctx, b.ticket.ID); err != nil || len(values) != 1 {
+		t.Errorf("other tenant's field values = %v, %v, want them unchanged", values, err)
+	}
+}
+
+// Without a tenant in the context every table with forced row-level security
+// looks empty, through each of the scoped methods
+func TestNoTenantSeesNothing(t *testing.T) {
+	db := testDB(t)
+	seedTenant(t, db, "alpha")
+	seedTenant(t, db, "bravo")
+	ctx := context.Background()
+
+	var tables []string
+	err := db.DB.SelectContext(ctx, &tables, `
+	select c.relname from pg_class c
+	join pg_namespace n on n.oid = c.relnamespace
+	where c.relkind = 'r' and c.relforcerowsecurity and n.nspname = current_schema()
+	order by c.relname`)
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	for _, want := range []string{"tickets", "ticket_comments", "ticket_field_values", "custom_fields", "projects"} {
+		if !contains(tables, want) {
+			t.Fatalf("%s does not force row-level security; forced: %v", want, tables)
+		}
+	}
+
+	for _, table := range tables {
+		t.Run(table, func(t *testing.T) {
+			name := pgx.Identifier{table}.Sanitize()
+
+			var count int
+			if err := db.GetContext(ctx, &count, "select count(*) from "+name); err != nil {
+				t.Fatalf("GetContext() error = %v", err)
+			}
+			var rows []int
+			if err := db.SelectContext(ctx, &rows, "select 1 from "+name); err != nil {
+				t.Fatalf("SelectContext() error = %v", err)
+			}
+			// a select, so a broken policy cannot cost the database its rows;
+			// its command tag still reports how many rows it saw
+			result, err := db.ExecContext(ctx, "select 1 from "+name)
+			if err != nil {
+				t.Fatalf("ExecContext() error = %v", err)
+			}
+			executed, _ := result.RowsAffected()
+
+			tx, err := db.BeginTxx(ctx, nil)
+			if err != nil {
+				t.Fatalf("BeginTxx() error = %v", err)
+			}
+			defer func() { _ = tx.Rollback() }()
+			var txCount int
+			if err := tx.GetContext(ctx, &txCount, "select count(*) from "+name); err != nil {
+				t.Fatalf("select in BeginTxx() error = %v", err)
+			}
+
+			if count != 0 || len(rows) != 0 || executed != 0 || txCount != 0 {
+				t.Errorf("counted %d rows, selected %d, executed over %d and counted %d in a transaction, want none",
+					count, len(rows), executed, txCount)
+			}
+		})
+	}
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
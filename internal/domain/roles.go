@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+// UserPermissions returns every permission granted to the user by their roles
+// in the tenant
+func (db *DB) UserPermissions(ctx context.Context, tenantID, userID string) ([]models.Permission, error) {
+	query := `
+	select distinct rp.permission_key
+	from membership_roles mr
+	join role_permissions rp on rp.role_id = mr.role_id
+	where mr.tenant_id = $1 and mr.user_id = $2`
+
+	perms := make([]models.Permission, 0)
+	if err := db.SelectContext(ctx, &perms, query, tenantID, userID); err != nil {
+		return nil, fmt.Errorf("failed to list permissions for user %s: %w", userID, err)
+	}
+	return perms, nil
+}
+
+func (db *DB) ListRoles(ctx context.Context, tenantID string) ([]models.Role, error) {
+	query := `
+	select id, tenant_id, name, is_system
+	from roles
+	where tenant_id = $1
+	order by not is_system, name`
+
+	roles := make([]models.Role, 0)
+	if err := db.SelectContext(ctx, &roles, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (db *DB) GetRoleByName(ctx context.Context, tenantID, name string) (models.Role, error) {
+	query := `
+	select id, tenant_id, name, is_system
+	from roles
+	where tenant_id = $1 and name = $2`
+
+	var role models.Role
+	if err := db.GetContext(ctx, &role, query, tenantID, name); err != nil {
+		if isNotFound(err) {
+			return models.Role{}, ports.ErrNotFound
+		}
+		return models.Role{}, fmt.Errorf("failed to get role %q: %w", name, err)
+	}
+	return role, nil
+}
+
+// AddMemberRole grants the role to a member of the tenant
+func (db *DB) AddMemberRole(ctx context.Context, tenantID, userID, roleID string) error {
+	query := `
+	insert into membership_roles (tenant_id, user_id, role_id)
+	values ($1, $2, $3)
+	on conflict do nothing`
+
+	if _, err := db.ExecContext(ctx, query, tenantID, userID, roleID); err != nil {
+		return fmt.Errorf("failed to add role %s to user %s: %w", roleID, userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+// A tenant created after the statuses migration gets the default statuses
+// from the trigger, and they can be added to, renamed and reordered
+func TestNewTenantStatuses(t *testing.T) {
+	db := testDB(t)
+	d := seedTenant(t, db, "charlie")
+
+	statuses, err := db.ListStatuses(d.ctx, d.tenant.ID, "")
+	if err != nil {
+		t.Fatalf("ListStatuses() error = %v", err)
+	}
+	if len(statuses) != len(models.DefaultStatuses) {
+		t.Fatalf("ListStatuses() = %d statuses, want the %d defaults", len(statuses), len(models.DefaultStatuses))
+	}
+	for i, want := range models.DefaultStatuses {
+		got := statuses[i]
+		if got.Key != want.Key || got.Label != want.Label || got.Category != want.Category || got.NotifyCustomer != want.NotifyCustomer {
+			t.Errorf("status %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	added := models.TicketStatus{TenantID: d.tenant.ID, Key: "on_hold", Label: "On Hold", Colour: "red", Category: models.CategoryWaiting}
+	if err := db.CreateStatus(d.ctx, &added); err != nil {
+		t.Fatalf("CreateStatus() error = %v", err)
+	}
+	duplicate := added
+	if err := db.CreateStatus(d.ctx, &duplicate); !errors.Is(err, ports.ErrConflict) {
+		t.Errorf("CreateStatus() of a taken key error = %v, want ErrConflict", err)
+	}
+	added.Label = "Paused"
+	if err := db.UpdateStatus(d.ctx, &added); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	ids := []string{added.ID}
+	for _, status := range statuses {
+		ids = append(ids, status.ID)
+	}
+	if err := db.ReorderStatuses(d.ctx, d.tenant.ID, ids); err != nil {
+		t.Fatalf("ReorderStatuses() error = %v", err)
+	}
+
+	statuses, err = db.ListStatuses(d.ctx, d.tenant.ID, "")
+	if err != nil {
+		t.Fatalf("ListStatuses() error = %v", err)
+	}
+	if statuses[0].ID != added.ID || statuses[0].Label != "Paused" || statuses[1].Key != models.StatusNew {
+		t.Errorf("ListStatuses() after reordering starts %+v, %+v, want Paused then New", statuses[0], statuses[1])
+	}
+}
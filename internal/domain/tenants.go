@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+)
+
+// TenantResolver looks tenants up by hostname (tenant_domains) or slug
+// (tenants) and caches both hits and misses for ttl
+type TenantResolver struct {
+	db  *DB
+	ttl time.Duration
+
+	mu     sync.Mutex
+	byHost map[string]tenantCacheEntry
+	bySlug map[string]tenantCacheEntry
+}
+
+type tenantCacheEntry struct {
+	tenant  *models.Tenant
+	expires time.Time
+}
+
+var _ middleware.TenantResolver = (*TenantResolver)(nil)
+
+func NewTenantResolver(db *DB, ttl time.Duration) *TenantResolver {
+	return &TenantResolver{
+		db:     db,
+		ttl:    ttl,
+		byHost: make(map[string]tenantCacheEntry),
+		bySlug: make(map[string]tenantCacheEntry),
+	}
+}
+
+func (r *TenantResolver) ResolveByHost(ctx context.Context, host string) (*models.Tenant, bool, error) {
+	host = normaliseHost(host)
+	if host == "" {
+		return nil, false, nil
+	}
+	query := `
+	select t.id, t.slug, t.name
+	from tenant_domains d
+	join tenants t on t.id = d.tenant_id
+	where d.hostname = $1`
+	return r.resolve(ctx, r.byHost, host, query)
+}
+
+func (r *TenantResolver) ResolveBySlug(ctx context.Context, slug string) (*models.Tenant, bool, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if slug == "" {
+		return nil, false, nil
+	}
+	return r.resolve(ctx, r.bySlug, slug, "select id, slug, name from tenants where slug = $1")
+}
+
+func (r *TenantResolver) resolve(ctx context.Context, cache map[string]tenantCacheEntry, key, query string) (*models.Tenant, bool, error) {
+	now := time.Now()
+	r.mu.Lock()
+	entry, hit := cache[key]
+	r.mu.Unlock()
+	if hit && now.Before(entry.expires) {
+		return entry.tenant, entry.tenant != nil, nil
+	}
+
+	var tenant *models.Tenant
+	var row models.Tenant
+	if err := r.db.GetContext(ctx, &row, query, key); err != nil {
+		if !isNotFound(err) {
+			return nil, false, fmt.Errorf("failed to resolve tenant %q: %w", key, err)
+		}
+	} else {
+		tenant = &row
+	}
+
+	r.mu.Lock()
+	cache[key] = tenantCacheEntry{tenant: tenant, expires: now.Add(r.ttl)}
+	r.mu.Unlock()
+	return tenant, tenant != nil, nil
+}
+
+// normaliseHost lowercases the host and drops any port and trailing dot so it
+// matches tenant_domains.hostname
+func normaliseHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
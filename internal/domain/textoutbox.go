@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ ports.TextOutboxRepository = (*DB)(nil)
+
+const textOutboxColumns = `id, tenant_id, to_address, body, status, attempts, last_error,
+	next_attempt_at, created_at, sent_at`
+
+// EnqueueText queues a text message for delivery
+func (db *DB) EnqueueText(ctx context.Context, text *models.OutboxText) error {
+	query := `
+	insert into sms_outbox (tenant_id, to_address, body)
+	values ($1, $2, $3)
+	returning ` + textOutboxColumns
+
+	if err := db.GetContext(ctx, text, query, text.TenantID, text.To, text.Body); err != nil {
+		return fmt.Errorf("failed to queue text: %w", err)
+	}
+	return nil
+}
+
+// ClaimTexts returns up to limit pending texts that are due and pushes their
+// next attempt back by lease, as ClaimMail does for mail
+func (db *DB) ClaimTexts(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxText, error) {
+	query := `
+	update sms_outbox
+	set next_attempt_at = now() + $2 * interval '1 second', attempts = attempts + 1
+	where id in (
+		select id from sms_outbox
+		where status = 'pending' and next_attempt_at <= now()
+		order by next_attempt_at
+		limit $1
+		for update skip locked
+	)
+	returning ` + textOutboxColumns
+
+	var texts []models.OutboxText
+	err := db.inBypassTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &texts, query, limit, lease.Seconds())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim texts: %w", err)
+	}
+	return texts, nil
+}
+
+func (db *DB) MarkTextSent(ctx context.Context, id string) error {
+	query := `
+	update sms_outbox
+	set status = 'sent', sent_at = now(), last_error = null
+	where id = $1`
+
+	err := db.inBypassTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark text %s sent: %w", id, err)
+	}
+	return nil
+}
+
+// MarkTextFailed records a failed attempt. The text is retried at retryAt, or
+// given up on when it is nil.
+func (db *DB) MarkTextFailed(ctx context.Context, id, reason string, retryAt *time.Time) error {
+	query := `
+	update sms_outbox
+	set last_error = $2,
+		status = case when $3::timestamptz is null then 'failed' else 'pending' end,
+		next_attempt_at = coalesce($3, next_attempt_at)
+	where id = $1`
+
+	err := db.inBypassTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, id, reason, retryAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark text %s failed: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,490 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+const ticketColumns = `
+	t.id, t.tenant_id, t.project_id, p.key as project_key, t.request_type_id, t.ticket_number, t.title,
+	coalesce(t.description, '') as issue_description,
+	t.status, coalesce(t.priority, '') as priority,
+	coalesce(ts.label, '') as status_label, coalesce(ts.colour, '') as status_colour,
+	coalesce(ts.category, '') as status_category,
+	coalesce(t.external_tag, '') as external_tag,
+	t.customer_id, t.customer_name, t.customer_phone, t.customer_email,
+	t.item_type, t.item_brand, t.item_model, t.item_details, t.serial_number,
+	t.internal_notes, t.estimated_cost, t.due_date,
+	(
+		select coalesce(sum(tp.quantity * tp.unit_cost), 0)
+		from ticket_parts tp where tp.ticket_id = t.id
+	) as total_parts_cost,
+	t.assigned_to_user_id, coalesce(au.name, '') as assigned_to,
+	t.created_by_user_id, coalesce(cu.name, '') as created_by,
+	t.created_at, t.updated_at, t.closed_at`
+
+const ticketFrom = `
+	from tickets t
+	join projects p on p.id = t.project_id
+	left join users au on au.id = t.assigned_to_user_id
+	left join users cu on cu.id = t.created_by_user_id
+	left join lateral (
+		select s.label, s.colour, s.category
+		from ticket_statuses s
+		where s.tenant_id = t.tenant_id and s.key = t.status
+			and (s.project_id is null or s.project_id = t.project_id)
+		order by s.project_id nulls last
+		limit 1
+	) ts on true`
+
+// ticketOpen is true for tickets whose status is not in the done category.
+// Statuses missing from ticket_statuses fall back to closed_at.
+const ticketOpen = "coalesce(ts.category <> 'done', t.closed_at is null)"
+
+var _ ports.TicketRepository = (*DB)(nil)
+
+// ticketWhere builds the WHERE clause shared by ListTickets and CountTickets
+func ticketWhere(filter models.TicketFilter) (string, []any) {
+	args := []any{filter.TenantID}
+	clauses := []string{"t.tenant_id = $1"}
+	if filter.ProjectIDs != nil {
+		args = append(args, filter.ProjectIDs)
+		clauses = append(clauses, fmt.Sprintf("t.project_id = any($%d::text[]::uuid[])", len(args)))
+	}
+	if filter.CustomerID != "" {
+		args = append(args, filter.CustomerID)
+		clauses = append(clauses, fmt.Sprintf("t.customer_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		clauses = append(clauses, fmt.Sprintf("t.status = $%d", len(args)))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		clauses = append(clauses, fmt.Sprintf(`(
+			t.title ilike $%[1]d or t.description ilike $%[1]d or
+			t.customer_name ilike $%[1]d or t.customer_phone ilike $%[1]d or t.customer_email ilike $%[1]d or
+			t.serial_number ilike $%[1]d or t.external_tag ilike $%[1]d or
+			(p.key || '-' || t.ticket_number) ilike $%[1]d
+		)`, len(args)))
+	}
+	if filter.OpenOnly {
+		clauses = append(clauses, ticketOpen)
+	}
+	return " where " + strings.Join(clauses, " and "), args
+}
+
+func (db *DB) ListTickets(ctx context.Context, filter models.TicketFilter) ([]models.Ticket, error) {
+	where, args := ticketWhere(filter)
+	query := "select " + ticketColumns + ticketFrom + where + " order by t.created_at desc"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" limit $%d", len(args))
+	}
+
+	tickets := make([]models.Ticket, 0)
+	if err := db.SelectContext(ctx, &tickets, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+func (db *DB) CountTickets(ctx context.Context, filter models.TicketFilter) (int, error) {
+	where, args := ticketWhere(filter)
+	var count int
+	if err := db.GetContext(ctx, &count, "select count(*)"+ticketFrom+where, args...); err != nil {
+		return 0, fmt.Errorf("failed to count tickets: %w", err)
+	}
+	return count, nil
+}
+
+// TicketStats counts the filtered tickets for the dashboard cards using the
+// status categories
+func (db *DB) TicketStats(ctx context.Context, filter models.TicketFilter) (models.TicketStats, error) {
+	where, args := ticketWhere(filter)
+	query := `
+	select
+		count(*) filter (where ` + ticketOpen + `) as open_tickets,
+		count(*) filter (where ts.category = 'waiting') as waiting,
+		count(*) filter (where ` + ticketOpen + ` and t.due_date < current_date) as overdue,
+		count(*) filter (where not ` + ticketOpen + ` and t.closed_at >= date_trunc('day', now())) as completed_today
+	` + ticketFrom + where
+
+	var stats models.TicketStats
+	if err := db.GetContext(ctx, &stats, query, args...); err != nil {
+		return models.TicketStats{}, fmt.Errorf("failed to count ticket stats: %w", err)
+	}
+	return stats, nil
+}
+
+func (db *DB) GetTicket(ctx context.Context, tenantID, id string) (models.Ticket, error) {
+	var ticket models.Ticket
+	err := db.GetContext(ctx, &ticket, "select "+ticketColumns+ticketFrom+" where t.tenant_id = $1 and t.id = $2", tenantID, id)
+	if err != nil {
+		if isNotFound(err) {
+			return models.Ticket{}, ports.ErrNotFound
+		}
+		return models.Ticket{}, fmt.Errorf("failed to get ticket %s: %w", id, err)
+	}
+	return ticket, nil
+}
+
+// GetTicketByKey looks a ticket up by its human-readable key, e.g. REPAIR-1042
+func (db *DB) GetTicketByKey(ctx context.Context, tenantID, projectKey string, number int64) (models.Ticket, error) {
+	var ticket models.Ticket
+	query := "select " + ticketColumns + ticketFrom + " where t.tenant_id = $1 and upper(p.key) = upper($2) and t.ticket_number = $3"
+	if err := db.GetContext(ctx, &ticket, query, tenantID, projectKey, number); err != nil {
+		if isNotFound(err) {
+			return models.Ticket{}, ports.ErrNotFound
+		}
+		return models.Ticket{}, fmt.Errorf("failed to get ticket %s-%d: %w", projectKey, number, err)
+	}
+	return ticket, nil
+}
+
+// CreateTicket allocates the next number in the ticket's project and inserts
+// it in the same transaction, so a failed insert does not burn a number. The
+// ticket is linked to its customer as saveCustomer describes.
+func (db *DB) CreateTicket(ctx context.Context, ticket *models.Ticket) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	number, err := nextTicketNumber(ctx, tx, ticket.TenantID, ticket.ProjectID)
+	if err != nil {
+		return err
+	}
+	ticket.Number = number
+	if err := saveCustomer(ctx, tx, ticket); err != nil {
+		return err
+	}
+
+	query := `
+	insert into tickets (
+		tenant_id, project_id, request_type_id, ticket_number, title, description,
+		status, priority, created_by_user_id, assigned_to_user_id,
+		external_tag, customer_id, customer_name, customer_phone, customer_email,
+		item_type, item_brand, item_model, item_details, serial_number,
+		internal_notes, estimated_cost, due_date
+	) values (
+		$1, $2, $3, $4, $5, nullif($6, ''),
+		$7, nullif($8, ''), $9, $10,
+		nullif($11, ''), $12, $13, $14, $15,
+		$16, $17, $18, $19, $20,
+		$21, $22, $23
+	)
+	returning id, created_at, updated_at`
+
+	row := tx.QueryRowxContext(ctx, query,
+		ticket.TenantID, ticket.ProjectID, ticket.RequestTypeID, ticket.Number, ticket.Title, ticket.IssueDescription,
+		ticket.Status, ticket.Priority, ticket.CreatedByUserID, ticket.AssignedToUserID,
+		ticket.ExternalTag, ticket.CustomerID, ticket.CustomerName, ticket.CustomerPhone, ticket.CustomerEmail,
+		ticket.ItemType, ticket.ItemBrand, ticket.ItemModel, ticket.ItemDetails, ticket.SerialNumber,
+		ticket.InternalNotes, ticket.EstimatedCost, ticket.DueDate,
+	)
+	if err := row.Scan(&ticket.ID, &ticket.CreatedAt, &ticket.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to create ticket: %w", err)
+	}
+
+	if err := tx.GetContext(ctx, &ticket.ProjectKey, "select key from projects where id = $1", ticket.ProjectID); err != nil {
+		return fmt.Errorf("failed to load project key: %w", err)
+	}
+	return tx.Commit()
+}
+
+// nextTicketNumber increments the project's counter row. The upsert holds the
+// row lock until tx ends, serialising concurrent allocations per project.
+func nextTicketNumber(ctx context.Context, tx *sqlx.Tx, tenantID, projectID string) (int64, error) {
+	query := `
+	insert into project_ticket_counters (project_id, tenant_id, last_number)
+	values ($1, $2, 1)
+	on conflict (project_id)
+	do update set last_number = project_ticket_counters.last_number + 1
+	returning last_number`
+
+	var number int64
+	if err := tx.GetContext(ctx, &number, query, projectID, tenantID); err != nil {
+		return 0, fmt.Errorf("failed to allocate ticket number: %w", err)
+	}
+	return number, nil
+}
+
+// UpdateTicket saves the editable fields of a ticket. Status and closed_at are
+// only changed through ChangeTicketStatus. A ticket whose CustomerID has been
+// cleared is linked to a customer again as saveCustomer describes.
+func (db *DB) UpdateTicket(ctx context.Context, ticket *models.Ticket) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		if ticket.CustomerID == nil {
+			if err := saveCustomer(ctx, tx, ticket); err != nil {
+				return err
+			}
+		}
+
+		query := `
+		update tickets set
+			title = $2,
+			description = nullif($3, ''),
+			priority = nullif($4, ''),
+			assigned_to_user_id = $5,
+			external_tag = nullif($6, ''),
+			customer_id = $7,
+			customer_name = $8,
+			customer_phone = $9,
+			customer_email = $10,
+			item_type = $11,
+			item_brand = $12,
+			item_model = $13,
+			item_details = $14,
+			serial_number = $15,
+			internal_notes = $16,
+			estimated_cost = $17,
+			due_date = $18,
+			updated_at = now()
+		where id = $1 and tenant_id = $19
+		returning updated_at`
+
+		err := tx.GetContext(ctx, &ticket.UpdatedAt, query,
+			ticket.ID, ticket.Title, ticket.IssueDescription, ticket.Priority,
+			ticket.AssignedToUserID, ticket.ExternalTag,
+			ticket.CustomerID, ticket.CustomerName, ticket.CustomerPhone, ticket.CustomerEmail,
+			ticket.ItemType, ticket.ItemBrand, ticket.ItemModel, ticket.ItemDetails, ticket.SerialNumber,
+			ticket.InternalNotes, ticket.EstimatedCost, ticket.DueDate, ticket.TenantID,
+		)
+		if err != nil {
+			if isNotFound(err) {
+				return ports.ErrNotFound
+			}
+			return fmt.Errorf("failed to update ticket %s: %w", ticket.ID, err)
+		}
+		return nil
+	})
+}
+
+// ChangeTicketStatus moves the ticket from one status to ticket.Status and
+// records event in the same transaction. It fails with ports.ErrConflict when
+// the ticket is no longer in the from status.
+func (db *DB) ChangeTicketStatus(ctx context.Context, ticket *models.Ticket, from models.Status, event *models.TicketEvent) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+	update tickets set
+		status = $3,
+		closed_at = $4,
+		updated_at = now()
+	where id = $1 and status = $2 and tenant_id = $5
+	returning updated_at`
+
+	row := tx.QueryRowxContext(ctx, query, ticket.ID, from, ticket.Status, ticket.ClosedAt, ticket.TenantID)
+	if err := row.Scan(&ticket.UpdatedAt); err != nil {
+		if isNotFound(err) {
+			return ports.ErrConflict
+		}
+		return fmt.Errorf("failed to change status of ticket %s: %w", ticket.ID, err)
+	}
+
+	if err := addEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const commentColumns = `
+	c.id, c.tenant_id, c.ticket_id, c.body, c.is_internal,
+	c.author_user_id, coalesce(u.name, '') as author, c.created_at`
+
+// ListComments returns every note on the ticket, newest first, including
+// internal ones. Customer-facing code must use ListPublicComments.
+func (db *DB) ListComments(ctx context.Context, ticketID string) ([]models.WorkNote, error) {
+	return db.listComments(ctx, ticketID, false)
+}
+
+// ListPublicComments returns only the notes marked as visible to the customer
+func (db *DB) ListPublicComments(ctx context.Context, ticketID string) ([]models.WorkNote, error) {
+	return db.listComments(ctx, ticketID, true)
+}
+
+func (db *DB) listComments(ctx context.Context, ticketID string, publicOnly bool) ([]models.WorkNote, error) {
+	query := `
+	select ` + commentColumns + `
+	from ticket_comments c
+	left join users u on u.id = c.author_user_id
+	where c.ticket_id = $1 and (not $2 or not c.is_internal)
+	order by c.created_at desc`
+
+	notes := make([]models.WorkNote, 0)
+	if err := db.SelectContext(ctx, &notes, query, ticketID, publicOnly); err != nil {
+		return nil, fmt.Errorf("failed to list comments for ticket %s: %w", ticketID, err)
+	}
+	return notes, nil
+}
+
+func (db *DB) AddComment(ctx context.Context, note *models.WorkNote) error {
+	query := `
+	insert into ticket_comments (tenant_id, ticket_id, author_user_id, body, is_internal)
+	values ($1, $2, $3, $4, $5)
+	returning id, created_at`
+
+	err := db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowxContext(ctx, query, note.TenantID, note.TicketID, note.AuthorUserID, note.Content, note.IsInternal)
+		return row.Scan(&note.ID, &note.Timestamp)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add comment to ticket %s: %w", note.TicketID, err)
+	}
+	return nil
+}
+
+// SetCommentVisibility marks a note on the ticket as internal or public
+func (db *DB) SetCommentVisibility(ctx context.Context, ticketID, commentID string, internal bool) (models.WorkNote, error) {
+	query := `
+	with updated as (
+		update ticket_comments set is_internal = $3
+		where id = $1 and ticket_id = $2
+		returning *
+	)
+	select ` + commentColumns + `
+	from updated c
+	left join users u on u.id = c.author_user_id`
+
+	var note models.WorkNote
+	if err := db.GetContext(ctx, &note, query, commentID, ticketID, internal); err != nil {
+		if isNotFound(err) {
+			return models.WorkNote{}, ports.ErrNotFound
+		}
+		return models.WorkNote{}, fmt.Errorf("failed to update comment %s: %w", commentID, err)
+	}
+	return note, nil
+}
+
+func (db *DB) ListEvents(ctx context.Context, ticketID string) ([]models.TicketEvent, error) {
+	query := `
+	select e.id, e.tenant_id, e.ticket_id, e.actor_user_id, coalesce(u.name, '') as actor,
+		e.type, e.payload, e.created_at
+	from ticket_events e
+	left join users u on u.id = e.actor_user_id
+	where e.ticket_id = $1
+	order by e.created_at desc`
+
+	events := make([]models.TicketEvent, 0)
+	if err := db.SelectContext(ctx, &events, query, ticketID); err != nil {
+		return nil, fmt.Errorf("failed to list events for ticket %s: %w", ticketID, err)
+	}
+	return events, nil
+}
+
+func (db *DB) AddEvent(ctx context.Context, event *models.TicketEvent) error {
+	return db.inTenantTx(ctx, func(tx *sqlx.Tx) error {
+		return addEvent(ctx, tx, event)
+	})
+}
+
+func addEvent(ctx context.Context, q sqlx.QueryerContext, event *models.TicketEvent) error {
+	payload := "{}"
+	if len(event.Payload) > 0 {
+		payload = string(event.Payload)
+	}
+	query := `
+	insert into ticket_events (tenant_id, ticket_id, actor_user_id, type, payload)
+	values ($1, $2, $3, $4, $5::jsonb)
+	returning id, created_at`
+
+	row := q.QueryRowxContext(ctx, query, event.TenantID, event.TicketID, event.ActorUserID, event.Type, payload)
+	if err := row.Scan(&event.ID, &event.CreatedAt); err != nil {
+		return fmt.Errorf("failed to add %s event to ticket %s: %w", event.Type, event.TicketID, err)
+	}
+	return nil
+}
+
+func (db *DB) ListCustomFields(ctx context.Context, tenantID string) ([]models.CustomField, error) {
+	query := `
+	select id, tenant_id, key, name, coalesce(description, '') as description, field_type, is_archived
+	from custom_fields
+	where tenant_id = $1 and not is_archived
+	order by name`
+
+	fields := make([]models.CustomField, 0)
+	if err := db.SelectContext(ctx, &fields, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list custom fields: %w", err)
+	}
+	if len(fields) == 0 {
+		return fields, nil
+	}
+
+	options := make([]models.FieldOption, 0)
+	optionsQuery := `
+	select field_id, value, label, sort_order
+	from custom_field_options
+	where tenant_id = $1 and not is_archived
+	order by sort_order, label`
+	if err := db.SelectContext(ctx, &options, optionsQuery, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list custom field options: %w", err)
+	}
+	byField := make(map[string][]models.FieldOption, len(fields))
+	for _, option := range options {
+		byField[option.FieldID] = append(byField[option.FieldID], option)
+	}
+	for i := range fields {
+		fields[i].Options = byField[fields[i].ID]
+	}
+	return fields, nil
+}
+
+func (db *DB) ListFieldValues(ctx context.Context, ticketID string) ([]models.FieldValue, error) {
+	query := `
+	select v.field_id, f.key, f.name, f.field_type, v.value
+	from ticket_field_values v
+	join custom_fields f on f.id = v.field_id
+	where v.ticket_id = $1
+	order by f.name`
+
+	values := make([]models.FieldValue, 0)
+	if err := db.SelectContext(ctx, &values, query, ticketID); err != nil {
+		return nil, fmt.Errorf("failed to list field values for ticket %s: %w", ticketID, err)
+	}
+	return values, nil
+}
+
+func (db *DB) SetFieldValues(ctx context.Context, tenantID, ticketID string, values []models.FieldValue) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+	insert into ticket_field_values (tenant_id, ticket_id, field_id, value)
+	values ($1, $2, $3, $4::jsonb)
+	on conflict (tenant_id, ticket_id, field_id)
+	do update set value = excluded.value, updated_at = now()`
+	for _, value := range values {
+		if _, err := tx.ExecContext(ctx, query, tenantID, ticketID, value.FieldID, string(value.Value)); err != nil {
+			return fmt.Errorf("failed to set field %s on ticket %s: %w", value.FieldID, ticketID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// isNotFound reports whether err means the row does not exist, which includes
+// lookups by a malformed uuid
+func isNotFound(err error) bool {
+	if errors.Is(err, sql.ErrNoRows) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "22P02"
+}
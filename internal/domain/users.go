@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+const userColumns = `
+	u.id, u.name, u.email, u.email_verified, coalesce(u.password_hash, '') as password_hash,
+	u.is_system_admin, u.created_at, u.last_login_at`
+
+func (db *DB) GetUser(ctx context.Context, id string) (models.User, error) {
+	var user models.User
+	if err := db.GetContext(ctx, &user, "select "+userColumns+" from users u where u.id = $1", id); err != nil {
+		if isNotFound(err) {
+			return models.User{}, ports.ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("failed to get user %s: %w", id, err)
+	}
+	return user, nil
+}
+
+// GetUserByEmail looks a user up by email, ignoring case
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	if err := db.GetContext(ctx, &user, "select "+userColumns+" from users u where u.email = $1", email); err != nil {
+		if isNotFound(err) {
+			return models.User{}, ports.ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return user, nil
+}
+
+func (db *DB) CreateUser(ctx context.Context, user *models.User) error {
+	query := `
+	insert into users (name, email, email_verified, password_hash, is_system_admin)
+	values ($1, $2, $3, nullif($4, ''), $5)
+	returning id, created_at`
+
+	if err := db.GetContext(ctx, user, query, user.Name, user.Email, user.EmailVerified, user.PasswordHash, user.IsSystemAdmin); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// AddMembership makes the user an active member of the tenant. An existing
+// membership, including a disabled one, is left as it is.
+func (db *DB) AddMembership(ctx context.Context, tenantID, userID string) error {
+	query := `
+	insert into tenant_memberships (tenant_id, user_id, status)
+	values ($1, $2, 'active')
+	on conflict (tenant_id, user_id) do nothing`
+
+	if _, err := db.ExecContext(ctx, query, tenantID, userID); err != nil {
+		return fmt.Errorf("failed to add user %s to tenant %s: %w", userID, tenantID, err)
+	}
+	return nil
+}
+
+// IsActiveMember reports whether the user has an active membership in the tenant
+func (db *DB) IsActiveMember(ctx context.Context, tenantID, userID string) (bool, error) {
+	query := `
+	select exists (
+		select 1 from tenant_memberships
+		where tenant_id = $1 and user_id = $2 and status = 'active'
+	)`
+
+	var member bool
+	if err := db.GetContext(ctx, &member, query, tenantID, userID); err != nil {
+		return false, fmt.Errorf("failed to check membership: %w", err)
+	}
+	return member, nil
+}
+
+// MembershipStatus returns the user's membership status in the tenant:
+// active, invited or disabled
+func (db *DB) MembershipStatus(ctx context.Context, tenantID, userID string) (string, error) {
+	query := "select status from tenant_memberships where tenant_id = $1 and user_id = $2"
+
+	var status string
+	if err := db.GetContext(ctx, &status, query, tenantID, userID); err != nil {
+		if isNotFound(err) {
+			return "", ports.ErrNotFound
+		}
+		return "", fmt.Errorf("failed to get membership: %w", err)
+	}
+	return status, nil
+}
+
+// ListMembers returns the tenant's active members
+func (db *DB) ListMembers(ctx context.Context, tenantID string) ([]models.User, error) {
+	query := "select " + userColumns + `
+	from users u
+	join tenant_memberships m on m.user_id = u.id
+	where m.tenant_id = $1 and m.status = 'active'
+	order by u.name, u.email`
+
+	users := make([]models.User, 0)
+	if err := db.SelectContext(ctx, &users, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	return users, nil
+}
+
+// SetPassword replaces the user's password hash. Following a reset link also
+// proves the address, so the email is marked verified.
+func (db *DB) SetPassword(ctx context.Context, userID, passwordHash string) error {
+	query := "update users set password_hash = $2, email_verified = true where id = $1"
+	if _, err := db.ExecContext(ctx, query, userID, passwordHash); err != nil {
+		return fmt.Errorf("failed to set password for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (db *DB) MarkEmailVerified(ctx context.Context, userID string) error {
+	if _, err := db.ExecContext(ctx, "update users set email_verified = true where id = $1", userID); err != nil {
+		return fmt.Errorf("failed to verify email for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (db *DB) RecordLogin(ctx context.Context, userID string) error {
+	if _, err := db.ExecContext(ctx, "update users set last_login_at = now() where id = $1", userID); err != nil {
+		return fmt.Errorf("failed to record login for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// CreateSession stores the session and clears out the user's expired ones
+func (db *DB) CreateSession(ctx context.Context, session *models.Session) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "delete from sessions where user_id = $1 and expires_at <= now()", session.UserID); err != nil {
+		return fmt.Errorf("failed to prune sessions: %w", err)
+	}
+
+	query := `
+	insert into sessions (id, user_id, tenant_id, user_agent, ip_address, expires_at)
+	values ($1, $2, $3, $4, $5, $6)
+	returning created_at, last_seen_at`
+
+	row := tx.QueryRowxContext(ctx, query,
+		session.ID, session.UserID, session.TenantID, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	)
+	if err := row.Scan(&session.CreatedAt, &session.LastSeenAt); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetSessionUser returns the user signed in with the session, provided the
+// session has not expired and the user is still an active member of the tenant
+func (db *DB) GetSessionUser(ctx context.Context, tenantID, sessionID string) (models.User, error) {
+	query := `
+	select ` + userColumns + `
+	from sessions s
+	join users u on u.id = s.user_id
+	join tenant_memberships m on m.tenant_id = s.tenant_id and m.user_id = s.user_id
+	where s.id = $1 and s.tenant_id = $2 and s.expires_at > now() and m.status = 'active'`
+
+	var user models.User
+	if err := db.GetContext(ctx, &user, query, sessionID, tenantID); err != nil {
+		if isNotFound(err) {
+			return models.User{}, ports.ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("failed to get session: %w", err)
+	}
+	return user, nil
+}
+
+func (db *DB) DeleteSession(ctx context.Context, sessionID string) error {
+	if _, err := db.ExecContext(ctx, "delete from sessions where id = $1", sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions signs the user out everywhere, in every tenant
+func (db *DB) DeleteUserSessions(ctx context.Context, userID string) error {
+	if _, err := db.ExecContext(ctx, "delete from sessions where user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to delete sessions for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// GetUserByIdentity returns the user linked to the identity provider account
+func (db *DB) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	query := `
+	select ` + userColumns + `
+	from user_identities i
+	join users u on u.id = i.user_id
+	where i.issuer = $1 and i.subject = $2`
+
+	var user models.User
+	if err := db.GetContext(ctx, &user, query, issuer, subject); err != nil {
+		if isNotFound(err) {
+			return models.User{}, ports.ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("failed to get user by identity: %w", err)
+	}
+	return user, nil
+}
+
+// LinkIdentity records that the identity provider account belongs to the user
+func (db *DB) LinkIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	query := `
+	insert into user_identities (user_id, issuer, subject, email)
+	values ($1, $2, $3, $4)
+	on conflict (issuer, subject) do update set email = excluded.email
+	returning created_at`
+
+	err := db.GetContext(ctx, &identity.CreatedAt, query, identity.UserID, identity.Issuer, identity.Subject, identity.Email)
+	if err != nil {
+		return fmt.Errorf("failed to link identity for user %s: %w", identity.UserID, err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Package forms holds the validation errors shared by the app's forms and the
+// component that shows them
+package forms
+
+import (
+	"slices"
+	"strings"
+)
+
+// FieldErrors maps a form field name to the message shown beneath it
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
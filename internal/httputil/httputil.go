@@ -0,0 +1,113 @@
+// Package httputil holds the request helpers shared by the route packages
+package httputil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ctxKey string
+
+const ctxClientIP ctxKey = "client_ip"
+
+// IsHTMX reports whether r was made by htmx rather than a full page load
+func IsHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") != ""
+}
+
+// BaseURL returns the scheme and host r was made to, for building absolute
+// links. With secure set the scheme is always https.
+func BaseURL(r *http.Request, secure bool) string {
+	scheme := "http"
+	if secure || r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ClientIP returns the address of the client that made r, as found by
+// RealIP, or the connection's remote address without RealIP
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxClientIP).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// RealIP finds the client's address for ClientIP. X-Forwarded-For is only
+// read when the connection comes from one of the trusted proxies, and then
+// the rightmost address that is not a trusted proxy wins, so clients cannot
+// pick their own address by sending the header themselves.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedFor(r, trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxClientIP, ip)))
+		})
+	}
+}
+
+func forwardedFor(r *http.Request, trusted []netip.Prefix) string {
+	ip := remoteIP(r)
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ParsePrefixes reads a comma-separated list of CIDR ranges or single
+// addresses, skipping any it cannot parse
+func ParsePrefixes(s string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(part); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(part); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileSender writes each message to an .eml file instead of delivering it,
+// for development and tests. The files open in any mail client.
+type FileSender struct {
+	dir string
+}
+
+var _ Sender = (*FileSender)(nil)
+
+func NewFileSender(dir string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileSender{dir: dir}, nil
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	raw, err := msg.Bytes(now)
+	if err != nil {
+		return err
+	}
+	// timestamped names sort in the order the messages were sent
+	f, err := os.CreateTemp(s.dir, now.UTC().Format("20060102T150405.000")+"-*.eml")
+	if err != nil {
+		return fmt.Errorf("failed to create mail file: %w", err)
+	}
+	if _, err := f.Write(raw); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	return f.Close()
+}
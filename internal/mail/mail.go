@@ -0,0 +1,39 @@
+// Package mail sends email through a pluggable Sender
+package mail
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Message is an email ready to send. HTML is optional. From is filled in by
+// the Worker from the tenant's outbound address; services leave it empty.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers messages. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender writes messages to the log instead of delivering them, for
+// development
+type LogSender struct {
+	log *slog.Logger
+}
+
+var _ Sender = (*LogSender)(nil)
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log.With("Sender", "Log")}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.log.InfoContext(ctx, "Mail not sent, logging instead", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
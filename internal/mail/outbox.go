@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+// Outbox is the Sender services use. It queues messages in mail_outbox for
+// the Worker to deliver, so a slow or unreachable mail server never holds up
+// a request and failed sends are retried.
+type Outbox struct {
+	store ports.OutboxRepository
+}
+
+var _ Sender = (*Outbox)(nil)
+
+func NewOutbox(store ports.OutboxRepository) *Outbox {
+	return &Outbox{store: store}
+}
+
+// Send queues the message for the tenant on the context
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+	mail := models.OutboxMail{
+		TenantID: tenantID,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Text:     msg.Text,
+	}
+	if msg.HTML != "" {
+		mail.HTML = &msg.HTML
+	}
+	return o.store.EnqueueMail(ctx, &mail)
+}
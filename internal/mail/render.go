@@ -0,0 +1,22 @@
+package mail
+
+import (
+	"context"
+	"strings"
+
+	"github.com/a-h/templ"
+)
+
+// Render renders body in the email Layout and derives the plain-text
+// alternative from the result
+func Render(ctx context.Context, to, subject string, body templ.Component) (Message, error) {
+	var html strings.Builder
+	if err := Layout(subject, body).Render(ctx, &html); err != nil {
+		return Message{}, err
+	}
+	text, err := PlainText(html.String())
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: subject, Text: text, HTML: html.String()}, nil
+}
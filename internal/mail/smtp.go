@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	netmail "net/mail"
+)
+
+// SMTPConfig is how to reach the mail server. Port 465 uses implicit TLS;
+// other ports upgrade with STARTTLS when the server offers it.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// SMTPSender delivers messages through an SMTP server, one connection per
+// message
+type SMTPSender struct {
+	cfg     SMTPConfig
+	timeout time.Duration
+}
+
+var _ Sender = (*SMTPSender)(nil)
+
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg, timeout: 30 * time.Second}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	raw, err := msg.Bytes(time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := netmail.ParseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.cfg.Host, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(s.timeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		// PlainAuth refuses to send the password unless the connection is
+		// encrypted or to localhost
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s *SMTPSender) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.cfg.Host, s.cfg.Port)
+	dialer := &net.Dialer{Timeout: s.timeout}
+	if s.cfg.Port == "465" {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.cfg.Host}}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// IsPermanent reports whether the mail server rejected a message outright
+// (a 5xx reply), so sending it again will not help
+func IsPermanent(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500 && reply.Code < 600
+}
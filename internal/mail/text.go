@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	spaces     = regexp.MustCompile(`[ \t\r\n]+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText turns a rendered HTML email into its plain-text alternative:
+// paragraphs and headings become blank-line separated blocks, list items get
+// a dash and links are followed by their URL
+func PlainText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	writeText(&b, doc)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n", nil
+}
+
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(spaces.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+		switch n.Data {
+		case "head", "style", "script", "title":
+			return
+		case "br":
+			b.WriteString("\n")
+			return
+		case "hr":
+			b.WriteString("\n\n----------\n\n")
+			return
+		case "p", "div", "table", "ul", "ol", "blockquote", "h1", "h2", "h3", "h4", "h5", "h6":
+			b.WriteString("\n\n")
+			defer b.WriteString("\n\n")
+		case "tr":
+			b.WriteString("\n")
+		case "li":
+			b.WriteString("\n- ")
+		case "a":
+			if href := attr(n, "href"); href != "" && !strings.HasPrefix(href, "mailto:") {
+				start := b.Len()
+				defer func() {
+					if strings.TrimSpace(b.String()[start:]) != href {
+						b.WriteString(" (" + href + ")")
+					}
+				}()
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
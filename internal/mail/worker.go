@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"flexsupport/internal/backoff"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	netmail "net/mail"
+)
+
+const (
+	// maxAttempts is how many times a message is tried before it is marked failed
+	maxAttempts = 8
+	// claimLease is how long a claimed message is hidden from other workers
+	claimLease  = 5 * time.Minute
+	batchSize   = 20
+	sendTimeout = time.Minute
+)
+
+// Worker delivers queued mail through a transport, retrying failures with
+// exponential backoff
+type Worker struct {
+	log       *slog.Logger
+	store     ports.OutboxRepository
+	transport Sender
+	from      *netmail.Address
+	interval  time.Duration
+}
+
+// NewWorker returns a worker that checks the outbox every interval. from is
+// the sender used when a tenant has no outbound address of its own.
+func NewWorker(log *slog.Logger, store ports.OutboxRepository, transport Sender, from string, interval time.Duration) (*Worker, error) {
+	addr, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q: %w", from, err)
+	}
+	return &Worker{
+		log:       log.With("Worker", "Mail"),
+		store:     store,
+		transport: transport,
+		from:      addr,
+		interval:  interval,
+	}, nil
+}
+
+// Run delivers queued mail until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.deliver(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends everything that is due, a batch at a time
+func (w *Worker) deliver(ctx context.Context) {
+	for ctx.Err() == nil {
+		mails, err := w.store.ClaimMail(ctx, batchSize, claimLease)
+		if err != nil {
+			w.log.Error("failed to claim mail", "error", err)
+			return
+		}
+		for _, mail := range mails {
+			w.send(ctx, mail)
+		}
+		if len(mails) < batchSize {
+			return
+		}
+	}
+}
+
+func (w *Worker) send(ctx context.Context, mail models.OutboxMail) {
+	msg := Message{
+		From:    w.sender(mail),
+		To:      mail.To,
+		Subject: mail.Subject,
+		Text:    mail.Text,
+	}
+	if mail.HTML != nil {
+		msg.HTML = *mail.HTML
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	err := w.transport.Send(sendCtx, msg)
+	cancel()
+	if err == nil {
+		if err := w.store.MarkMailSent(ctx, mail.ID); err != nil {
+			w.log.Error("failed to mark mail sent", "mail", mail.ID, "error", err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if mail.Attempts < maxAttempts && !IsPermanent(err) {
+		at := time.Now().Add(backoff.Delay(mail.Attempts))
+		retryAt = &at
+		w.log.Warn("failed to send mail, will retry", "mail", mail.ID, "attempt", mail.Attempts, "retry_at", at, "error", err)
+	} else {
+		w.log.Error("failed to send mail, giving up", "mail", mail.ID, "attempt", mail.Attempts, "error", err)
+	}
+	if err := w.store.MarkMailFailed(ctx, mail.ID, err.Error(), retryAt); err != nil {
+		w.log.Error("failed to record mail failure", "mail", mail.ID, "error", err)
+	}
+}
+
+// sender is the tenant's outbound address, filling in whatever it leaves out
+// from the default
+func (w *Worker) sender(mail models.OutboxMail) string {
+	from := *w.from
+	if mail.FromEmail != nil && *mail.FromEmail != "" {
+		from.Address = *mail.FromEmail
+	}
+	if mail.FromName != nil && *mail.FromName != "" {
+		from.Name = *mail.FromName
+	}
+	return from.String()
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"flexsupport/internal/models"
+)
+
+const ctxUser ctxKey = "user"
+
+// SessionCookie holds the session token set at sign-in
+const SessionCookie = "session"
+
+// ErrNoUser is returned by code that needs a signed-in user when there is none
+var ErrNoUser = errors.New("no user in context")
+
+// SessionStore resolves a session cookie to the signed-in user. A missing or
+// expired session is reported as ok == false rather than an error.
+type SessionStore interface {
+	Authenticate(ctx context.Context, token string) (*models.User, bool, error)
+}
+
+// SessionMiddleware loads the user for the request's session cookie, if any.
+// It must run after TenantMiddleware since sessions belong to a tenant.
+func SessionMiddleware(store SessionStore) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := r.Cookie(SessionCookie)
+			if err != nil || c.Value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user, ok, err := store.Authenticate(r.Context(), c.Value)
+			if err != nil {
+				http.Error(w, "session lookup failed", http.StatusInternalServerError)
+				return
+			}
+			if ok {
+				r = r.WithContext(WithUser(r.Context(), *user))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUser sends requests without a signed-in user to the login page,
+// remembering where they were going
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := UserFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		dest := r.URL.RequestURI()
+		if r.Header.Get("HX-Request") == "true" {
+			// htmx would swap the login page into the target; send the whole page there instead
+			if current, err := url.Parse(r.Header.Get("HX-Current-URL")); err == nil && current.Path != "" {
+				dest = current.RequestURI()
+			}
+			w.Header().Set("HX-Redirect", "/login?next="+url.QueryEscape(dest))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(dest), http.StatusSeeOther)
+	})
+}
+
+// WithUser stores the signed-in user on the context
+func WithUser(ctx context.Context, user models.User) context.Context {
+	return context.WithValue(ctx, ctxUser, user)
+}
+
+// UserFromContext returns the signed-in user
+func UserFromContext(ctx context.Context) (models.User, bool) {
+	user, ok := ctx.Value(ctxUser).(models.User)
+	return user, ok
+}
+
+// UserID returns the signed-in user's ID, or ErrNoUser
+func UserID(ctx context.Context) (string, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok || user.ID == "" {
+		return "", ErrNoUser
+	}
+	return user.ID, nil
+}
+
+// Actor returns the signed-in user's ID for attributing changes and events,
+// or nil when there is no user, such as for customers and background work
+func Actor(ctx context.Context) *string {
+	id, err := UserID(ctx)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
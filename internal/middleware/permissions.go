@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"flexsupport/internal/models"
+)
+
+const ctxPermissions ctxKey = "permissions"
+
+// PermissionLoader returns what the user may do in the tenant on the context
+type PermissionLoader interface {
+	Permissions(ctx context.Context, userID string) (models.PermissionSet, error)
+}
+
+// PermissionMiddleware loads the signed-in user's permissions for Can and
+// RequirePermission. It must run after SessionMiddleware.
+func PermissionMiddleware(loader PermissionLoader) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			perms, err := loader.Permissions(r.Context(), user.ID)
+			if err != nil {
+				http.Error(w, "permission lookup failed", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPermissions(r.Context(), perms)))
+		})
+	}
+}
+
+// RequirePermission rejects requests from users without perm with 403 Forbidden
+func RequirePermission(perm models.Permission) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !Can(r.Context(), perm) {
+				http.Error(w, "You do not have permission to do that", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithPermissions stores the user's permissions on the context
+func WithPermissions(ctx context.Context, perms models.PermissionSet) context.Context {
+	return context.WithValue(ctx, ctxPermissions, perms)
+}
+
+// Can reports whether the signed-in user has perm in the current tenant.
+// Templates use it to hide actions the user cannot take.
+func Can(ctx context.Context, perm models.Permission) bool {
+	perms, _ := ctx.Value(ctxPermissions).(models.PermissionSet)
+	return perms.Has(perm)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"flexsupport/internal/models"
+)
+
+const ctxProjects ctxKey = "projects"
+
+// ProjectCookie remembers the project picked in the project switcher
+const ProjectCookie = "project"
+
+// ProjectLoader returns the projects the user may work in within the tenant
+// on the context
+type ProjectLoader interface {
+	UserProjects(ctx context.Context, userID string) ([]models.Project, error)
+}
+
+type projectScope struct {
+	projects []models.Project
+	current  *models.Project
+}
+
+// ProjectMiddleware loads the signed-in user's projects and the one picked in
+// the switcher, if it is still one of them. It must run after
+// PermissionMiddleware.
+func ProjectMiddleware(loader ProjectLoader) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			projects, err := loader.UserProjects(r.Context(), user.ID)
+			if err != nil {
+				http.Error(w, "project lookup failed", http.StatusInternalServerError)
+				return
+			}
+			scope := projectScope{projects: projects}
+			if c, err := r.Cookie(ProjectCookie); err == nil && c.Value != "" {
+				if i := slices.IndexFunc(projects, func(p models.Project) bool { return p.ID == c.Value }); i >= 0 {
+					scope.current = &projects[i]
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxProjects, scope)))
+		})
+	}
+}
+
+// Projects returns the projects the signed-in user may work in
+func Projects(ctx context.Context) []models.Project {
+	scope, _ := ctx.Value(ctxProjects).(projectScope)
+	return scope.projects
+}
+
+// CurrentProject returns the project picked in the switcher, if any
+func CurrentProject(ctx context.Context) (models.Project, bool) {
+	scope, _ := ctx.Value(ctxProjects).(projectScope)
+	if scope.current == nil {
+		return models.Project{}, false
+	}
+	return *scope.current, true
+}
+
+// ProjectIDs returns the projects listings are limited to: the current
+// project when one is picked, otherwise every project the user may work in.
+// Without a loaded scope it is empty, so nothing is listed.
+func ProjectIDs(ctx context.Context) []string {
+	if current, ok := CurrentProject(ctx); ok {
+		return []string{current.ID}
+	}
+	projects := Projects(ctx)
+	ids := make([]string, 0, len(projects))
+	for _, p := range projects {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// CanAccessProject reports whether the signed-in user may work in the project
+func CanAccessProject(ctx context.Context, projectID string) bool {
+	return slices.ContainsFunc(Projects(ctx), func(p models.Project) bool { return p.ID == projectID })
+}
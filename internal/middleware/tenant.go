@@ -2,7 +2,11 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
+
+	"flexsupport/internal/models"
 )
 
 type ctxKey string
@@ -10,47 +14,108 @@ type ctxKey string
 const (
 	ctxTenantID   ctxKey = "tenant_id"
 	ctxTenantSlug ctxKey = "tenant_slug"
+	ctxTenant     ctxKey = "tenant"
 )
 
-type Tenant struct {
-	ID   string
-	Slug string
-	Name string
-}
+// tenantCookie remembers the tenant picked through /t/{slug}/ in dev mode so
+// the app's absolute links keep working after the first request
+const tenantCookie = "dev_tenant"
+
+// ErrNoTenant is returned by tenant-scoped code reached without a resolved tenant
+var ErrNoTenant = errors.New("no tenant in context")
 
 type TenantResolver interface {
-	ResolveByHost(ctx context.Context, host string) (*Tenant, bool, error)
-	ResolveBySlug(ctx context.Context, slug string) (*Tenant, bool, error)
+	ResolveByHost(ctx context.Context, host string) (*models.Tenant, bool, error)
+	ResolveBySlug(ctx context.Context, slug string) (*models.Tenant, bool, error)
+}
+
+// TenantMiddleware resolves the tenant from the request host. With
+// pathFallback set, as in development, /t/{slug}/... selects the tenant by
+// slug when the host is unknown and the prefix is stripped before routing.
+func TenantMiddleware(resolver TenantResolver, pathFallback bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, ok, err := resolver.ResolveByHost(r.Context(), r.Host)
+			if err != nil {
+				http.Error(w, "tenant lookup failed", http.StatusInternalServerError)
+				return
+			}
+
+			if !ok && pathFallback {
+				slug, rest, fromPath := tenantSlugFromPath(r.URL.Path)
+				if !fromPath {
+					if c, err := r.Cookie(tenantCookie); err == nil {
+						slug = c.Value
+					}
+				}
+				if slug != "" {
+					tenant, ok, err = resolver.ResolveBySlug(r.Context(), slug)
+					if err != nil {
+						http.Error(w, "tenant lookup failed", http.StatusInternalServerError)
+						return
+					}
+				}
+				if ok && fromPath {
+					http.SetCookie(w, &http.Cookie{
+						Name:     tenantCookie,
+						Value:    tenant.Slug,
+						Path:     "/",
+						HttpOnly: true,
+						SameSite: http.SameSiteLaxMode,
+					})
+					r = stripPath(r, rest)
+				}
+			}
+
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), *tenant)))
+		})
+	}
+}
+
+// tenantSlugFromPath splits "/t/{slug}/rest" into the slug and "/rest"
+func tenantSlugFromPath(path string) (slug, rest string, ok bool) {
+	trimmed, found := strings.CutPrefix(path, "/t/")
+	if !found {
+		return "", "", false
+	}
+	slug, rest, _ = strings.Cut(trimmed, "/")
+	if slug == "" {
+		return "", "", false
+	}
+	return slug, "/" + rest, true
+}
+
+func stripPath(r *http.Request, path string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	return r2
+}
+
+// WithTenant stores the tenant on the context
+func WithTenant(ctx context.Context, tenant models.Tenant) context.Context {
+	ctx = context.WithValue(ctx, ctxTenant, tenant)
+	ctx = context.WithValue(ctx, ctxTenantID, tenant.ID)
+	return context.WithValue(ctx, ctxTenantSlug, tenant.Slug)
+}
+
+// TenantFromContext returns the tenant resolved for the request
+func TenantFromContext(ctx context.Context) (models.Tenant, bool) {
+	tenant, ok := ctx.Value(ctxTenant).(models.Tenant)
+	return tenant, ok
 }
 
-func TenantMiddleware(resolver TenantResolver, next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		host := r.Host
-		tenant, ok, err := resolver.ResolveByHost(r.Context(), host)
-		if err != nil {
-			http.Error(w, "tenant lookup failed", http.StatusInternalServerError)
-			return
-		}
-
-		// // Optional: fallback to /t/{slug}/... (dev mode)
-		// if !ok {
-		// 	slug, ok2 := tenantSlugFromPath(r.URL.Path) // you implement
-		// 	if ok2 {
-		// 		tenant, ok, err = resolver.ResolveBySlug(r.Context(), slug)
-		// 		if err != nil {
-		// 			http.Error(w, "tenant lookup failed", http.StatusInternalServerError)
-		// 			return
-		// 		}
-		// 	}
-		// }
-
-		if !ok {
-			http.NotFound(w, r)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), ctxTenantID, tenant.ID)
-		ctx = context.WithValue(ctx, ctxTenantSlug, tenant.Slug)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// TenantID returns the resolved tenant's ID, or ErrNoTenant. Services call it
+// before every query so nothing runs unscoped.
+func TenantID(ctx context.Context) (string, error) {
+	id, ok := ctx.Value(ctxTenantID).(string)
+	if !ok || id == "" {
+		return "", ErrNoTenant
+	}
+	return id, nil
 }
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Customer is someone the shop repairs for, stored once per tenant in
+// customers and matched by phone number or email
+type Customer struct {
+	ID        string    `db:"id" json:"id"`
+	TenantID  string    `db:"tenant_id" json:"tenant_id"`
+	Name      string    `db:"name" json:"name"`
+	Phone     string    `db:"phone" json:"phone"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	// TotalOrders counts the customer's tickets
+	TotalOrders int `db:"total_orders" json:"total_orders"`
+	// TotalSpend adds up the total cost of the customer's finished tickets
+	TotalSpend float64 `db:"-" json:"total_spend"`
+}
+
+// CustomerFilter narrows a customer listing
+type CustomerFilter struct {
+	TenantID   string   // required
+	ProjectIDs []string // limits TotalOrders to these projects unless nil
+	Search     string
+	Limit      int
+}
+
+// PhoneKey returns the digits of a phone number, which customers are matched
+// on when the number has no E.164 form
+func PhoneKey(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// DuplicateCustomers is a pair of customers who may be the same person
+type DuplicateCustomers struct {
+	Customer Customer
+	Other    Customer
+	// SamePhone is set when the numbers' last ten digits match, which catches
+	// one entered with a country code and one without
+	SamePhone bool
+	// SameEmail is set when the addresses match once dots and +tags in the
+	// part before the @ are ignored
+	SameEmail bool
+	// NameSimilarity is pg_trgm's similarity of the names, from 0 to 1
+	NameSimilarity float64
+}
+
+// CustomerMerge records one customer being merged into another, stored in
+// customer_merges
+type CustomerMerge struct {
+	ID               string    `db:"id" json:"id"`
+	TenantID         string    `db:"tenant_id" json:"tenant_id"`
+	KeptCustomerID   string    `db:"kept_customer_id" json:"kept_customer_id"`
+	MergedCustomerID string    `db:"merged_customer_id" json:"merged_customer_id"`
+	MergedName       string    `db:"merged_name" json:"merged_name"`
+	MergedPhone      string    `db:"merged_phone" json:"merged_phone"`
+	MergedEmail      string    `db:"merged_email" json:"merged_email"`
+	TicketCount      int       `db:"ticket_count" json:"ticket_count"`
+	MergedByUserID   *string   `db:"merged_by_user_id" json:"merged_by_user_id,omitempty"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
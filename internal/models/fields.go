@@ -0,0 +1,139 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FieldType string
+
+const (
+	FieldText        FieldType = "text"
+	FieldTextarea    FieldType = "textarea"
+	FieldNumber      FieldType = "number"
+	FieldBool        FieldType = "bool"
+	FieldDate        FieldType = "date"
+	FieldDatetime    FieldType = "datetime"
+	FieldSelect      FieldType = "select"
+	FieldMultiselect FieldType = "multiselect"
+)
+
+// CustomField is a tenant-defined ticket field, stored in custom_fields
+type CustomField struct {
+	ID          string        `db:"id" json:"id"`
+	TenantID    string        `db:"tenant_id" json:"tenant_id"`
+	Key         string        `db:"key" json:"key"`
+	Name        string        `db:"name" json:"name"`
+	Description string        `db:"description" json:"description"`
+	FieldType   FieldType     `db:"field_type" json:"field_type"`
+	IsArchived  bool          `db:"is_archived" json:"is_archived"`
+	Options     []FieldOption `db:"-" json:"options,omitempty"`
+}
+
+// FieldOption is one choice of a select or multiselect field, stored in custom_field_options
+type FieldOption struct {
+	FieldID   string `db:"field_id" json:"field_id"`
+	Value     string `db:"value" json:"value"`
+	Label     string `db:"label" json:"label"`
+	SortOrder int    `db:"sort_order" json:"sort_order"`
+}
+
+// FieldValue is a custom field value set on a ticket, stored in ticket_field_values.
+// Value holds the JSON document for the field type, e.g. {"text":"abc"},
+// {"number":12.5}, {"bool":true}, {"date":"2025-01-31"}, {"option":"laptop"} or {"options":["a","b"]}.
+type FieldValue struct {
+	FieldID   string          `db:"field_id" json:"field_id"`
+	Key       string          `db:"key" json:"key"`
+	Name      string          `db:"name" json:"name"`
+	FieldType FieldType       `db:"field_type" json:"field_type"`
+	Value     json.RawMessage `db:"value" json:"value"`
+}
+
+type fieldDocument struct {
+	Text     *string  `json:"text,omitempty"`
+	Number   *float64 `json:"number,omitempty"`
+	Bool     *bool    `json:"bool,omitempty"`
+	Date     *string  `json:"date,omitempty"`
+	Datetime *string  `json:"datetime,omitempty"`
+	Option   *string  `json:"option,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	UserID   *string  `json:"user_id,omitempty"`
+}
+
+// Display renders the stored value as plain text
+func (v FieldValue) Display() string {
+	var doc fieldDocument
+	if err := json.Unmarshal(v.Value, &doc); err != nil {
+		return string(v.Value)
+	}
+	switch {
+	case doc.Text != nil:
+		return *doc.Text
+	case doc.Number != nil:
+		return strconv.FormatFloat(*doc.Number, 'f', -1, 64)
+	case doc.Bool != nil:
+		if *doc.Bool {
+			return "Yes"
+		}
+		return "No"
+	case doc.Date != nil:
+		return *doc.Date
+	case doc.Datetime != nil:
+		return strings.Replace(*doc.Datetime, "T", " ", 1)
+	case doc.Option != nil:
+		return *doc.Option
+	case doc.Options != nil:
+		return strings.Join(doc.Options, ", ")
+	case doc.UserID != nil:
+		return *doc.UserID
+	default:
+		return ""
+	}
+}
+
+// EncodeFieldValue converts raw form input into the JSON document stored for
+// a field of the given type
+func EncodeFieldValue(fieldType FieldType, raw []string) (json.RawMessage, error) {
+	first := ""
+	if len(raw) > 0 {
+		first = strings.TrimSpace(raw[0])
+	}
+
+	var doc any
+	switch fieldType {
+	case FieldNumber:
+		n, err := strconv.ParseFloat(first, 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		doc = map[string]float64{"number": n}
+	case FieldBool:
+		doc = map[string]bool{"bool": first == "on" || first == "true" || first == "1"}
+	case FieldDate:
+		if _, err := time.Parse("2006-01-02", first); err != nil {
+			return nil, errors.New("must be a date (YYYY-MM-DD)")
+		}
+		doc = map[string]string{"date": first}
+	case FieldDatetime:
+		if _, err := time.Parse("2006-01-02T15:04", first); err != nil {
+			return nil, errors.New("must be a date and time")
+		}
+		doc = map[string]string{"datetime": first}
+	case FieldSelect:
+		doc = map[string]string{"option": first}
+	case FieldMultiselect:
+		options := make([]string, 0, len(raw))
+		for _, r := range raw {
+			if r = strings.TrimSpace(r); r != "" {
+				options = append(options, r)
+			}
+		}
+		doc = map[string][]string{"options": options}
+	default:
+		doc = map[string]string{"text": first}
+	}
+	return json.Marshal(doc)
+}
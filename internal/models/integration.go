@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type IntegrationType string
+
+const (
+	IntegrationShopify IntegrationType = "shopify"
+	IntegrationOIDC    IntegrationType = "oidc"
+	IntegrationWebhook IntegrationType = "webhook"
+	IntegrationSMTP    IntegrationType = "smtp"
+	IntegrationSMS     IntegrationType = "sms"
+)
+
+// Integration is a tenant's connection to an outside service, stored in
+// integrations. Config holds the type-specific settings as JSON.
+type Integration struct {
+	ID        string          `db:"id" json:"id"`
+	TenantID  string          `db:"tenant_id" json:"tenant_id"`
+	Type      IntegrationType `db:"integration_type" json:"integration_type"`
+	Name      string          `db:"name" json:"name"`
+	Enabled   bool            `db:"enabled" json:"enabled"`
+	Config    json.RawMessage `db:"config" json:"config"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+// OIDC decodes the config of an oidc integration
+func (i Integration) OIDC() (OIDCConfig, error) {
+	var cfg OIDCConfig
+	if len(i.Config) == 0 {
+		return cfg, nil
+	}
+	err := json.Unmarshal(i.Config, &cfg)
+	return cfg, err
+}
+
+// OIDCConfig is the config of an oidc integration
+type OIDCConfig struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	ButtonLabel  string `json:"button_label"`
+	// AllowedDomains lists the email domains whose users are added to the
+	// tenant on first sign-in. Anyone else must already be a member.
+	AllowedDomains []string `json:"allowed_domains"`
+	AutoProvision  bool     `json:"auto_provision"`
+	// DefaultRole is the role name given to provisioned members; Viewer when empty
+	DefaultRole string `json:"default_role"`
+}
+
+// Label returns the text for the sign-in button
+func (c OIDCConfig) Label() string {
+	if c.ButtonLabel == "" {
+		return "Sign in with SSO"
+	}
+	return c.ButtonLabel
+}
+
+// AllowsDomain reports whether new users with this email may be provisioned
+func (c OIDCConfig) AllowsDomain(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range c.AllowedDomains {
+		if strings.EqualFold(strings.TrimSpace(allowed), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// SMS decodes the config of an sms integration
+func (i Integration) SMS() (SMSConfig, error) {
+	var cfg SMSConfig
+	if len(i.Config) == 0 {
+		return cfg, nil
+	}
+	err := json.Unmarshal(i.Config, &cfg)
+	return cfg, err
+}
+
+type SMSProvider string
+
+const (
+	SMSProviderTwilio SMSProvider = "twilio"
+	// SMSProviderFake records messages instead of sending them
+	SMSProviderFake SMSProvider = "fake"
+)
+
+// SMSConfig is the config of an sms integration
+type SMSConfig struct {
+	Provider   SMSProvider `json:"provider"`
+	AccountSID string      `json:"account_sid"`
+	AuthToken  string      `json:"auth_token"`
+	FromNumber string      `json:"from_number"`
+	// BaseURL points at a Twilio-compatible API; Twilio's when empty
+	BaseURL string `json:"base_url"`
+	// DefaultCountryCode is assumed for customer numbers entered without one
+	DefaultCountryCode string `json:"default_country_code"`
+}
+
+// UserIdentity links a user to an account at an external identity provider,
+// stored in user_identities
+type UserIdentity struct {
+	UserID    string    `db:"user_id" json:"user_id"`
+	Issuer    string    `db:"issuer" json:"issuer"`
+	Subject   string    `db:"subject" json:"subject"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Invitation asks someone to join a tenant, stored in invitations. The
+// emailed token is never stored, only its hash.
+type Invitation struct {
+	ID              string     `db:"id" json:"id"`
+	TenantID        string     `db:"tenant_id" json:"tenant_id"`
+	UserID          string     `db:"user_id" json:"user_id"`
+	RoleID          *string    `db:"role_id" json:"role_id,omitempty"`
+	TokenHash       string     `db:"token_hash" json:"-"`
+	InvitedByUserID *string    `db:"invited_by_user_id" json:"invited_by_user_id,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt       time.Time  `db:"expires_at" json:"expires_at"`
+	AcceptedAt      *time.Time `db:"accepted_at" json:"accepted_at,omitempty"`
+	RevokedAt       *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+
+	// Joined from users and roles
+	Email     string `db:"email" json:"email"`
+	Name      string `db:"name" json:"name"`
+	RoleName  string `db:"role_name" json:"role_name"`
+	InvitedBy string `db:"invited_by" json:"invited_by"`
+}
+
+// IsExpired reports whether the invitation can no longer be accepted because
+// it is too old
+func (i Invitation) IsExpired() bool {
+	return !time.Now().Before(i.ExpiresAt)
+}
+
+// IsUsable reports whether the invitation can still be accepted
+func (i Invitation) IsUsable() bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && !i.IsExpired()
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type MailStatus string
+
+const (
+	MailPending MailStatus = "pending"
+	MailSent    MailStatus = "sent"
+	MailFailed  MailStatus = "failed"
+)
+
+// OutboxMail is an email waiting in, or delivered from, mail_outbox
+type OutboxMail struct {
+	ID            string     `db:"id" json:"id"`
+	TenantID      string     `db:"tenant_id" json:"tenant_id"`
+	FromName      *string    `db:"from_name" json:"from_name,omitempty"`
+	FromEmail     *string    `db:"from_email" json:"from_email,omitempty"`
+	To            string     `db:"to_address" json:"to"`
+	Subject       string     `db:"subject" json:"subject"`
+	Text          string     `db:"text_body" json:"text"`
+	HTML          *string    `db:"html_body" json:"html,omitempty"`
+	Status        MailStatus `db:"status" json:"status"`
+	Attempts      int        `db:"attempts" json:"attempts"`
+	LastError     *string    `db:"last_error" json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	SentAt        *time.Time `db:"sent_at" json:"sent_at,omitempty"`
+}
+
+// OutboxText is a text message waiting in, or delivered from, sms_outbox. It
+// moves through the same statuses as OutboxMail.
+type OutboxText struct {
+	ID            string     `db:"id" json:"id"`
+	TenantID      string     `db:"tenant_id" json:"tenant_id"`
+	To            string     `db:"to_address" json:"to"`
+	Body          string     `db:"body" json:"body"`
+	Status        MailStatus `db:"status" json:"status"`
+	Attempts      int        `db:"attempts" json:"attempts"`
+	LastError     *string    `db:"last_error" json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	SentAt        *time.Time `db:"sent_at" json:"sent_at,omitempty"`
+}
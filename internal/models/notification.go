@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type NotificationChannel string
+
+const (
+	ChannelEmail NotificationChannel = "email"
+	ChannelSMS   NotificationChannel = "sms"
+)
+
+// OptOutSource is who stopped messages to an address
+type OptOutSource string
+
+const (
+	OptOutStaff    OptOutSource = "staff"
+	OptOutCustomer OptOutSource = "customer"
+)
+
+// OptOut stops messages on a channel to an address, stored in
+// notification_opt_outs
+type OptOut struct {
+	TenantID  string              `db:"tenant_id" json:"tenant_id"`
+	Channel   NotificationChannel `db:"channel" json:"channel"`
+	Address   string              `db:"address" json:"address"`
+	Source    OptOutSource        `db:"source" json:"source"`
+	CreatedAt time.Time           `db:"created_at" json:"created_at"`
+}
+
+// NotificationTemplate is a tenant's wording for the message a customer gets
+// when their ticket enters a status, stored in notification_templates.
+// Subject is only used for email.
+type NotificationTemplate struct {
+	ID        string              `db:"id" json:"id"`
+	TenantID  string              `db:"tenant_id" json:"tenant_id"`
+	StatusKey Status              `db:"status_key" json:"status_key"`
+	Channel   NotificationChannel `db:"channel" json:"channel"`
+	Subject   string              `db:"subject" json:"subject"`
+	Body      string              `db:"body" json:"body"`
+	UpdatedAt time.Time           `db:"updated_at" json:"updated_at"`
+}
+
+// NotificationPlaceholders lists what templates can refer to; each is
+// replaced with the ticket's value when the message is sent
+var NotificationPlaceholders = []string{
+	"{customer_name}", "{ticket_key}", "{status}", "{item}", "{estimated_cost}", "{shop_name}",
+}
+
+// DefaultNotificationTemplate is the wording used when the tenant has not
+// written its own
+func DefaultNotificationTemplate(status Status, channel NotificationChannel) NotificationTemplate {
+	t := NotificationTemplate{StatusKey: status, Channel: channel}
+	switch {
+	case channel == ChannelSMS && status == StatusReady:
+		t.Body = "{shop_name}: your {item} ({ticket_key}) is ready for pickup."
+	case channel == ChannelSMS:
+		t.Body = "{shop_name}: your {item} ({ticket_key}) is now {status}."
+	case status == StatusReady:
+		t.Subject = "Your {item} is ready for pickup"
+		t.Body = "Hi {customer_name},\n\nGood news: your {item} is ready for pickup. Please mention ticket {ticket_key} when you come in.\n\n{shop_name}"
+	default:
+		t.Subject = "Update on your repair {ticket_key}"
+		t.Body = "Hi {customer_name},\n\nYour {item} (ticket {ticket_key}) is now {status}.\n\n{shop_name}"
+	}
+	return t
+}
+
+// Fill replaces the placeholders in the subject and body with the ticket's
+// details
+func (t NotificationTemplate) Fill(shopName string, ticket Ticket) (subject, body string) {
+	item := strings.TrimSpace(ticket.ItemBrand + " " + ticket.ItemModel)
+	switch {
+	case item != "":
+	case ticket.ItemType == Other && ticket.ItemDetails != "":
+		item = ticket.ItemDetails
+	case ticket.ItemType != "" && ticket.ItemType != Other:
+		item = string(ticket.ItemType)
+	default:
+		item = "item"
+	}
+	r := strings.NewReplacer(
+		"{customer_name}", ticket.CustomerName,
+		"{ticket_key}", ticket.Key(),
+		"{status}", ticket.StatusDisplay(),
+		"{item}", item,
+		"{estimated_cost}", fmt.Sprintf("$%.2f", ticket.TotalCost()),
+		"{shop_name}", shopName,
+	)
+	return r.Replace(t.Subject), r.Replace(t.Body)
+}
+
+// NormalizeEmail returns the form email addresses are compared and opted out in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,47 @@
+package models
+
+// Permission is a key in the permissions catalogue, granted to roles through
+// role_permissions
+type Permission string
+
+const (
+	PermTicketRead   Permission = "ticket.read"
+	PermTicketCreate Permission = "ticket.create"
+	PermTicketWrite  Permission = "ticket.write"
+	PermTicketStatus Permission = "ticket.status"
+	PermProjectAdmin Permission = "project.admin"
+	PermMemberManage Permission = "member.manage"
+	PermTenantAdmin  Permission = "tenant.admin"
+)
+
+// System role names seeded for every tenant
+const (
+	RoleOwner      = "Owner"
+	RoleTechnician = "Technician"
+	RoleFrontDesk  = "Front Desk"
+	RoleViewer     = "Viewer"
+)
+
+// Role is a named set of permissions within a tenant, stored in roles
+type Role struct {
+	ID       string `db:"id" json:"id"`
+	TenantID string `db:"tenant_id" json:"tenant_id"`
+	Name     string `db:"name" json:"name"`
+	IsSystem bool   `db:"is_system" json:"is_system"`
+}
+
+// PermissionSet is what a user may do in the current tenant
+type PermissionSet map[Permission]bool
+
+func NewPermissionSet(perms ...Permission) PermissionSet {
+	set := make(PermissionSet, len(perms))
+	for _, perm := range perms {
+		set[perm] = true
+	}
+	return set
+}
+
+// Has reports whether the set grants perm
+func (s PermissionSet) Has(perm Permission) bool {
+	return s[perm]
+}
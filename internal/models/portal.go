@@ -0,0 +1,39 @@
+package models
+
+// PortalSettings is a tenant's public customer portal, stored in
+// tenant_settings and project_portal_settings
+type PortalSettings struct {
+	TenantID    string `db:"tenant_id" json:"tenant_id"`
+	Enabled     bool   `db:"public_portal_enabled" json:"enabled"`
+	Title       string `db:"portal_title" json:"title"`
+	WelcomeText string `db:"portal_welcome_text" json:"welcome_text"`
+
+	// Projects lists every active project and whether its tickets show in the portal
+	Projects []PortalProject `db:"-" json:"projects"`
+}
+
+// PortalProject is one project's portal switch
+type PortalProject struct {
+	ProjectID string `db:"project_id" json:"project_id"`
+	Key       string `db:"key" json:"key"`
+	Name      string `db:"name" json:"name"`
+	Enabled   bool   `db:"enabled" json:"enabled"`
+}
+
+// ProjectEnabled reports whether tickets in the project can be looked up
+func (s PortalSettings) ProjectEnabled(projectID string) bool {
+	for _, p := range s.Projects {
+		if p.ProjectID == projectID {
+			return p.Enabled
+		}
+	}
+	return false
+}
+
+// DisplayTitle returns the portal title, or shopName when none is set
+func (s PortalSettings) DisplayTitle(shopName string) string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return shopName
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Project groups tickets within a tenant, e.g. a "Boots" or "Bags" bench
+type Project struct {
+	ID                   string    `db:"id" json:"id"`
+	TenantID             string    `db:"tenant_id" json:"tenant_id"`
+	Key                  string    `db:"key" json:"key"`
+	Name                 string    `db:"name" json:"name"`
+	Description          string    `db:"description" json:"description"`
+	IsArchived           bool      `db:"is_archived" json:"is_archived"`
+	CreatedAt            time.Time `db:"created_at" json:"created_at"`
+	DefaultRequestTypeID *string   `db:"default_request_type_id" json:"default_request_type_id,omitempty"`
+}
+
+// ProjectMember is a user who may work in a project, stored in project_memberships
+type ProjectMember struct {
+	ProjectID string    `db:"project_id" json:"project_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// RequestType is a kind of ticket a project takes, stored in request_types
+type RequestType struct {
+	ID          string `db:"id" json:"id"`
+	TenantID    string `db:"tenant_id" json:"tenant_id"`
+	ProjectID   string `db:"project_id" json:"project_id"`
+	Key         string `db:"key" json:"key"`
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+	SortOrder   int    `db:"sort_order" json:"sort_order"`
+
+	Fields []RequestTypeField `db:"-" json:"fields,omitempty"`
+}
+
+// RequestTypeField is a custom field on a request type's form, stored in
+// request_type_fields
+type RequestTypeField struct {
+	CustomField
+	SortOrder int  `db:"sort_order" json:"sort_order"`
+	Required  bool `db:"required" json:"required"`
+	// RequesterVisible shows the field to customers as well as staff
+	RequesterVisible bool `db:"requester_visible" json:"requester_visible"`
+}
+
+// HasOption reports whether value is one of the field's choices
+func (f RequestTypeField) HasOption(value string) bool {
+	for _, option := range f.Options {
+		if option.Value == value {
+			return true
+		}
+	}
+	return false
+}
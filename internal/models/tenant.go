@@ -0,0 +1,8 @@
+package models
+
+// Tenant is one shop using FlexSupport, stored in tenants
+type Tenant struct {
+	ID   string `db:"id" json:"id"`
+	Slug string `db:"slug" json:"slug"`
+	Name string `db:"name" json:"name"`
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Status string
 
@@ -38,22 +43,41 @@ const (
 	Other ItemType = "other"
 )
 
+// ItemTypes lists the item types a ticket can be opened for
+var ItemTypes = []ItemType{Boot, Shoe, Bag, Other}
+
+// Priorities lists the ticket priorities from lowest to highest
+var Priorities = []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+
 // Ticket represents a repair ticket in the system
 type Ticket struct {
-	ID          int64    `db:"id" json:"id"`
-	Status      Status   `db:"status" json:"status"`
-	Priority    Priority `db:"priority" json:"priority"` // low, normal, high, urgent
-	ExternalTag string   `db:"external_tag" json:"external_tag"`
+	ID            string   `db:"id" json:"id"`
+	TenantID      string   `db:"tenant_id" json:"tenant_id"`
+	ProjectID     string   `db:"project_id" json:"project_id"`
+	ProjectKey    string   `db:"project_key" json:"project_key"`
+	RequestTypeID string   `db:"request_type_id" json:"request_type_id"`
+	Number        int64    `db:"ticket_number" json:"ticket_number"`
+	Title         string   `db:"title" json:"title"`
+	Status        Status   `db:"status" json:"status"`
+	Priority      Priority `db:"priority" json:"priority"` // low, normal, high, urgent
+	ExternalTag   string   `db:"external_tag" json:"external_tag"`
 
-	// Customer information
-	CustomerName  string `db:"customer_name" json:"customer_name"`
-	CustomerPhone string `db:"customer_phone" json:"customer_phone"`
-	CustomerEmail string `db:"customer_email" json:"customer_email"`
+	// Status details joined from ticket_statuses
+	StatusLabel    string         `db:"status_label" json:"status_label"`
+	StatusColour   string         `db:"status_colour" json:"status_colour"`
+	StatusCategory StatusCategory `db:"status_category" json:"status_category"`
+
+	// Customer information, as given on this ticket
+	CustomerID    *string `db:"customer_id" json:"customer_id,omitempty"`
+	CustomerName  string  `db:"customer_name" json:"customer_name"`
+	CustomerPhone string  `db:"customer_phone" json:"customer_phone"`
+	CustomerEmail string  `db:"customer_email" json:"customer_email"`
 
 	// Item information
 	ItemType     ItemType `db:"item_type" json:"item_type"`
 	ItemBrand    string   `db:"item_brand" json:"item_brand"`
 	ItemModel    string   `db:"item_model" json:"item_model"`
+	ItemDetails  string   `db:"item_details" json:"item_details"` // describes the item when ItemType is Other
 	SerialNumber string   `db:"serial_number" json:"serial_number"`
 
 	// Repair details
@@ -62,53 +86,97 @@ type Ticket struct {
 	EstimatedCost    float64 `db:"estimated_cost" json:"estimated_cost"`
 
 	// Assignment and scheduling
-	AssignedTo string    `db:"assigned_to" json:"assigned_to"`
-	DueDate    time.Time `db:"due_date" json:"due_date"`
+	AssignedToUserID *string    `db:"assigned_to_user_id" json:"assigned_to_user_id,omitempty"`
+	AssignedTo       string     `db:"assigned_to" json:"assigned_to"`
+	DueDate          *time.Time `db:"due_date" json:"due_date,omitempty"`
 
 	// Metadata
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
-	CreatedBy string    `db:"created_by" json:"created_by"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+	ClosedAt        *time.Time `db:"closed_at" json:"closed_at,omitempty"`
+	CreatedByUserID *string    `db:"created_by_user_id" json:"created_by_user_id,omitempty"`
+	CreatedBy       string     `db:"created_by" json:"created_by"`
 
 	// Related data (loaded via joins)
-	Parts          []Part     `db:"-" json:"parts,omitempty"`
-	Notes          []WorkNote `db:"-" json:"notes,omitempty"`
-	TotalPartsCost float64    `db:"-" json:"total_parts_cost"`
+	Parts          []Part       `db:"-" json:"parts,omitempty"`
+	Notes          []WorkNote   `db:"-" json:"notes,omitempty"`
+	Fields         []FieldValue `db:"-" json:"fields,omitempty"`
+	TotalPartsCost float64      `db:"total_parts_cost" json:"total_parts_cost"`
 }
 
-// Part represents a replacement part or material used in a repair
+// Part represents a replacement part or material used in a repair, stored in ticket_parts
 type Part struct {
-	ID       int64     `json:"id"`
-	TicketID int64     `json:"ticket_id"`
-	Name     string    `json:"name"`
-	Quantity int       `json:"quantity"`
-	Cost     float64   `json:"cost"`
-	AddedAt  time.Time `json:"added_at"`
-	AddedBy  string    `json:"added_by"`
+	ID            string    `db:"id" json:"id"`
+	TenantID      string    `db:"tenant_id" json:"tenant_id"`
+	TicketID      string    `db:"ticket_id" json:"ticket_id"`
+	Name          string    `db:"name" json:"name"`
+	Quantity      int       `db:"quantity" json:"quantity"`
+	Cost          float64   `db:"unit_cost" json:"cost"` // per item
+	AddedByUserID *string   `db:"added_by_user_id" json:"added_by_user_id,omitempty"`
+	AddedBy       string    `db:"added_by" json:"added_by"`
+	AddedAt       time.Time `db:"created_at" json:"added_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// LineTotal returns the cost of the part times its quantity
+func (p Part) LineTotal() float64 {
+	return p.Cost * float64(p.Quantity)
 }
 
-// WorkNote represents a work log entry or note on a ticket
+// WorkNote represents a work log entry or note on a ticket, stored in ticket_comments
 type WorkNote struct {
-	ID        int64     `json:"id"`
-	TicketID  int64     `json:"ticket_id"`
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	Timestamp time.Time `json:"timestamp"`
+	ID           string    `db:"id" json:"id"`
+	TenantID     string    `db:"tenant_id" json:"tenant_id"`
+	TicketID     string    `db:"ticket_id" json:"ticket_id"`
+	Content      string    `db:"body" json:"content"`
+	IsInternal   bool      `db:"is_internal" json:"is_internal"`
+	AuthorUserID *string   `db:"author_user_id" json:"author_user_id,omitempty"`
+	Author       string    `db:"author" json:"author"`
+	Timestamp    time.Time `db:"created_at" json:"timestamp"`
+}
+
+// EventType identifies the kind of entry in a ticket's history
+type EventType string
+
+const (
+	EventCreated          EventType = "created"
+	EventUpdated          EventType = "updated"
+	EventStatusChanged    EventType = "status_changed"
+	EventCommentAdded     EventType = "comment_added"
+	EventCommentUpdated   EventType = "comment_updated"
+	EventPartAdded        EventType = "part_added"
+	EventPartUpdated      EventType = "part_updated"
+	EventPartRemoved      EventType = "part_removed"
+	EventNotificationSent EventType = "notification_sent"
+	EventCustomerMerged   EventType = "customer_merged"
+)
+
+// TicketEvent represents an entry in a ticket's audit history, stored in ticket_events
+type TicketEvent struct {
+	ID          string          `db:"id" json:"id"`
+	TenantID    string          `db:"tenant_id" json:"tenant_id"`
+	TicketID    string          `db:"ticket_id" json:"ticket_id"`
+	ActorUserID *string         `db:"actor_user_id" json:"actor_user_id,omitempty"`
+	Actor       string          `db:"actor" json:"actor"`
+	Type        EventType       `db:"type" json:"type"`
+	Payload     json.RawMessage `db:"payload" json:"payload"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
 }
 
-// Customer represents customer information (for future use)
-type Customer struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Phone       string    `json:"phone"`
-	Email       string    `json:"email"`
-	CreatedAt   time.Time `json:"created_at"`
-	TotalOrders int       `json:"total_orders"`
+// TicketFilter narrows a ticket listing
+type TicketFilter struct {
+	TenantID   string   // required
+	ProjectIDs []string // limits to these projects unless nil
+	CustomerID string
+	Search     string
+	Status     string
+	OpenOnly   bool // excludes statuses in the done category
+	Limit      int
 }
 
 // Technician represents a repair technician user
 type Technician struct {
-	ID          int64  `json:"id"`
+	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Email       string `json:"email"`
 	ActiveJobs  int    `json:"active_jobs"`
@@ -117,46 +185,70 @@ type Technician struct {
 
 // TicketStats represents dashboard statistics
 type TicketStats struct {
-	OpenTickets    int `json:"open_tickets"`
-	InProgress     int `json:"in_progress"`
-	Overdue        int `json:"overdue"`
-	CompletedToday int `json:"completed_today"`
+	OpenTickets    int `db:"open_tickets" json:"open_tickets"`
+	Waiting        int `db:"waiting" json:"waiting"`
+	Overdue        int `db:"overdue" json:"overdue"`
+	CompletedToday int `db:"completed_today" json:"completed_today"`
 }
 
 // StatusClass returns the Tailwind CSS class for the ticket status badge
 func (t *Ticket) StatusClass() string {
-	switch t.Status {
-	case StatusNew:
-		return "bg-blue-100 text-blue-800"
-	case StatusInProgress:
-		return "bg-yellow-100 text-yellow-800"
-	case StatusWaitingParts:
-		return "bg-orange-100 text-orange-800"
-	case StatusReady:
-		return "bg-green-100 text-green-800"
-	case StatusCompleted:
-		return "bg-gray-100 text-gray-800"
-	default:
-		return "bg-gray-100 text-gray-800"
+	if t.StatusColour == "" {
+		if status, ok := FindStatus(DefaultStatuses, t.Status); ok {
+			return status.BadgeClass()
+		}
 	}
+	return StatusColourClass(t.StatusColour)
 }
 
 // StatusDisplay returns a human-readable status string
 func (t *Ticket) StatusDisplay() string {
-	switch t.Status {
-	case StatusNew:
-		return "New"
-	case StatusInProgress:
-		return "In Progress"
-	case StatusWaitingParts:
-		return "Waiting for Parts"
-	case StatusReady:
-		return "Ready for Pickup"
-	case StatusCompleted:
-		return "Completed"
-	default:
-		return t.Status.String()
+	if t.StatusLabel != "" {
+		return t.StatusLabel
+	}
+	if status, ok := FindStatus(DefaultStatuses, t.Status); ok {
+		return status.Label
 	}
+	return t.Status.String()
+}
+
+// IsClosed reports whether the ticket's status is in the done category
+func (t *Ticket) IsClosed() bool {
+	if t.StatusCategory == "" {
+		status, ok := FindStatus(DefaultStatuses, t.Status)
+		return ok && status.IsDone()
+	}
+	return t.StatusCategory == CategoryDone
+}
+
+// SetStatus moves the ticket to status and copies its display details
+func (t *Ticket) SetStatus(status TicketStatus) {
+	t.Status = status.Key
+	t.StatusLabel = status.Label
+	t.StatusColour = status.Colour
+	t.StatusCategory = status.Category
+}
+
+// Key returns the human-readable ticket key, e.g. REPAIR-1042
+func (t *Ticket) Key() string {
+	if t.ProjectKey == "" {
+		return strconv.FormatInt(t.Number, 10)
+	}
+	return t.ProjectKey + "-" + strconv.FormatInt(t.Number, 10)
+}
+
+// ParseTicketKey splits a key such as "REPAIR-1042" into its project key and
+// number. Project keys may themselves contain dashes, so the split is on the last one.
+func ParseTicketKey(key string) (projectKey string, number int64, ok bool) {
+	i := strings.LastIndexByte(key, '-')
+	if i <= 0 || i == len(key)-1 {
+		return "", 0, false
+	}
+	number, err := strconv.ParseInt(key[i+1:], 10, 64)
+	if err != nil || number <= 0 {
+		return "", 0, false
+	}
+	return key[:i], number, true
 }
 
 // TotalCost calculates the total cost including parts and estimated labor
@@ -166,5 +258,44 @@ func (t *Ticket) TotalCost() float64 {
 
 // IsOverdue checks if the ticket is past its due date
 func (t *Ticket) IsOverdue() bool {
-	return time.Now().After(t.DueDate) && t.Status != "completed"
+	return t.DueDate != nil && time.Now().After(*t.DueDate) && !t.IsClosed()
+}
+
+// DueDateDisplay formats the due date with layout, or returns "" when none is set
+func (t *Ticket) DueDateDisplay(layout string) string {
+	if t.DueDate == nil {
+		return ""
+	}
+	return t.DueDate.Format(layout)
+}
+
+// ItemSummary describes the item being repaired, e.g. "boot - Danner Mountain Light"
+func (t *Ticket) ItemSummary() string {
+	item := strings.TrimSpace(t.ItemBrand + " " + t.ItemModel)
+	if t.ItemType == Other && t.ItemDetails != "" {
+		item = strings.TrimSpace(t.ItemDetails + " " + item)
+	}
+	switch {
+	case t.ItemType == "":
+		return item
+	case item == "":
+		return string(t.ItemType)
+	default:
+		return string(t.ItemType) + " - " + item
+	}
+}
+
+// DefaultTitle derives a ticket title from the item and customer when none was given
+func (t *Ticket) DefaultTitle() string {
+	title := t.ItemSummary()
+	if t.CustomerName != "" {
+		if title == "" {
+			return t.CustomerName
+		}
+		return title + " for " + t.CustomerName
+	}
+	if title == "" {
+		return "Repair ticket"
+	}
+	return title
 }
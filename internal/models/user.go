@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// User is a person who can sign in, stored in users. Users are global; what
+// they can reach is decided by their tenant_memberships.
+type User struct {
+	ID            string     `db:"id" json:"id"`
+	Name          string     `db:"name" json:"name"`
+	Email         string     `db:"email" json:"email"`
+	EmailVerified bool       `db:"email_verified" json:"email_verified"`
+	PasswordHash  string     `db:"password_hash" json:"-"`
+	IsSystemAdmin bool       `db:"is_system_admin" json:"is_system_admin"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	LastLoginAt   *time.Time `db:"last_login_at" json:"last_login_at,omitempty"`
+}
+
+// Membership statuses in tenant_memberships
+const (
+	MembershipActive   = "active"
+	MembershipInvited  = "invited"
+	MembershipDisabled = "disabled"
+)
+
+// Session is a signed-in browser, stored in sessions. ID is the SHA-256 of the
+// cookie token, so a leaked table cannot be replayed.
+type Session struct {
+	ID         string    `db:"id" json:"-"`
+	UserID     string    `db:"user_id" json:"user_id"`
+	TenantID   string    `db:"tenant_id" json:"tenant_id"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	IPAddress  string    `db:"ip_address" json:"ip_address"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expires_at"`
+}
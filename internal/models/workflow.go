@@ -0,0 +1,121 @@
+package models
+
+type StatusCategory string
+
+const (
+	CategoryOpen    StatusCategory = "open"
+	CategoryWaiting StatusCategory = "waiting"
+	CategoryDone    StatusCategory = "done"
+)
+
+// TicketStatus is a tenant-defined status, stored in ticket_statuses. A row
+// with a ProjectID overrides the tenant-wide row with the same key.
+type TicketStatus struct {
+	ID         string         `db:"id" json:"id"`
+	TenantID   string         `db:"tenant_id" json:"tenant_id"`
+	ProjectID  *string        `db:"project_id" json:"project_id,omitempty"`
+	Key        Status         `db:"key" json:"key"`
+	Label      string         `db:"label" json:"label"`
+	Colour     string         `db:"colour" json:"colour"`
+	Category   StatusCategory `db:"category" json:"category"`
+	SortOrder  int            `db:"sort_order" json:"sort_order"`
+	IsArchived bool           `db:"is_archived" json:"is_archived"`
+	// NotifyCustomer sends the customer a message when a ticket enters the status
+	NotifyCustomer bool `db:"notify_customer" json:"notify_customer"`
+}
+
+// IsDone reports whether tickets in this status count as closed
+func (s TicketStatus) IsDone() bool {
+	return s.Category == CategoryDone
+}
+
+// BadgeClass returns the Tailwind CSS classes for the status colour
+func (s TicketStatus) BadgeClass() string {
+	return StatusColourClass(s.Colour)
+}
+
+// StatusColours lists the colours a status can use. The classes are spelled
+// out in full so Tailwind keeps them in the build.
+var StatusColours = map[string]string{
+	"gray":   "bg-gray-100 text-gray-800",
+	"red":    "bg-red-100 text-red-800",
+	"orange": "bg-orange-100 text-orange-800",
+	"amber":  "bg-amber-100 text-amber-800",
+	"yellow": "bg-yellow-100 text-yellow-800",
+	"green":  "bg-green-100 text-green-800",
+	"teal":   "bg-teal-100 text-teal-800",
+	"blue":   "bg-blue-100 text-blue-800",
+	"indigo": "bg-indigo-100 text-indigo-800",
+	"purple": "bg-purple-100 text-purple-800",
+	"pink":   "bg-pink-100 text-pink-800",
+}
+
+// StatusColourClass returns the badge classes for a colour, falling back to gray
+func StatusColourClass(colour string) string {
+	if class, ok := StatusColours[colour]; ok {
+		return class
+	}
+	return StatusColours["gray"]
+}
+
+// DefaultStatuses is used by tenants that have no rows in ticket_statuses
+var DefaultStatuses = []TicketStatus{
+	{Key: StatusNew, Label: "New", Colour: "blue", Category: CategoryOpen, SortOrder: 10},
+	{Key: StatusInProgress, Label: "In Progress", Colour: "yellow", Category: CategoryOpen, SortOrder: 20},
+	{Key: StatusWaitingParts, Label: "Waiting for Parts", Colour: "orange", Category: CategoryWaiting, SortOrder: 30},
+	{Key: StatusReady, Label: "Ready for Pickup", Colour: "green", Category: CategoryWaiting, SortOrder: 40, NotifyCustomer: true},
+	{Key: StatusCompleted, Label: "Completed", Colour: "gray", Category: CategoryDone, SortOrder: 50},
+}
+
+// FindStatus returns the status with the given key
+func FindStatus(statuses []TicketStatus, key Status) (TicketStatus, bool) {
+	for _, s := range statuses {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return TicketStatus{}, false
+}
+
+// StatusTransition is one allowed status move in a project's workflow, stored
+// in project_status_transitions
+type StatusTransition struct {
+	ProjectID string `db:"project_id" json:"project_id"`
+	From      Status `db:"from_status" json:"from"`
+	To        Status `db:"to_status" json:"to"`
+}
+
+// DefaultStatusTransitions is the workflow used by projects that have not
+// configured their own: new → in_progress → waiting_parts → ready → completed,
+// with work resumable from waiting_parts and ready, and completed tickets reopenable
+var DefaultStatusTransitions = []StatusTransition{
+	{From: StatusNew, To: StatusInProgress},
+	{From: StatusInProgress, To: StatusWaitingParts},
+	{From: StatusInProgress, To: StatusReady},
+	{From: StatusWaitingParts, To: StatusInProgress},
+	{From: StatusReady, To: StatusInProgress},
+	{From: StatusReady, To: StatusCompleted},
+	{From: StatusCompleted, To: StatusInProgress},
+}
+
+// NextStatuses returns the statuses reachable from the given status, in
+// workflow order
+func NextStatuses(transitions []StatusTransition, from Status) []Status {
+	next := make([]Status, 0)
+	for _, t := range transitions {
+		if t.From == from {
+			next = append(next, t.To)
+		}
+	}
+	return next
+}
+
+// CanTransition reports whether the workflow allows moving from one status to another
+func CanTransition(transitions []StatusTransition, from, to Status) bool {
+	for _, t := range transitions {
+		if t.From == from && t.To == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+// Package notify tells customers when their ticket reaches a status the
+// tenant has flagged, by email and, when the tenant has set it up, text
+// message, using the tenant's wording
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"flexsupport/internal/mail"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/sms"
+)
+
+// SMSIntegration is the name of the sms integration texts are sent through
+const SMSIntegration = "default"
+
+// EventStore records sent notifications in the ticket's history
+type EventStore interface {
+	AddEvent(ctx context.Context, event *models.TicketEvent) error
+}
+
+type Notifier struct {
+	log           *slog.Logger
+	notifications ports.NotificationRepository
+	integrations  ports.IntegrationRepository
+	events        EventStore
+	mailer        mail.Sender
+	texts         sms.Provider
+}
+
+func NewNotifier(
+	log *slog.Logger,
+	notifications ports.NotificationRepository,
+	integrations ports.IntegrationRepository,
+	events EventStore,
+	mailer mail.Sender,
+	texts sms.Provider,
+) *Notifier {
+	return &Notifier{
+		log:           log.With("Service", "Notify"),
+		notifications: notifications,
+		integrations:  integrations,
+		events:        events,
+		mailer:        mailer,
+		texts:         texts,
+	}
+}
+
+// ChannelStatus is whether one of a customer's addresses gets status updates
+type ChannelStatus struct {
+	Channel models.NotificationChannel
+	Address string
+	// StoppedBy says who stopped messages to the address; empty when they are on
+	StoppedBy models.OptOutSource
+}
+
+// StatusChanged messages the customer if the ticket's new status is flagged
+// for it. Failures are logged rather than returned, since the status change
+// itself has already happened.
+func (n *Notifier) StatusChanged(ctx context.Context, ticket models.Ticket, status models.TicketStatus) {
+	if !status.NotifyCustomer {
+		return
+	}
+	if ticket.CustomerEmail != "" {
+		if err := n.email(ctx, ticket); err != nil {
+			n.log.Error("failed to notify customer", "ticket", ticket.Key(), "channel", models.ChannelEmail, "error", err)
+		}
+	}
+	if ticket.CustomerPhone != "" {
+		if err := n.text(ctx, ticket); err != nil {
+			n.log.Error("failed to notify customer", "ticket", ticket.Key(), "channel", models.ChannelSMS, "error", err)
+		}
+	}
+}
+
+func (n *Notifier) email(ctx context.Context, ticket models.Ticket) error {
+	tenant, ok := mw.TenantFromContext(ctx)
+	if !ok {
+		return mw.ErrNoTenant
+	}
+	address := models.NormalizeEmail(ticket.CustomerEmail)
+	if stopped, err := n.stopped(ctx, tenant.ID, models.ChannelEmail, address); err != nil || stopped != "" {
+		return err
+	}
+	template, err := n.template(ctx, tenant.ID, ticket.Status, models.ChannelEmail)
+	if err != nil {
+		return err
+	}
+	subject, body := template.Fill(tenant.Name, ticket)
+	msg, err := mail.Render(ctx, address, subject, customerEmail(body, tenant.Name))
+	if err != nil {
+		return err
+	}
+	if err := n.mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+	return n.record(ctx, ticket, models.ChannelEmail, address)
+}
+
+func (n *Notifier) text(ctx context.Context, ticket models.Ticket) error {
+	tenant, ok := mw.TenantFromContext(ctx)
+	if !ok {
+		return mw.ErrNoTenant
+	}
+	cfg, enabled, err := n.SMS(ctx, tenant.ID)
+	if err != nil || !enabled {
+		return err
+	}
+	phone, err := sms.NormalizePhone(ticket.CustomerPhone, cfg.DefaultCountryCode)
+	if err != nil {
+		return fmt.Errorf("customer phone %q: %w", ticket.CustomerPhone, err)
+	}
+	if stopped, err := n.stopped(ctx, tenant.ID, models.ChannelSMS, phone); err != nil || stopped != "" {
+		return err
+	}
+	template, err := n.template(ctx, tenant.ID, ticket.Status, models.ChannelSMS)
+	if err != nil {
+		return err
+	}
+	_, body := template.Fill(tenant.Name, ticket)
+	if err := n.texts.Send(ctx, phone, body); err != nil {
+		return err
+	}
+	return n.record(ctx, ticket, models.ChannelSMS, phone)
+}
+
+// SMS returns the tenant's sms settings and whether text messages are on
+func (n *Notifier) SMS(ctx context.Context, tenantID string) (models.SMSConfig, bool, error) {
+	integration, err := n.integrations.GetIntegration(ctx, tenantID, models.IntegrationSMS, SMSIntegration)
+	if errors.Is(err, ports.ErrNotFound) {
+		return models.SMSConfig{}, false, nil
+	}
+	if err != nil {
+		return models.SMSConfig{}, false, err
+	}
+	cfg, err := integration.SMS()
+	if err != nil {
+		return models.SMSConfig{}, false, fmt.Errorf("invalid sms config: %w", err)
+	}
+	return cfg, integration.Enabled, nil
+}
+
+// stopped returns who stopped messages on the channel to the address, or ""
+func (n *Notifier) stopped(ctx context.Context, tenantID string, channel models.NotificationChannel, address string) (models.OptOutSource, error) {
+	optOut, err := n.notifications.GetOptOut(ctx, tenantID, channel, address)
+	if errors.Is(err, ports.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return optOut.Source, nil
+}
+
+// template returns the tenant's wording for the status, or the built-in one
+func (n *Notifier) template(ctx context.Context, tenantID string, status models.Status, channel models.NotificationChannel) (models.NotificationTemplate, error) {
+	template, err := n.notifications.GetNotificationTemplate(ctx, tenantID, status, channel)
+	if errors.Is(err, ports.ErrNotFound) {
+		return models.DefaultNotificationTemplate(status, channel), nil
+	}
+	return template, err
+}
+
+// record adds a notification_sent event to the ticket's history
+func (n *Notifier) record(ctx context.Context, ticket models.Ticket, channel models.NotificationChannel, to string) error {
+	payload, err := json.Marshal(map[string]string{
+		"channel": string(channel),
+		"to":      to,
+		"status":  string(ticket.Status),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	event := &models.TicketEvent{
+		TenantID:    ticket.TenantID,
+		TicketID:    ticket.ID,
+		ActorUserID: mw.Actor(ctx),
+		Type:        models.EventNotificationSent,
+		Payload:     payload,
+	}
+	if err := n.events.AddEvent(ctx, event); err != nil {
+		return err
+	}
+	n.log.Info("Notified customer", "ticket", ticket.Key(), "channel", channel)
+	return nil
+}
+
+// Channels returns the addresses status updates to the ticket's customer go
+// to, and whether each has been stopped
+func (n *Notifier) Channels(ctx context.Context, ticket models.Ticket) ([]ChannelStatus, error) {
+	channels := make([]ChannelStatus, 0, 2)
+	if ticket.CustomerEmail != "" {
+		channels = append(channels, ChannelStatus{Channel: models.ChannelEmail, Address: models.NormalizeEmail(ticket.CustomerEmail)})
+	}
+	if ticket.CustomerPhone != "" {
+		cfg, enabled, err := n.SMS(ctx, ticket.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		if phone, err := sms.NormalizePhone(ticket.CustomerPhone, cfg.DefaultCountryCode); enabled && err == nil {
+			channels = append(channels, ChannelStatus{Channel: models.ChannelSMS, Address: phone})
+		}
+	}
+	for i, c := range channels {
+		stopped, err := n.stopped(ctx, ticket.TenantID, c.Channel, c.Address)
+		if err != nil {
+			return nil, err
+		}
+		channels[i].StoppedBy = stopped
+	}
+	return channels, nil
+}
+
+// SetPaused pauses or resumes status updates to every address of the
+// ticket's customer. Customers who texted STOP stay opted out until they text
+// START.
+func (n *Notifier) SetPaused(ctx context.Context, ticket models.Ticket, paused bool) ([]ChannelStatus, error) {
+	channels, err := n.Channels(ctx, ticket)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range channels {
+		if err := n.notifications.SetOptOut(ctx, ticket.TenantID, c.Channel, c.Address, paused, models.OptOutStaff); err != nil {
+			return nil, err
+		}
+	}
+	n.log.Info("Changed customer notifications", "ticket", ticket.Key(), "paused", paused)
+	return n.Channels(ctx, ticket)
+}
+
+// SetOptOut records a customer's own opt-out or opt-in for the address
+func (n *Notifier) SetOptOut(ctx context.Context, channel models.NotificationChannel, address string, optOut bool) error {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := n.notifications.SetOptOut(ctx, tenantID, channel, address, optOut, models.OptOutCustomer); err != nil {
+		return err
+	}
+	n.log.Info("Customer changed notifications", "channel", channel, "opted_out", optOut)
+	return nil
+}
@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"flexsupport/internal/backoff"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/sms"
+)
+
+const (
+	// maxTextAttempts is how many times a text is tried before it is marked failed
+	maxTextAttempts = 8
+	// textClaimLease is how long a claimed text is hidden from other workers
+	textClaimLease = 5 * time.Minute
+	textBatchSize  = 20
+	// smsTimeout bounds how long one text waits on the sms provider
+	smsTimeout = 15 * time.Second
+)
+
+var (
+	errSMSDisabled = errors.New("sms is not enabled")
+	errOptedOut    = errors.New("number has opted out")
+)
+
+// TextWorker sends queued texts through each tenant's sms integration,
+// retrying failures with exponential backoff. The integration and the
+// customer's opt-out are checked again when each text is sent, so texts
+// queued before a STOP are not sent after it.
+type TextWorker struct {
+	log       *slog.Logger
+	store     ports.TextOutboxRepository
+	notifier  *Notifier
+	providers sms.Providers
+	interval  time.Duration
+}
+
+// NewTextWorker returns a worker that checks the outbox every interval
+func NewTextWorker(
+	log *slog.Logger,
+	store ports.TextOutboxRepository,
+	notifications ports.NotificationRepository,
+	integrations ports.IntegrationRepository,
+	providers sms.Providers,
+	interval time.Duration,
+) *TextWorker {
+	return &TextWorker{
+		log:       log.With("Worker", "SMS"),
+		store:     store,
+		notifier:  &Notifier{log: log, notifications: notifications, integrations: integrations},
+		providers: providers,
+		interval:  interval,
+	}
+}
+
+// Run sends queued texts until ctx is cancelled
+func (w *TextWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.deliver(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends everything that is due, a batch at a time
+func (w *TextWorker) deliver(ctx context.Context) {
+	for ctx.Err() == nil {
+		texts, err := w.store.ClaimTexts(ctx, textBatchSize, textClaimLease)
+		if err != nil {
+			w.log.Error("failed to claim texts", "error", err)
+			return
+		}
+		for _, text := range texts {
+			w.send(ctx, text)
+		}
+		if len(texts) < textBatchSize {
+			return
+		}
+	}
+}
+
+func (w *TextWorker) send(ctx context.Context, text models.OutboxText) {
+	err := w.sendText(ctx, text)
+	if err == nil {
+		if err := w.store.MarkTextSent(ctx, text.ID); err != nil {
+			w.log.Error("failed to mark text sent", "text", text.ID, "error", err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if text.Attempts < maxTextAttempts && !permanent(err) {
+		at := time.Now().Add(backoff.Delay(text.Attempts))
+		retryAt = &at
+		w.log.Warn("failed to send text, will retry", "text", text.ID, "attempt", text.Attempts, "retry_at", at, "error", err)
+	} else {
+		w.log.Error("failed to send text, giving up", "text", text.ID, "attempt", text.Attempts, "error", err)
+	}
+	if err := w.store.MarkTextFailed(ctx, text.ID, err.Error(), retryAt); err != nil {
+		w.log.Error("failed to record text failure", "text", text.ID, "error", err)
+	}
+}
+
+// sendText looks up the tenant's integration as the tenant, so the
+// row-level security policies apply, and sends the text through it
+func (w *TextWorker) sendText(ctx context.Context, text models.OutboxText) error {
+	ctx = mw.WithTenant(ctx, models.Tenant{ID: text.TenantID})
+	cfg, enabled, err := w.notifier.SMS(ctx, text.TenantID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errSMSDisabled
+	}
+	if stopped, err := w.notifier.stopped(ctx, text.TenantID, models.ChannelSMS, text.To); err != nil {
+		return err
+	} else if stopped != "" {
+		return errOptedOut
+	}
+	provider, err := w.providers.New(cfg)
+	if err != nil {
+		return err
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, smsTimeout)
+	defer cancel()
+	return provider.Send(sendCtx, text.To, text.Body)
+}
+
+func permanent(err error) bool {
+	return errors.Is(err, errSMSDisabled) || errors.Is(err, errOptedOut) || sms.IsPermanent(err)
+}
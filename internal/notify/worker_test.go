@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/sms"
+)
+
+type fakeTextOutbox struct {
+	ports.TextOutboxRepository
+	queued []models.OutboxText
+	sent   []string
+	failed map[string]*time.Time
+}
+
+func newFakeTextOutbox() *fakeTextOutbox {
+	return &fakeTextOutbox{failed: map[string]*time.Time{}}
+}
+
+func (f *fakeTextOutbox) EnqueueText(ctx context.Context, text *models.OutboxText) error {
+	text.ID = text.To
+	f.queued = append(f.queued, *text)
+	return nil
+}
+
+func (f *fakeTextOutbox) ClaimTexts(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxText, error) {
+	texts := f.queued
+	f.queued = nil
+	for i := range texts {
+		texts[i].Attempts++
+	}
+	return texts, nil
+}
+
+func (f *fakeTextOutbox) MarkTextSent(ctx context.Context, id string) error {
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeTextOutbox) MarkTextFailed(ctx context.Context, id, reason string, retryAt *time.Time) error {
+	f.failed[id] = retryAt
+	return nil
+}
+
+type fakeIntegrations struct {
+	ports.IntegrationRepository
+	enabled bool
+	cfg     models.SMSConfig
+}
+
+func (f fakeIntegrations) GetIntegration(ctx context.Context, tenantID string, integrationType models.IntegrationType, name string) (models.Integration, error) {
+	if _, err := mw.TenantID(ctx); err != nil {
+		// without a tenant the row-level security policies hide every integration
+		return models.Integration{}, ports.ErrNotFound
+	}
+	config, err := json.Marshal(f.cfg)
+	if err != nil {
+		return models.Integration{}, err
+	}
+	return models.Integration{TenantID: tenantID, Enabled: f.enabled, Config: config}, nil
+}
+
+type fakeNotifications struct {
+	ports.NotificationRepository
+	optedOut map[string]bool
+}
+
+func (f fakeNotifications) GetOptOut(ctx context.Context, tenantID string, channel models.NotificationChannel, address string) (models.OptOut, error) {
+	if !f.optedOut[address] {
+		return models.OptOut{}, ports.ErrNotFound
+	}
+	return models.OptOut{TenantID: tenantID, Channel: channel, Address: address, Source: models.OptOutCustomer}, nil
+}
+
+func (f fakeNotifications) GetNotificationTemplate(ctx context.Context, tenantID string, status models.Status, channel models.NotificationChannel) (models.NotificationTemplate, error) {
+	return models.NotificationTemplate{}, ports.ErrNotFound
+}
+
+type fakeEvents struct {
+	events []models.TicketEvent
+}
+
+func (f *fakeEvents) AddEvent(ctx context.Context, event *models.TicketEvent) error {
+	f.events = append(f.events, *event)
+	return nil
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestStatusChangedQueuesText(t *testing.T) {
+	outbox := newFakeTextOutbox()
+	events := &fakeEvents{}
+	integrations := fakeIntegrations{enabled: true, cfg: models.SMSConfig{Provider: models.SMSProviderTwilio, DefaultCountryCode: "1"}}
+	notifier := NewNotifier(discard, fakeNotifications{}, integrations, events, nil, sms.NewOutbox(outbox))
+	ctx := mw.WithTenant(context.Background(), models.Tenant{ID: "tenant-1", Name: "Shop"})
+
+	ticket := models.Ticket{ID: "ticket-1", TenantID: "tenant-1", Status: models.StatusReady, CustomerPhone: "(541) 555-0123"}
+	notifier.StatusChanged(ctx, ticket, models.TicketStatus{Key: models.StatusReady, NotifyCustomer: true})
+
+	if len(outbox.queued) != 1 || outbox.queued[0].To != "+15415550123" || outbox.queued[0].TenantID != "tenant-1" {
+		t.Fatalf("queued %+v, want one text to +15415550123", outbox.queued)
+	}
+	if len(events.events) != 1 || events.events[0].Type != models.EventNotificationSent {
+		t.Errorf("recorded %+v, want one notification_sent event", events.events)
+	}
+}
+
+func TestTextWorker(t *testing.T) {
+	twilio := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.PostForm.Get("To") {
+		case "+15415550400":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number"}`))
+		case "+15415550500":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer twilio.Close()
+	host, _ := url.Parse(twilio.URL)
+	providers := sms.Providers{Client: twilio.Client(), AllowedHosts: []string{host.Host}}
+	cfg := models.SMSConfig{
+		Provider:   models.SMSProviderTwilio,
+		AccountSID: "AC123",
+		AuthToken:  "secret",
+		FromNumber: "+15415550100",
+		BaseURL:    twilio.URL,
+	}
+
+	tests := []struct {
+		name      string
+		to        string
+		enabled   bool
+		cfg       models.SMSConfig
+		sent      bool
+		willRetry bool
+	}{
+		{"sent", "+15415550123", true, cfg, true, false},
+		{"opted out since queued", "+15415550199", true, cfg, false, false},
+		{"integration turned off", "+15415550123", false, cfg, false, false},
+		{"rejected number", "+15415550400", true, cfg, false, false},
+		{"provider down", "+15415550500", true, cfg, false, true},
+		{"fake provider in production", "+15415550123", true, models.SMSConfig{Provider: models.SMSProviderFake}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outbox := newFakeTextOutbox()
+			outbox.queued = []models.OutboxText{{ID: tt.to, TenantID: "tenant-1", To: tt.to, Body: "Ready"}}
+			notifications := fakeNotifications{optedOut: map[string]bool{"+15415550199": true}}
+			worker := NewTextWorker(discard, outbox, notifications, fakeIntegrations{enabled: tt.enabled, cfg: tt.cfg}, providers, time.Minute)
+
+			worker.deliver(context.Background())
+
+			if sent := len(outbox.sent) == 1; sent != tt.sent {
+				t.Fatalf("sent = %v, want %v (failed: %v)", sent, tt.sent, outbox.failed)
+			}
+			if tt.sent {
+				return
+			}
+			retryAt, failed := outbox.failed[tt.to]
+			if !failed {
+				t.Fatalf("text was neither sent nor marked failed")
+			}
+			if willRetry := retryAt != nil; willRetry != tt.willRetry {
+				t.Errorf("will retry = %v, want %v", willRetry, tt.willRetry)
+			}
+		})
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if !permanent(errOptedOut) || !permanent(sms.ErrFakeProvider) {
+		t.Error("opt-outs and refused providers should not be retried")
+	}
+	if permanent(errors.New("connection refused")) {
+		t.Error("network errors should be retried")
+	}
+}
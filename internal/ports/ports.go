@@ -1,4 +1,145 @@
 package ports
 
 import (
+	"context"
+	"errors"
+	"time"
+
+	"flexsupport/internal/models"
 )
+
+// ErrNotFound is returned by repositories when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a conditional write lost a race with another update
+var ErrConflict = errors.New("conflict")
+
+type TicketRepository interface {
+	ListTickets(ctx context.Context, filter models.TicketFilter) ([]models.Ticket, error)
+	CountTickets(ctx context.Context, filter models.TicketFilter) (int, error)
+	TicketStats(ctx context.Context, filter models.TicketFilter) (models.TicketStats, error)
+	GetTicket(ctx context.Context, tenantID, id string) (models.Ticket, error)
+	GetTicketByKey(ctx context.Context, tenantID, projectKey string, number int64) (models.Ticket, error)
+	CreateTicket(ctx context.Context, ticket *models.Ticket) error
+	UpdateTicket(ctx context.Context, ticket *models.Ticket) error
+	ChangeTicketStatus(ctx context.Context, ticket *models.Ticket, from models.Status, event *models.TicketEvent) error
+
+	ListParts(ctx context.Context, ticketID string) ([]models.Part, error)
+	AddPart(ctx context.Context, part *models.Part) error
+	UpdatePart(ctx context.Context, part *models.Part, actorUserID *string) error
+	DeletePart(ctx context.Context, ticketID, partID string, actorUserID *string) error
+
+	ListComments(ctx context.Context, ticketID string) ([]models.WorkNote, error)
+	ListPublicComments(ctx context.Context, ticketID string) ([]models.WorkNote, error)
+	AddComment(ctx context.Context, note *models.WorkNote) error
+	SetCommentVisibility(ctx context.Context, ticketID, commentID string, internal bool) (models.WorkNote, error)
+
+	ListEvents(ctx context.Context, ticketID string) ([]models.TicketEvent, error)
+	AddEvent(ctx context.Context, event *models.TicketEvent) error
+
+	ListCustomFields(ctx context.Context, tenantID string) ([]models.CustomField, error)
+	ListFieldValues(ctx context.Context, ticketID string) ([]models.FieldValue, error)
+	SetFieldValues(ctx context.Context, tenantID, ticketID string, values []models.FieldValue) error
+}
+
+type CustomerRepository interface {
+	ListCustomers(ctx context.Context, filter models.CustomerFilter) ([]models.Customer, error)
+	GetCustomer(ctx context.Context, tenantID, id string, projectIDs []string) (models.Customer, error)
+	FindDuplicateCustomers(ctx context.Context, tenantID string, limit int) ([]models.DuplicateCustomers, error)
+	MergeCustomers(ctx context.Context, merge *models.CustomerMerge) error
+}
+
+type ProjectRepository interface {
+	ListProjects(ctx context.Context, tenantID string) ([]models.Project, error)
+	GetProject(ctx context.Context, tenantID, id string) (models.Project, error)
+	ListStatusTransitions(ctx context.Context, projectID string) ([]models.StatusTransition, error)
+	ListStatuses(ctx context.Context, tenantID, projectID string) ([]models.TicketStatus, error)
+	CreateStatus(ctx context.Context, status *models.TicketStatus) error
+	UpdateStatus(ctx context.Context, status *models.TicketStatus) error
+	ReorderStatuses(ctx context.Context, tenantID string, ids []string) error
+	ListUserProjects(ctx context.Context, tenantID, userID string) ([]models.Project, error)
+	ListProjectMembers(ctx context.Context, tenantID, projectID string) ([]models.ProjectMember, error)
+	AddProjectMember(ctx context.Context, tenantID, projectID, userID string) error
+	RemoveProjectMember(ctx context.Context, tenantID, projectID, userID string) error
+}
+
+type RequestTypeRepository interface {
+	ListRequestTypes(ctx context.Context, tenantID string) ([]models.RequestType, error)
+	GetRequestType(ctx context.Context, tenantID, id string) (models.RequestType, error)
+}
+
+// PortalRepository reads and saves the public customer portal settings
+type PortalRepository interface {
+	GetPortalSettings(ctx context.Context, tenantID string) (models.PortalSettings, error)
+	SavePortalSettings(ctx context.Context, settings *models.PortalSettings) error
+}
+
+type UserRepository interface {
+	GetUser(ctx context.Context, id string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	AddMembership(ctx context.Context, tenantID, userID string) error
+	IsActiveMember(ctx context.Context, tenantID, userID string) (bool, error)
+	MembershipStatus(ctx context.Context, tenantID, userID string) (string, error)
+	ListMembers(ctx context.Context, tenantID string) ([]models.User, error)
+	RecordLogin(ctx context.Context, userID string) error
+	SetPassword(ctx context.Context, userID, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID string) error
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	LinkIdentity(ctx context.Context, identity *models.UserIdentity) error
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionUser(ctx context.Context, tenantID, sessionID string) (models.User, error)
+	DeleteSession(ctx context.Context, sessionID string) error
+	DeleteUserSessions(ctx context.Context, userID string) error
+}
+
+type IntegrationRepository interface {
+	GetIntegration(ctx context.Context, tenantID string, integrationType models.IntegrationType, name string) (models.Integration, error)
+	SaveIntegration(ctx context.Context, integration *models.Integration) error
+}
+
+type RoleRepository interface {
+	UserPermissions(ctx context.Context, tenantID, userID string) ([]models.Permission, error)
+	ListRoles(ctx context.Context, tenantID string) ([]models.Role, error)
+	GetRoleByName(ctx context.Context, tenantID, name string) (models.Role, error)
+	AddMemberRole(ctx context.Context, tenantID, userID, roleID string) error
+}
+
+type InvitationRepository interface {
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+	ListInvitations(ctx context.Context, tenantID string) ([]models.Invitation, error)
+	GetInvitationByToken(ctx context.Context, tenantID, tokenHash string) (models.Invitation, error)
+	RevokeInvitation(ctx context.Context, tenantID, id string) error
+	AcceptInvitation(ctx context.Context, invitation models.Invitation, passwordHash string) error
+}
+
+// OutboxRepository queues outgoing email. ClaimMail, MarkMailSent and
+// MarkMailFailed are for the delivery worker and work across every tenant.
+type OutboxRepository interface {
+	EnqueueMail(ctx context.Context, mail *models.OutboxMail) error
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error)
+	MarkMailSent(ctx context.Context, id string) error
+	MarkMailFailed(ctx context.Context, id, reason string, retryAt *time.Time) error
+}
+
+// TextOutboxRepository queues outgoing text messages. ClaimTexts,
+// MarkTextSent and MarkTextFailed are for the delivery worker and work across
+// every tenant.
+type TextOutboxRepository interface {
+	EnqueueText(ctx context.Context, text *models.OutboxText) error
+	ClaimTexts(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxText, error)
+	MarkTextSent(ctx context.Context, id string) error
+	MarkTextFailed(ctx context.Context, id, reason string, retryAt *time.Time) error
+}
+
+type NotificationRepository interface {
+	GetNotificationTemplate(ctx context.Context, tenantID string, status models.Status, channel models.NotificationChannel) (models.NotificationTemplate, error)
+	ListNotificationTemplates(ctx context.Context, tenantID string) ([]models.NotificationTemplate, error)
+	SaveNotificationTemplate(ctx context.Context, template *models.NotificationTemplate) error
+	SetStatusNotify(ctx context.Context, tenantID string, status models.Status, notify bool) error
+	GetOptOut(ctx context.Context, tenantID string, channel models.NotificationChannel, address string) (models.OptOut, error)
+	SetOptOut(ctx context.Context, tenantID string, channel models.NotificationChannel, address string, optOut bool, source models.OptOutSource) error
+}
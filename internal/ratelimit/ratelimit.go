@@ -0,0 +1,71 @@
+// Package ratelimit counts requests per key in fixed windows, in memory. Each
+// instance of the app keeps its own counts.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows up to limit events per key in each window
+type Limiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*counter
+	swept   time.Time
+}
+
+type counter struct {
+	start time.Time
+	count int
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*counter),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (l *Limiter) Allow(key string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) >= l.window {
+		l.sweep(now)
+	}
+	c, ok := l.windows[key]
+	if !ok || now.Sub(c.start) >= l.window {
+		c = &counter{start: now}
+		l.windows[key] = c
+	}
+	c.count++
+	return c.count <= l.limit
+}
+
+// Exceeded reports whether key has used up its limit in the current window,
+// without recording an event. Pair it with Allow to count only some events,
+// such as failures.
+func (l *Limiter) Exceeded(key string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.windows[key]
+	return ok && now.Sub(c.start) < l.window && c.count >= l.limit
+}
+
+// sweep drops finished windows so idle keys do not accumulate
+func (l *Limiter) sweep(now time.Time) {
+	for key, c := range l.windows {
+		if now.Sub(c.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.swept = now
+}
@@ -3,22 +3,47 @@ package router
 import (
 	"log/slog"
 	"net/http"
+	"time"
 
+	"flexsupport/internal/auth"
 	"flexsupport/internal/config"
+	db "flexsupport/internal/domain"
+	"flexsupport/internal/httputil"
+	"flexsupport/internal/mail"
 	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/notify"
+	"flexsupport/internal/sms"
 	"flexsupport/static"
 
 	// "net/http"
+	"flexsupport/internal/routes/account"
+	"flexsupport/internal/routes/admin"
 	"flexsupport/internal/routes/api"
+	"flexsupport/internal/routes/customers"
 	"flexsupport/internal/routes/dashboard"
+	"flexsupport/internal/routes/messaging"
+	"flexsupport/internal/routes/portal"
 	"flexsupport/internal/routes/tickets"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func NewRouter(log *slog.Logger, cfg *config.Config) *chi.Mux {
+func NewRouter(log *slog.Logger, cfg *config.Config, database *db.DB, texts sms.Providers) *chi.Mux {
 	r := chi.NewMux()
+	r.Use(httputil.RealIP(httputil.ParsePrefixes(cfg.TrustedProxies)))
+	// Tenants are resolved from the host; outside production /t/{slug}/ works too
+	tenants := mw.TenantMiddleware(db.NewTenantResolver(database, cfg.TenantCacheTTL), cfg.Environment != config.PROD)
+	// Identity providers are called while people wait to sign in
+	oidc := auth.NewOIDCClient(&http.Client{Timeout: 10 * time.Second})
+	signer := auth.NewSigner([]byte(cfg.SecretKey))
+	mailer := mail.NewOutbox(database)
+	notifier := notify.NewNotifier(log, database, database, database, mailer, sms.NewOutbox(database))
+	accounts := account.NewService(log, database, database, database, database, database, database, oidc, signer, mailer, cfg.SessionTTL)
+	sessions := mw.SessionMiddleware(accounts)
+	permissions := mw.PermissionMiddleware(accounts)
+	projects := mw.ProjectMiddleware(accounts)
 	// Dashboard
 
 	r.Group(func(r chi.Router) {
@@ -48,11 +73,45 @@ func NewRouter(log *slog.Logger, cfg *config.Config) *chi.Mux {
 			// mw.CSPMiddleware,
 			mw.Logging(log),
 			mw.TextHTMLMiddleware,
+			tenants,
+			sessions,
+			permissions,
+			projects,
 		)
-		dashboard.Mount(r, dashboard.NewHandler(log, dashboard.NewService(log)))
-		tickets.Mount(r, tickets.NewHandler(log, tickets.NewService(log)))
+		account.Mount(r, account.NewHandler(log, accounts, cfg.Environment == config.PROD))
+		r.Group(func(r chi.Router) {
+			r.Use(mw.RequireUser)
+			dashboard.Mount(r, dashboard.NewHandler(log, dashboard.NewService(log, database, database)))
+			tickets.Mount(r, tickets.NewHandler(log, tickets.NewService(log, database, database, database, notifier)))
+			customers.Mount(r, customers.NewHandler(log, customers.NewService(log, database, database)))
+			admin.Mount(r, admin.NewHandler(log, admin.NewService(log, database, database, database, database, database, database, database, database, oidc, mailer, texts, cfg.InviteTTL, cfg.Environment != config.PROD), cfg.Environment == config.PROD))
+		})
+	})
+	// Provider webhooks are signed rather than tied to a session
+	r.Group(func(r chi.Router) {
+		r.Use(
+			middleware.Logger,
+			middleware.Recoverer,
+			mw.Logging(log),
+			tenants,
+		)
+		messaging.Mount(r, messaging.NewHandler(log, messaging.NewService(log, notifier, texts), cfg.Environment == config.PROD))
+	})
+	// The customer portal is public; customers prove who they are per lookup
+	r.Group(func(r chi.Router) {
+		r.Use(
+			middleware.Logger,
+			middleware.Recoverer,
+			mw.Logging(log),
+			mw.TextHTMLMiddleware,
+			tenants,
+		)
+		portal.Mount(r, portal.NewHandler(log, portal.NewService(log, database, database, database, database, mailer), cfg.Environment == config.PROD))
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(tenants, sessions, permissions, projects, mw.RequireUser, mw.RequirePermission(models.PermTicketRead))
+		api.Mount(r, api.NewHandler(log, api.NewService(log, database)))
 	})
-	api.Mount(r, api.NewHandler(log, api.NewService(log)))
 
 	return r
 }
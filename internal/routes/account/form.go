@@ -0,0 +1,84 @@
+package account
+
+import (
+	"net/http"
+	"strings"
+
+	"flexsupport/internal/httputil"
+)
+
+// LoginInput holds the posted credentials and the client details recorded on
+// the session
+type LoginInput struct {
+	Email     string
+	Password  string
+	Next      string
+	UserAgent string
+	IPAddress string
+}
+
+func readLoginInput(r *http.Request) LoginInput {
+	return LoginInput{
+		Email:     strings.TrimSpace(r.PostFormValue("email")),
+		Password:  r.PostFormValue("password"),
+		Next:      safeNext(r.PostFormValue("next")),
+		UserAgent: r.UserAgent(),
+		IPAddress: httputil.ClientIP(r),
+	}
+}
+
+// AcceptInput holds the posted invitation token and password
+type AcceptInput struct {
+	Token     string
+	Password  string
+	Confirm   string
+	UserAgent string
+	IPAddress string
+}
+
+func readAcceptInput(r *http.Request) AcceptInput {
+	return AcceptInput{
+		Token:     r.PostFormValue("token"),
+		Password:  r.PostFormValue("password"),
+		Confirm:   r.PostFormValue("confirm"),
+		UserAgent: r.UserAgent(),
+		IPAddress: httputil.ClientIP(r),
+	}
+}
+
+// ResetRequestInput holds the posted forgot-password form
+type ResetRequestInput struct {
+	Email     string
+	IPAddress string
+}
+
+func readResetRequestInput(r *http.Request) ResetRequestInput {
+	return ResetRequestInput{
+		Email:     strings.TrimSpace(r.PostFormValue("email")),
+		IPAddress: httputil.ClientIP(r),
+	}
+}
+
+// ResetInput holds the posted reset token and new password
+type ResetInput struct {
+	Token    string
+	Password string
+	Confirm  string
+}
+
+func readResetInput(r *http.Request) ResetInput {
+	return ResetInput{
+		Token:    r.PostFormValue("token"),
+		Password: r.PostFormValue("password"),
+		Confirm:  r.PostFormValue("confirm"),
+	}
+}
+
+// safeNext only allows redirects to paths on this site, so a crafted
+// ?next=//evil.example link cannot bounce users elsewhere after sign-in
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,543 @@
+package account
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"flexsupport/internal/auth"
+	"flexsupport/internal/httputil"
+	"flexsupport/internal/layout"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	Handler interface {
+		LoginPage(w http.ResponseWriter, r *http.Request)
+		Login(w http.ResponseWriter, r *http.Request)
+		Logout(w http.ResponseWriter, r *http.Request)
+		BeginSSO(w http.ResponseWriter, r *http.Request)
+		SSOCallback(w http.ResponseWriter, r *http.Request)
+		SwitchProject(w http.ResponseWriter, r *http.Request)
+		InvitePage(w http.ResponseWriter, r *http.Request)
+		AcceptInvite(w http.ResponseWriter, r *http.Request)
+		ForgotPage(w http.ResponseWriter, r *http.Request)
+		ForgotPassword(w http.ResponseWriter, r *http.Request)
+		ResetPage(w http.ResponseWriter, r *http.Request)
+		ResetPassword(w http.ResponseWriter, r *http.Request)
+		SendVerification(w http.ResponseWriter, r *http.Request)
+		VerifyEmail(w http.ResponseWriter, r *http.Request)
+	}
+
+	handler struct {
+		log     *slog.Logger
+		service Service
+		// secure marks the session cookie Secure; off in development so it
+		// works over plain http://localhost
+		secure bool
+	}
+)
+
+// flowCookie carries the OIDC state, nonce and PKCE verifier across the round
+// trip to the identity provider
+const flowCookie = "sso_flow"
+
+// ssoCallbackPath is the redirect URI to register with the identity provider
+const ssoCallbackPath = "/login/sso/callback"
+
+// invitePath is where invitees accept an invitation and set their password
+const invitePath = "/invitations/accept"
+
+// resetPath and verifyPath are where password reset and email verification
+// links point
+const (
+	resetPath  = "/reset-password"
+	verifyPath = "/verify-email"
+)
+
+func NewHandler(log *slog.Logger, svc Service, secure bool) Handler {
+	return &handler{
+		log:     log.With("Handler", "Account"),
+		service: svc,
+		secure:  secure,
+	}
+}
+
+func Mount(r chi.Router, h Handler) {
+	r.Get("/login", h.LoginPage)
+	r.Post("/login", h.Login)
+	r.Post("/logout", h.Logout)
+	r.Get("/login/sso", h.BeginSSO)
+	r.Get(ssoCallbackPath, h.SSOCallback)
+	r.With(mw.RequireUser).Post("/projects/switch", h.SwitchProject)
+	r.Get(invitePath, h.InvitePage)
+	r.Post(invitePath, h.AcceptInvite)
+	r.Get("/forgot-password", h.ForgotPage)
+	r.Post("/forgot-password", h.ForgotPassword)
+	r.Get(resetPath, h.ResetPage)
+	r.Post(resetPath, h.ResetPassword)
+	r.With(mw.RequireUser).Post(verifyPath, h.SendVerification)
+	r.Get(verifyPath, h.VerifyEmail)
+}
+
+func (h handler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.URL.Query().Get("next"))
+	if _, ok := mw.UserFromContext(r.Context()); ok {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	params := LoginParams{Next: next}
+	if r.URL.Query().Has("reset") {
+		params.Notice = "Your password has been changed. Sign in with the new one."
+	}
+	if err := h.withSSO(r, &params); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err := layout.BaseLayout(LoginPage(params)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) Login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	in := readLoginInput(r)
+	token, session, err := h.service.Login(r.Context(), in)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			h.renderInvalid(w, r, LoginParams{Email: in.Email, Next: in.Next, Error: "Incorrect email or password"})
+			return
+		}
+		h.log.Error("failed to sign in", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.setSession(w, token, session)
+	redirect(w, r, in.Next)
+}
+
+func (h handler) setSession(w http.ResponseWriter, token string, session models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     mw.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// BeginSSO sends the browser to the tenant's identity provider
+func (h handler) BeginSSO(w http.ResponseWriter, r *http.Request) {
+	url, flow, err := h.service.BeginSSO(r.Context(), h.callbackURL(r), r.URL.Query().Get("next"))
+	if err != nil {
+		if errors.Is(err, ErrSSODisabled) {
+			http.NotFound(w, r)
+			return
+		}
+		h.log.Error("failed to start SSO", "error", err)
+		http.Error(w, "Single sign-on is unavailable", http.StatusBadGateway)
+		return
+	}
+	raw, err := json.Marshal(flow)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(raw),
+		Path:     ssoCallbackPath,
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   h.secure,
+		// the callback is a top-level navigation from the identity provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// SSOCallback completes the sign-in when the identity provider sends the browser back
+func (h handler) SSOCallback(w http.ResponseWriter, r *http.Request) {
+	var flow auth.OIDCFlow
+	if c, err := r.Cookie(flowCookie); err == nil {
+		if raw, err := base64.RawURLEncoding.DecodeString(c.Value); err == nil {
+			_ = json.Unmarshal(raw, &flow)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: flowCookie, Path: ssoCallbackPath, MaxAge: -1, HttpOnly: true, Secure: h.secure})
+
+	query := r.URL.Query()
+	if idpErr := query.Get("error"); idpErr != "" {
+		h.log.Warn("identity provider refused sign-in", "error", idpErr, "description", query.Get("error_description"))
+		h.renderSSOFailed(w, r, flow.Next, "Sign-in was cancelled or refused by your identity provider")
+		return
+	}
+
+	token, session, err := h.service.CompleteSSO(r.Context(), h.callbackURL(r), flow, query.Get("state"), query.Get("code"), LoginInput{
+		UserAgent: r.UserAgent(),
+		IPAddress: httputil.ClientIP(r),
+	})
+	switch {
+	case errors.Is(err, ErrSSODisabled):
+		http.NotFound(w, r)
+	case errors.Is(err, ErrSSODenied):
+		h.renderSSOFailed(w, r, flow.Next, "Your account does not have access to this shop")
+	case errors.Is(err, auth.ErrOIDCState):
+		h.renderSSOFailed(w, r, flow.Next, "Your sign-in expired, please try again")
+	case err != nil:
+		h.log.Error("failed to complete SSO", "error", err)
+		h.renderSSOFailed(w, r, flow.Next, "Single sign-on failed, please try again")
+	default:
+		h.setSession(w, token, session)
+		http.Redirect(w, r, safeNext(flow.Next), http.StatusSeeOther)
+	}
+}
+
+func (h handler) renderSSOFailed(w http.ResponseWriter, r *http.Request, next, message string) {
+	params := LoginParams{Next: safeNext(next), Error: message}
+	if err := h.withSSO(r, &params); err != nil {
+		h.log.Error("failed to load SSO settings", "error", err)
+	}
+	w.WriteHeader(http.StatusForbidden)
+	if err := layout.BaseLayout(LoginPage(params)).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render login page", "error", err)
+	}
+}
+
+// withSSO fills in the single sign-on button when the tenant has it enabled
+func (h handler) withSSO(r *http.Request, params *LoginParams) error {
+	cfg, enabled, err := h.service.SSO(r.Context())
+	if err != nil {
+		return err
+	}
+	if enabled {
+		params.SSOLabel = cfg.Label()
+	}
+	return nil
+}
+
+// callbackURL is the absolute redirect URI on the tenant's own host
+func (h handler) callbackURL(r *http.Request) string {
+	return CallbackURL(r, h.secure)
+}
+
+// CallbackURL returns the SSO redirect URI for the tenant host r was made to,
+// for display on the settings page
+func CallbackURL(r *http.Request, secure bool) string {
+	return httputil.BaseURL(r, secure) + ssoCallbackPath
+}
+
+// InviteURL is the page invitation links point at; the token goes in the query
+// string so it stays out of request logs
+func InviteURL(r *http.Request, secure bool) string {
+	return httputil.BaseURL(r, secure) + invitePath
+}
+
+func (h handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(mw.SessionCookie); err == nil {
+		if err := h.service.Logout(r.Context(), c.Value); err != nil {
+			h.log.Error("failed to end session", "error", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     mw.SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	redirect(w, r, "/login")
+}
+
+// SwitchProject remembers the project picked in the switcher, or clears it
+// for "all projects", and returns to the page it was picked on
+func (h handler) SwitchProject(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     mw.ProjectCookie,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if id := r.PostFormValue("project"); id != "" && mw.CanAccessProject(r.Context(), id) {
+		cookie.Value = id
+	} else {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+	redirect(w, r, safeNext(r.PostFormValue("next")))
+}
+
+func (h handler) InvitePage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	invitation, user, err := h.service.Invitation(r.Context(), token)
+	if err != nil {
+		h.renderInviteFailed(w, r, err)
+		return
+	}
+	params := acceptParams(r, token, invitation, user)
+	if err := layout.BaseLayout(AcceptPage(params)).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	in := readAcceptInput(r)
+	token, session, err := h.service.AcceptInvitation(r.Context(), in)
+	if err == nil {
+		h.setSession(w, token, session)
+		redirect(w, r, "/")
+		return
+	}
+
+	var message string
+	switch {
+	case errors.Is(err, ErrPasswordTooShort), errors.Is(err, ErrPasswordMismatch):
+		message = err.Error()
+	case errors.Is(err, ErrInvalidCredentials):
+		message = "Incorrect password"
+	default:
+		h.renderInviteFailed(w, r, err)
+		return
+	}
+	invitation, user, err := h.service.Invitation(r.Context(), in.Token)
+	if err != nil {
+		h.renderInviteFailed(w, r, err)
+		return
+	}
+	params := acceptParams(r, in.Token, invitation, user)
+	params.Error = message
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if httputil.IsHTMX(r) {
+		err = AcceptForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(AcceptPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render invitation", "error", err)
+	}
+}
+
+// renderInviteFailed explains why an invitation link no longer works. htmx
+// requests reload the page, which then shows the same explanation.
+func (h handler) renderInviteFailed(w http.ResponseWriter, r *http.Request, err error) {
+	var message string
+	switch {
+	case errors.Is(err, ErrInviteExpired):
+		message = "This invitation has expired. Ask whoever invited you to send a new one."
+	case errors.Is(err, ErrInviteInvalid):
+		message = "This invitation link is not valid. It may have been used already or revoked."
+	default:
+		h.log.Error("failed to load invitation", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if httputil.IsHTMX(r) {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusGone)
+	if err := layout.BaseLayout(LinkFailedPage("Invitation unavailable", message)).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render invitation", "error", err)
+	}
+}
+
+func (h handler) ForgotPage(w http.ResponseWriter, r *http.Request) {
+	if err := layout.BaseLayout(ForgotPage(ForgotParams{})).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ForgotPassword answers the same way whether or not the address has an
+// account, so it cannot be used to find out who does
+func (h handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	in := readResetRequestInput(r)
+	params := ForgotParams{Email: in.Email, Sent: true}
+	if err := h.service.RequestPasswordReset(r.Context(), in, httputil.BaseURL(r, h.secure)+resetPath); err != nil {
+		if !errors.Is(err, ErrRateLimited) {
+			h.log.Error("failed to request password reset", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		params = ForgotParams{Email: in.Email, Error: "Too many reset requests. Try again later."}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	var err error
+	if httputil.IsHTMX(r) {
+		err = ForgotForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(ForgotPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render forgot password form", "error", err)
+	}
+}
+
+func (h handler) ResetPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	user, err := h.service.ResetUser(r.Context(), token)
+	if err != nil {
+		h.renderLinkFailed(w, r, err)
+		return
+	}
+	params := ResetParams{Token: token, Email: user.Email}
+	if err := layout.BaseLayout(ResetPage(params)).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ResetPassword sets the new password and sends the user to sign in with it;
+// every existing session has been ended
+func (h handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	in := readResetInput(r)
+	err := h.service.ResetPassword(r.Context(), in)
+	if err == nil {
+		redirect(w, r, "/login?reset=1")
+		return
+	}
+	if !errors.Is(err, ErrPasswordTooShort) && !errors.Is(err, ErrPasswordMismatch) {
+		h.renderLinkFailed(w, r, err)
+		return
+	}
+	user, lookupErr := h.service.ResetUser(r.Context(), in.Token)
+	if lookupErr != nil {
+		h.renderLinkFailed(w, r, lookupErr)
+		return
+	}
+	params := ResetParams{Token: in.Token, Email: user.Email, Error: err.Error()}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if httputil.IsHTMX(r) {
+		err = ResetForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(ResetPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render reset form", "error", err)
+	}
+}
+
+// SendVerification emails the signed-in user a verification link and
+// replaces the banner that asked for it
+func (h handler) SendVerification(w http.ResponseWriter, r *http.Request) {
+	message := "Check your inbox for a link to confirm your email address."
+	if err := h.service.SendVerification(r.Context(), httputil.BaseURL(r, h.secure)+verifyPath); err != nil {
+		if !errors.Is(err, ErrRateLimited) {
+			h.log.Error("failed to send verification email", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message = "A link has been sent several times already. Try again later."
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	if err := layout.VerifySent(message).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render verification banner", "error", err)
+	}
+}
+
+func (h handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+		h.renderLinkFailed(w, r, err)
+		return
+	}
+	if err := layout.BaseLayout(VerifiedPage()).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderLinkFailed explains that a reset or verification link no longer
+// works. htmx requests reload the page, which then shows the same explanation.
+func (h handler) renderLinkFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, ErrLinkInvalid) {
+		h.log.Error("failed to check link", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if httputil.IsHTMX(r) {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusGone)
+	message := "This link is not valid. It may have expired or been used already."
+	if err := layout.BaseLayout(LinkFailedPage("Link unavailable", message)).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render link failure", "error", err)
+	}
+}
+
+func acceptParams(r *http.Request, token string, invitation models.Invitation, user models.User) AcceptParams {
+	tenant, _ := mw.TenantFromContext(r.Context())
+	return AcceptParams{
+		Token:       token,
+		Email:       user.Email,
+		Name:        user.Name,
+		TenantName:  tenant.Name,
+		RoleName:    invitation.RoleName,
+		HasPassword: user.PasswordHash != "",
+	}
+}
+
+// renderInvalid re-renders the login form with its error; htmx requests only
+// get the form back
+func (h handler) renderInvalid(w http.ResponseWriter, r *http.Request, params LoginParams) {
+	if err := h.withSSO(r, &params); err != nil {
+		h.log.Error("failed to load SSO settings", "error", err)
+	}
+	var err error
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if httputil.IsHTMX(r) {
+		err = LoginForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(LoginPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render login form", "error", err)
+	}
+}
+
+// redirect sends htmx requests to url with a full page navigation and falls
+// back to a regular See Other redirect
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if httputil.IsHTMX(r) {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
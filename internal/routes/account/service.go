@@ -0,0 +1,656 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"flexsupport/internal/auth"
+	"flexsupport/internal/mail"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/ratelimit"
+	"flexsupport/internal/utils"
+)
+
+// Signed link purposes and lifetimes
+const (
+	resetPurpose     = "password_reset"
+	verifyPurpose    = "verify_email"
+	passwordResetTTL = time.Hour
+	verifyEmailTTL   = 48 * time.Hour
+)
+
+// ErrInvalidCredentials is returned for any failed sign-in, whether the email
+// is unknown, the password is wrong or the user is not a member of the tenant
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrSSODenied is returned when the identity provider vouched for the user but
+// they may not sign in to this tenant
+var ErrSSODenied = errors.New("single sign-on not allowed for this account")
+
+// ErrSSODisabled is returned when the tenant has no enabled oidc integration
+var ErrSSODisabled = errors.New("single sign-on is not enabled")
+
+// ErrInviteInvalid is returned for invitation tokens that are unknown, revoked
+// or already used
+var ErrInviteInvalid = errors.New("invitation is not valid")
+
+// ErrInviteExpired is returned for invitation tokens past their expiry
+var ErrInviteExpired = errors.New("invitation has expired")
+
+// ErrLinkInvalid is returned for password reset and verification links that
+// are malformed, expired or already used
+var ErrLinkInvalid = errors.New("link is invalid or has expired")
+
+// ErrRateLimited is returned when a client has asked for too many emails
+var ErrRateLimited = errors.New("too many requests")
+
+// ErrPasswordTooShort and ErrPasswordMismatch reject a new password
+var (
+	ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength)
+	ErrPasswordMismatch = errors.New("passwords do not match")
+)
+
+// SSOIntegration is the name of the oidc integration used for staff sign-in
+const SSOIntegration = "default"
+
+type (
+	Service interface {
+		Login(ctx context.Context, in LoginInput) (string, models.Session, error)
+		Logout(ctx context.Context, token string) error
+		Authenticate(ctx context.Context, token string) (*models.User, bool, error)
+		SSO(ctx context.Context) (models.OIDCConfig, bool, error)
+		BeginSSO(ctx context.Context, redirectURL, next string) (string, auth.OIDCFlow, error)
+		CompleteSSO(ctx context.Context, redirectURL string, flow auth.OIDCFlow, state, code string, in LoginInput) (string, models.Session, error)
+		Permissions(ctx context.Context, userID string) (models.PermissionSet, error)
+		UserProjects(ctx context.Context, userID string) ([]models.Project, error)
+		Invitation(ctx context.Context, token string) (models.Invitation, models.User, error)
+		AcceptInvitation(ctx context.Context, in AcceptInput) (string, models.Session, error)
+		RequestPasswordReset(ctx context.Context, in ResetRequestInput, resetURL string) error
+		ResetUser(ctx context.Context, token string) (models.User, error)
+		ResetPassword(ctx context.Context, in ResetInput) error
+		SendVerification(ctx context.Context, verifyURL string) error
+		VerifyEmail(ctx context.Context, token string) error
+	}
+
+	service struct {
+		log          *slog.Logger
+		users        ports.UserRepository
+		sessions     ports.SessionRepository
+		integrations ports.IntegrationRepository
+		roles        ports.RoleRepository
+		projects     ports.ProjectRepository
+		invitations  ports.InvitationRepository
+		oidc         *auth.OIDCClient
+		signer       *auth.Signer
+		mailer       mail.Sender
+		sessionTTL   time.Duration
+
+		resetByIP    *ratelimit.Limiter
+		resetByEmail *ratelimit.Limiter
+		verifyByUser *ratelimit.Limiter
+	}
+)
+
+var (
+	_ mw.SessionStore     = (Service)(nil)
+	_ mw.PermissionLoader = (Service)(nil)
+	_ mw.ProjectLoader    = (Service)(nil)
+)
+
+func NewService(
+	log *slog.Logger,
+	users ports.UserRepository,
+	sessions ports.SessionRepository,
+	integrations ports.IntegrationRepository,
+	roles ports.RoleRepository,
+	projects ports.ProjectRepository,
+	invitations ports.InvitationRepository,
+	oidc *auth.OIDCClient,
+	signer *auth.Signer,
+	mailer mail.Sender,
+	sessionTTL time.Duration,
+) Service {
+	return &service{
+		log:          log.With("Service", "Account"),
+		users:        users,
+		sessions:     sessions,
+		integrations: integrations,
+		roles:        roles,
+		projects:     projects,
+		invitations:  invitations,
+		oidc:         oidc,
+		signer:       signer,
+		mailer:       mailer,
+		sessionTTL:   sessionTTL,
+		resetByIP:    ratelimit.New(20, time.Hour),
+		resetByEmail: ratelimit.New(3, time.Hour),
+		verifyByUser: ratelimit.New(3, time.Hour),
+	}
+}
+
+// Login checks the email and password against the tenant's members and opens
+// a session, returning the token to set as the session cookie
+func (s service) Login(ctx context.Context, in LoginInput) (string, models.Session, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	user, err := s.users.GetUserByEmail(ctx, strings.TrimSpace(in.Email))
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		// still hash the password so unknown emails take as long as known ones
+		auth.CheckPassword("", in.Password)
+		return "", models.Session{}, ErrInvalidCredentials
+	case err != nil:
+		return "", models.Session{}, err
+	}
+	if !auth.CheckPassword(user.PasswordHash, in.Password) {
+		return "", models.Session{}, ErrInvalidCredentials
+	}
+	member, err := s.users.IsActiveMember(ctx, tenantID, user.ID)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if !member {
+		return "", models.Session{}, ErrInvalidCredentials
+	}
+
+	token, session, err := s.startSession(ctx, tenantID, user.ID, in)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if err := s.users.RecordLogin(ctx, user.ID); err != nil {
+		s.log.Error("failed to record login", "user", user.ID, "error", err)
+	}
+	s.log.Info("User signed in", "user", user.ID)
+	return token, session, nil
+}
+
+func (s service) startSession(ctx context.Context, tenantID, userID string, in LoginInput) (string, models.Session, error) {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	session := models.Session{
+		ID:        hash,
+		UserID:    userID,
+		TenantID:  tenantID,
+		UserAgent: in.UserAgent,
+		IPAddress: in.IPAddress,
+		ExpiresAt: time.Now().Add(s.sessionTTL),
+	}
+	if err := s.sessions.CreateSession(ctx, &session); err != nil {
+		return "", models.Session{}, fmt.Errorf("failed to start session: %w", err)
+	}
+	return token, session, nil
+}
+
+func (s service) Logout(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	return s.sessions.DeleteSession(ctx, auth.HashToken(token))
+}
+
+// Authenticate resolves a session cookie to its user within the current tenant
+func (s service) Authenticate(ctx context.Context, token string) (*models.User, bool, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	user, err := s.sessions.GetSessionUser(ctx, tenantID, auth.HashToken(token))
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	}
+	return &user, true, nil
+}
+
+// SSO returns the tenant's single sign-on settings and whether it is enabled
+func (s service) SSO(ctx context.Context) (models.OIDCConfig, bool, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.OIDCConfig{}, false, err
+	}
+	integration, err := s.integrations.GetIntegration(ctx, tenantID, models.IntegrationOIDC, SSOIntegration)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return models.OIDCConfig{}, false, nil
+	case err != nil:
+		return models.OIDCConfig{}, false, err
+	}
+	cfg, err := integration.OIDC()
+	if err != nil {
+		return models.OIDCConfig{}, false, fmt.Errorf("failed to decode oidc config: %w", err)
+	}
+	return cfg, integration.Enabled && cfg.Issuer != "" && cfg.ClientID != "", nil
+}
+
+// BeginSSO returns the identity provider URL to send the browser to, and the
+// flow it must bring back to the callback
+func (s service) BeginSSO(ctx context.Context, redirectURL, next string) (string, auth.OIDCFlow, error) {
+	cfg, enabled, err := s.SSO(ctx)
+	if err != nil {
+		return "", auth.OIDCFlow{}, err
+	}
+	if !enabled {
+		return "", auth.OIDCFlow{}, ErrSSODisabled
+	}
+	return s.oidc.AuthCodeURL(ctx, cfg, redirectURL, safeNext(next))
+}
+
+// CompleteSSO redeems the callback and signs the user in. Users are matched by
+// their identity provider account, then by verified email among the tenant's
+// members. Unknown users from
+// an allowed domain are created and added to the tenant when auto-provisioning
+// is on; anyone else must already be a member.
+func (s service) CompleteSSO(ctx context.Context, redirectURL string, flow auth.OIDCFlow, state, code string, in LoginInput) (string, models.Session, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	cfg, enabled, err := s.SSO(ctx)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if !enabled {
+		return "", models.Session{}, ErrSSODisabled
+	}
+	claims, err := s.oidc.Exchange(ctx, cfg, redirectURL, flow, state, code)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		s.log.Warn("SSO sign-in without a verified email", "issuer", claims.Issuer, "subject", claims.Subject)
+		return "", models.Session{}, ErrSSODenied
+	}
+	provision := cfg.AutoProvision && cfg.AllowsDomain(claims.Email)
+
+	user, err := s.ssoUser(ctx, tenantID, claims, provision)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	member, err := s.users.IsActiveMember(ctx, tenantID, user.ID)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if !member && provision {
+		if err := s.users.AddMembership(ctx, tenantID, user.ID); err != nil {
+			return "", models.Session{}, err
+		}
+		// a disabled membership is left alone, so check again
+		if member, err = s.users.IsActiveMember(ctx, tenantID, user.ID); err != nil {
+			return "", models.Session{}, err
+		}
+		if member {
+			if err := s.grantRole(ctx, tenantID, user.ID, cfg.DefaultRole); err != nil {
+				return "", models.Session{}, err
+			}
+			s.log.Info("Provisioned SSO member", "user", user.ID, "role", cfg.DefaultRole)
+		}
+	}
+	if !member {
+		return "", models.Session{}, ErrSSODenied
+	}
+
+	token, session, err := s.startSession(ctx, tenantID, user.ID, in)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if err := s.users.RecordLogin(ctx, user.ID); err != nil {
+		s.log.Error("failed to record login", "user", user.ID, "error", err)
+	}
+	s.log.Info("User signed in with SSO", "user", user.ID)
+	return token, session, nil
+}
+
+// ssoUser finds the user for the identity provider account, linking it to an
+// existing user with the same email or, when provision is set, a new one.
+// Users are global, so an existing user is only linked when they already
+// belong to this tenant; otherwise any tenant's identity provider could claim
+// their email and sign in as them.
+func (s service) ssoUser(ctx context.Context, tenantID string, claims auth.OIDCClaims, provision bool) (models.User, error) {
+	user, err := s.users.GetUserByIdentity(ctx, claims.Issuer, claims.Subject)
+	if !errors.Is(err, ports.ErrNotFound) {
+		return user, err
+	}
+
+	user, err = s.users.GetUserByEmail(ctx, claims.Email)
+	if err == nil {
+		_, err = s.users.MembershipStatus(ctx, tenantID, user.ID)
+		if errors.Is(err, ports.ErrNotFound) {
+			s.log.Warn("SSO email belongs to a user outside the tenant", "user", user.ID, "issuer", claims.Issuer, "subject", claims.Subject)
+			return models.User{}, ErrSSODenied
+		}
+		if err != nil {
+			return models.User{}, err
+		}
+	}
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		if !provision {
+			return models.User{}, ErrSSODenied
+		}
+		user = models.User{Name: claims.Name, Email: claims.Email, EmailVerified: true}
+		if user.Name == "" {
+			user.Name = claims.Email
+		}
+		if err := s.users.CreateUser(ctx, &user); err != nil {
+			return models.User{}, err
+		}
+	case err != nil:
+		return models.User{}, err
+	}
+
+	if err := s.users.LinkIdentity(ctx, &models.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// grantRole gives a newly provisioned member the named role, or Viewer when
+// the name is empty or no longer exists
+func (s service) grantRole(ctx context.Context, tenantID, userID, name string) error {
+	if name == "" {
+		name = models.RoleViewer
+	}
+	role, err := s.roles.GetRoleByName(ctx, tenantID, name)
+	if errors.Is(err, ports.ErrNotFound) && name != models.RoleViewer {
+		role, err = s.roles.GetRoleByName(ctx, tenantID, models.RoleViewer)
+	}
+	if err != nil {
+		return err
+	}
+	return s.roles.AddMemberRole(ctx, tenantID, userID, role.ID)
+}
+
+// Permissions returns what the user may do in the current tenant
+func (s service) Permissions(ctx context.Context, userID string) (models.PermissionSet, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	perms, err := s.roles.UserPermissions(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewPermissionSet(perms...), nil
+}
+
+// UserProjects returns the projects the user may work in: every project for
+// holders of project.admin, otherwise those they are a member of
+func (s service) UserProjects(ctx context.Context, userID string) ([]models.Project, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mw.Can(ctx, models.PermProjectAdmin) {
+		return s.projects.ListProjects(ctx, tenantID)
+	}
+	return s.projects.ListUserProjects(ctx, tenantID, userID)
+}
+
+// Invitation looks up a usable invitation by its emailed token, along with the
+// invitee
+func (s service) Invitation(ctx context.Context, token string) (models.Invitation, models.User, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Invitation{}, models.User{}, err
+	}
+	if token == "" {
+		return models.Invitation{}, models.User{}, ErrInviteInvalid
+	}
+	invitation, err := s.invitations.GetInvitationByToken(ctx, tenantID, auth.HashToken(token))
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return models.Invitation{}, models.User{}, ErrInviteInvalid
+	case err != nil:
+		return models.Invitation{}, models.User{}, err
+	case invitation.AcceptedAt != nil || invitation.RevokedAt != nil:
+		return models.Invitation{}, models.User{}, ErrInviteInvalid
+	case invitation.IsExpired():
+		return models.Invitation{}, models.User{}, ErrInviteExpired
+	}
+	user, err := s.users.GetUser(ctx, invitation.UserID)
+	if err != nil {
+		return models.Invitation{}, models.User{}, err
+	}
+	return invitation, user, nil
+}
+
+// AcceptInvitation uses up the invitation and signs the invitee in. Invitees
+// without a password choose one; anyone who already has one must enter it,
+// so an invitation cannot be used to take over an existing account.
+func (s service) AcceptInvitation(ctx context.Context, in AcceptInput) (string, models.Session, error) {
+	invitation, user, err := s.Invitation(ctx, in.Token)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	var hash string
+	if user.PasswordHash == "" {
+		if len(in.Password) < auth.MinPasswordLength {
+			return "", models.Session{}, ErrPasswordTooShort
+		}
+		if in.Password != in.Confirm {
+			return "", models.Session{}, ErrPasswordMismatch
+		}
+		if hash, err = auth.HashPassword(in.Password); err != nil {
+			return "", models.Session{}, err
+		}
+	} else if !auth.CheckPassword(user.PasswordHash, in.Password) {
+		return "", models.Session{}, ErrInvalidCredentials
+	}
+
+	err = s.invitations.AcceptInvitation(ctx, invitation, hash)
+	if errors.Is(err, ports.ErrConflict) {
+		return "", models.Session{}, ErrInviteInvalid
+	}
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	s.log.Info("Accepted invitation", "invitation", invitation.ID, "user", user.ID)
+
+	token, session, err := s.startSession(ctx, invitation.TenantID, user.ID, LoginInput{UserAgent: in.UserAgent, IPAddress: in.IPAddress})
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if err := s.users.RecordLogin(ctx, user.ID); err != nil {
+		s.log.Error("failed to record login", "user", user.ID, "error", err)
+	}
+	return token, session, nil
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to a member
+// of the tenant. The result is the same either way, so the form cannot be used
+// to find out who has an account; only too many requests from one IP address
+// are reported.
+func (s service) RequestPasswordReset(ctx context.Context, in ResetRequestInput, resetURL string) error {
+	if !s.resetByIP.Allow(in.IPAddress) {
+		return ErrRateLimited
+	}
+	email := strings.ToLower(in.Email)
+	if email == "" || !s.resetByEmail.Allow(email) {
+		return nil
+	}
+	// Look the account up after responding so the response takes as long
+	// whether or not it exists
+	go s.sendPasswordReset(context.WithoutCancel(ctx), email, resetURL)
+	return nil
+}
+
+func (s service) sendPasswordReset(ctx context.Context, email, resetURL string) {
+	tenant, ok := mw.TenantFromContext(ctx)
+	if !ok {
+		return
+	}
+	user, err := s.users.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, ports.ErrNotFound) {
+			s.log.Error("failed to look up user for password reset", "error", err)
+		}
+		return
+	}
+	member, err := s.users.IsActiveMember(ctx, tenant.ID, user.ID)
+	if err != nil {
+		s.log.Error("failed to check membership for password reset", "user", user.ID, "error", err)
+		return
+	}
+	if !member {
+		return
+	}
+	token, err := s.signer.Sign(resetPurpose, user.ID, resetState(user), passwordResetTTL)
+	if err != nil {
+		s.log.Error("failed to sign password reset link", "user", user.ID, "error", err)
+		return
+	}
+	msg, err := mail.Render(ctx, user.Email, "Reset your FlexSupport password", resetEmail(tenant.Name, user.Name, resetURL+"?token="+token))
+	if err != nil {
+		s.log.Error("failed to render password reset email", "user", user.ID, "error", err)
+		return
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Error("failed to email password reset link", "user", user.ID, "error", err)
+		return
+	}
+	s.log.Info("Sent password reset link", "user", user.ID)
+}
+
+// ResetUser returns the member a password reset link was sent to. Links stop
+// working once the password changes.
+func (s service) ResetUser(ctx context.Context, token string) (models.User, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+	user, err := s.verifyLink(ctx, token, resetPurpose, resetState)
+	if err != nil {
+		return models.User{}, err
+	}
+	member, err := s.users.IsActiveMember(ctx, tenantID, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !member {
+		return models.User{}, ErrLinkInvalid
+	}
+	return user, nil
+}
+
+// ResetPassword sets a new password from a reset link and signs the user out
+// everywhere
+func (s service) ResetPassword(ctx context.Context, in ResetInput) error {
+	user, err := s.ResetUser(ctx, in.Token)
+	if err != nil {
+		return err
+	}
+	if len(in.Password) < auth.MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if in.Password != in.Confirm {
+		return ErrPasswordMismatch
+	}
+	hash, err := auth.HashPassword(in.Password)
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetPassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+	if err := s.sessions.DeleteUserSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	s.log.Info("Reset password", "user", user.ID)
+	return nil
+}
+
+// SendVerification emails the signed-in user a link to confirm their address
+func (s service) SendVerification(ctx context.Context, verifyURL string) error {
+	user, ok := mw.UserFromContext(ctx)
+	if !ok {
+		return mw.ErrNoUser
+	}
+	tenant, ok := mw.TenantFromContext(ctx)
+	if !ok {
+		return mw.ErrNoTenant
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	if !s.verifyByUser.Allow(user.ID) {
+		return ErrRateLimited
+	}
+	token, err := s.signer.Sign(verifyPurpose, user.ID, verifyState(user), verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	msg, err := mail.Render(ctx, user.Email, "Verify your email address", verifyEmail(tenant.Name, user.Name, verifyURL+"?token="+token))
+	if err != nil {
+		return err
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to email verification link: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail marks the address a verification link was sent to as verified
+func (s service) VerifyEmail(ctx context.Context, token string) error {
+	user, err := s.verifyLink(ctx, token, verifyPurpose, verifyState)
+	if err != nil {
+		return err
+	}
+	if err := s.users.MarkEmailVerified(ctx, user.ID); err != nil {
+		return err
+	}
+	s.log.Info("Verified email", "user", user.ID)
+	return nil
+}
+
+// verifyLink checks a signed link and loads the user it was issued for
+func (s service) verifyLink(ctx context.Context, token, purpose string, state func(models.User) string) (models.User, error) {
+	var user models.User
+	_, err := s.signer.Verify(token, purpose, func(id string) (string, error) {
+		if !utils.IsUUID(id) {
+			return "", auth.ErrTokenInvalid
+		}
+		var err error
+		user, err = s.users.GetUser(ctx, id)
+		if errors.Is(err, ports.ErrNotFound) {
+			return "", auth.ErrTokenInvalid
+		}
+		return state(user), err
+	})
+	if errors.Is(err, auth.ErrTokenInvalid) || errors.Is(err, auth.ErrTokenExpired) {
+		return models.User{}, ErrLinkInvalid
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// resetState binds reset links to the current password, so they work once
+func resetState(user models.User) string {
+	return user.Email + "\x00" + user.PasswordHash
+}
+
+// verifyState binds verification links to the address they were sent to
+func verifyState(user models.User) string {
+	return user.Email
+}
@@ -0,0 +1,320 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"flexsupport/internal/auth"
+	"flexsupport/internal/auth/oidctest"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+// fakeUsers keeps users, their linked identities and their memberships,
+// keyed by tenant and user ID
+type fakeUsers struct {
+	ports.UserRepository
+	users       map[string]models.User
+	identities  map[string]string
+	memberships map[string]string
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{users: map[string]models.User{}, identities: map[string]string{}, memberships: map[string]string{}}
+}
+
+func (f *fakeUsers) add(tenantID, status string, user models.User) models.User {
+	if err := f.CreateUser(context.Background(), &user); err != nil {
+		panic(err)
+	}
+	if tenantID != "" {
+		f.memberships[tenantID+"/"+user.ID] = status
+	}
+	return user
+}
+
+func (f *fakeUsers) GetUser(ctx context.Context, id string) (models.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return models.User{}, ports.ErrNotFound
+	}
+	return user, nil
+}
+
+func (f *fakeUsers) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	for _, user := range f.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return models.User{}, ports.ErrNotFound
+}
+
+func (f *fakeUsers) CreateUser(ctx context.Context, user *models.User) error {
+	if _, err := f.GetUserByEmail(ctx, user.Email); err == nil {
+		return ports.ErrConflict
+	}
+	user.ID = fmt.Sprintf("user-%d", len(f.users)+1)
+	f.users[user.ID] = *user
+	return nil
+}
+
+func (f *fakeUsers) AddMembership(ctx context.Context, tenantID, userID string) error {
+	if _, ok := f.memberships[tenantID+"/"+userID]; !ok {
+		f.memberships[tenantID+"/"+userID] = models.MembershipActive
+	}
+	return nil
+}
+
+func (f *fakeUsers) IsActiveMember(ctx context.Context, tenantID, userID string) (bool, error) {
+	return f.memberships[tenantID+"/"+userID] == models.MembershipActive, nil
+}
+
+func (f *fakeUsers) MembershipStatus(ctx context.Context, tenantID, userID string) (string, error) {
+	status, ok := f.memberships[tenantID+"/"+userID]
+	if !ok {
+		return "", ports.ErrNotFound
+	}
+	return status, nil
+}
+
+func (f *fakeUsers) RecordLogin(ctx context.Context, userID string) error {
+	return nil
+}
+
+func (f *fakeUsers) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	id, ok := f.identities[issuer+" "+subject]
+	if !ok {
+		return models.User{}, ports.ErrNotFound
+	}
+	return f.users[id], nil
+}
+
+func (f *fakeUsers) LinkIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	f.identities[identity.Issuer+" "+identity.Subject] = identity.UserID
+	return nil
+}
+
+type fakeSessions struct {
+	ports.SessionRepository
+	created []models.Session
+}
+
+func (f *fakeSessions) CreateSession(ctx context.Context, session *models.Session) error {
+	f.created = append(f.created, *session)
+	return nil
+}
+
+type fakeIntegrations struct {
+	ports.IntegrationRepository
+	cfg models.OIDCConfig
+}
+
+func (f fakeIntegrations) GetIntegration(ctx context.Context, tenantID string, integrationType models.IntegrationType, name string) (models.Integration, error) {
+	if integrationType != models.IntegrationOIDC {
+		return models.Integration{}, ports.ErrNotFound
+	}
+	config, err := json.Marshal(f.cfg)
+	if err != nil {
+		return models.Integration{}, err
+	}
+	return models.Integration{TenantID: tenantID, Type: integrationType, Name: name, Enabled: true, Config: config}, nil
+}
+
+// fakeRoles has the Viewer and Technician roles and records who is given one
+type fakeRoles struct {
+	ports.RoleRepository
+	granted map[string]string
+}
+
+func (f fakeRoles) GetRoleByName(ctx context.Context, tenantID, name string) (models.Role, error) {
+	if name != models.RoleViewer && name != "Technician" {
+		return models.Role{}, ports.ErrNotFound
+	}
+	return models.Role{ID: "role-" + name, TenantID: tenantID, Name: name}, nil
+}
+
+func (f fakeRoles) AddMemberRole(ctx context.Context, tenantID, userID, roleID string) error {
+	f.granted[userID] = roleID
+	return nil
+}
+
+const (
+	tenantID       = "tenant-1"
+	ssoRedirectURL = "https://shop.example.com/login/sso/callback"
+)
+
+type ssoTest struct {
+	svc   Service
+	idp   *oidctest.IdP
+	users *fakeUsers
+	roles fakeRoles
+	ctx   context.Context
+}
+
+func newSSOTest(t *testing.T, cfg models.OIDCConfig) *ssoTest {
+	t.Helper()
+	idp, err := oidctest.New()
+	if err != nil {
+		t.Fatalf("oidctest.New() error = %v", err)
+	}
+	t.Cleanup(idp.Close)
+	cfg.Issuer, cfg.ClientID, cfg.ClientSecret = idp.Issuer(), "flexsupport", "secret"
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := newFakeUsers()
+	roles := fakeRoles{granted: map[string]string{}}
+	svc := NewService(log, users, &fakeSessions{}, fakeIntegrations{cfg: cfg}, roles, nil, nil,
+		auth.NewOIDCClient(nil), nil, nil, time.Hour)
+	ctx := mw.WithTenant(context.Background(), models.Tenant{ID: tenantID, Slug: "shop", Name: "Shop"})
+	return &ssoTest{svc: svc, idp: idp, users: users, roles: roles, ctx: ctx}
+}
+
+// signIn runs the whole flow for user, letting tamper change what the browser
+// brings back to the callback
+func (s *ssoTest) signIn(t *testing.T, user oidctest.User, tamper func(flow *auth.OIDCFlow, state *string)) (models.Session, error) {
+	t.Helper()
+	authURL, flow, err := s.svc.BeginSSO(s.ctx, ssoRedirectURL, "/")
+	if err != nil {
+		t.Fatalf("BeginSSO() error = %v", err)
+	}
+	state, code, err := s.idp.Authorize(authURL, user)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if tamper != nil {
+		tamper(&flow, &state)
+	}
+	_, session, err := s.svc.CompleteSSO(s.ctx, ssoRedirectURL, flow, state, code, LoginInput{})
+	return session, err
+}
+
+var provisioning = models.OIDCConfig{AllowedDomains: []string{"example.com"}, AutoProvision: true, DefaultRole: "Technician"}
+
+func TestCompleteSSOProvisionsNewUser(t *testing.T) {
+	s := newSSOTest(t, provisioning)
+
+	session, err := s.signIn(t, oidctest.User{Subject: "alice-1", Email: "alice@Example.com", EmailVerified: true, Name: "Alice"}, nil)
+	if err != nil {
+		t.Fatalf("CompleteSSO() error = %v", err)
+	}
+	user, err := s.users.GetUserByEmail(s.ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if session.UserID != user.ID || session.TenantID != tenantID {
+		t.Errorf("session = %+v, want one for %s in %s", session, user.ID, tenantID)
+	}
+	if !user.EmailVerified || user.Name != "Alice" {
+		t.Errorf("provisioned %+v", user)
+	}
+	if s.users.memberships[tenantID+"/"+user.ID] != models.MembershipActive {
+		t.Errorf("provisioned user is not an active member")
+	}
+	if s.roles.granted[user.ID] != "role-Technician" {
+		t.Errorf("provisioned user got role %q, want the default role", s.roles.granted[user.ID])
+	}
+
+	// the next sign-in finds them by their identity provider account
+	again, err := s.signIn(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true}, nil)
+	if err != nil || again.UserID != user.ID {
+		t.Errorf("second CompleteSSO() = %+v, %v, want a session for %s", again, err, user.ID)
+	}
+	if len(s.users.users) != 1 {
+		t.Errorf("%d users, want 1", len(s.users.users))
+	}
+}
+
+func TestCompleteSSOLinksMemberByEmail(t *testing.T) {
+	s := newSSOTest(t, models.OIDCConfig{})
+	member := s.users.add(tenantID, models.MembershipActive, models.User{Name: "Bob", Email: "bob@example.com"})
+
+	session, err := s.signIn(t, oidctest.User{Subject: "bob-1", Email: "bob@example.com", EmailVerified: true}, nil)
+	if err != nil {
+		t.Fatalf("CompleteSSO() error = %v", err)
+	}
+	if session.UserID != member.ID {
+		t.Errorf("signed in as %s, want %s", session.UserID, member.ID)
+	}
+	if s.users.identities[s.idp.Issuer()+" bob-1"] != member.ID {
+		t.Errorf("identity was not linked to the member")
+	}
+	if len(s.roles.granted) != 0 {
+		t.Errorf("existing member was given roles %v", s.roles.granted)
+	}
+}
+
+func TestCompleteSSODenied(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  models.OIDCConfig
+		user oidctest.User
+	}{
+		{"unverified email", provisioning, oidctest.User{Subject: "u1", Email: "carol@example.com"}},
+		{"no email", provisioning, oidctest.User{Subject: "u2", EmailVerified: true}},
+		{"domain not allowed", provisioning, oidctest.User{Subject: "u3", Email: "carol@elsewhere.com", EmailVerified: true}},
+		{"provisioning off", models.OIDCConfig{AllowedDomains: []string{"example.com"}}, oidctest.User{Subject: "u4", Email: "carol@example.com", EmailVerified: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSSOTest(t, tt.cfg)
+
+			if _, err := s.signIn(t, tt.user, nil); !errors.Is(err, ErrSSODenied) {
+				t.Fatalf("CompleteSSO() error = %v, want ErrSSODenied", err)
+			}
+			if len(s.users.users) != 0 || len(s.users.identities) != 0 {
+				t.Errorf("denied sign-in left users %v and identities %v", s.users.users, s.users.identities)
+			}
+		})
+	}
+}
+
+// A tenant's identity provider vouching for an email must not hand it an
+// account that belongs to another tenant
+func TestCompleteSSODoesNotClaimOtherTenantsUser(t *testing.T) {
+	s := newSSOTest(t, provisioning)
+	victim := s.users.add("tenant-2", models.MembershipActive, models.User{Name: "Dana", Email: "dana@example.com"})
+
+	if _, err := s.signIn(t, oidctest.User{Subject: "dana-1", Email: "dana@example.com", EmailVerified: true}, nil); !errors.Is(err, ErrSSODenied) {
+		t.Fatalf("CompleteSSO() error = %v, want ErrSSODenied", err)
+	}
+	if len(s.users.identities) != 0 {
+		t.Errorf("identity was linked to %v", s.users.identities)
+	}
+	if _, ok := s.users.memberships[tenantID+"/"+victim.ID]; ok {
+		t.Errorf("the other tenant's user was added to this tenant")
+	}
+}
+
+func TestCompleteSSORejectsTamperedFlow(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(flow *auth.OIDCFlow, state *string)
+		want   error
+	}{
+		{"state mismatch", func(flow *auth.OIDCFlow, state *string) { *state = "forged" }, auth.ErrOIDCState},
+		{"nonce mismatch", func(flow *auth.OIDCFlow, state *string) { flow.Nonce = "other" }, auth.ErrOIDCState},
+		{"pkce verifier mismatch", func(flow *auth.OIDCFlow, state *string) { flow.Verifier = "not-the-verifier" }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSSOTest(t, provisioning)
+
+			_, err := s.signIn(t, oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true}, tt.tamper)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("CompleteSSO() error = %v, want %v", err, tt.want)
+			}
+			if len(s.users.users) != 0 {
+				t.Errorf("tampered sign-in provisioned %v", s.users.users)
+			}
+		})
+	}
+}
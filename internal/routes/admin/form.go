@@ -0,0 +1,378 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+
+	"flexsupport/internal/forms"
+	"flexsupport/internal/models"
+	"flexsupport/internal/sms"
+)
+
+// SSOInput holds the raw values posted by SSOForm
+type SSOInput struct {
+	Enabled        bool
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	ButtonLabel    string
+	AllowedDomains string
+	AutoProvision  bool
+	DefaultRole    string
+}
+
+func readSSOInput(r *http.Request) SSOInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	return SSOInput{
+		Enabled:        value("enabled") != "",
+		Issuer:         strings.TrimSuffix(value("issuer"), "/"),
+		ClientID:       value("client_id"),
+		ClientSecret:   value("client_secret"),
+		ButtonLabel:    value("button_label"),
+		AllowedDomains: value("allowed_domains"),
+		AutoProvision:  value("auto_provision") != "",
+		DefaultRole:    value("default_role"),
+	}
+}
+
+// apply validates the input onto cfg. A blank client secret keeps the stored
+// one. Issuers must use https unless localIssuers is set and they are on
+// localhost.
+func (in SSOInput) apply(cfg *models.OIDCConfig, localIssuers bool) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+
+	cfg.Issuer = in.Issuer
+	cfg.ClientID = in.ClientID
+	if in.ClientSecret != "" {
+		cfg.ClientSecret = in.ClientSecret
+	}
+	cfg.ButtonLabel = in.ButtonLabel
+	cfg.AutoProvision = in.AutoProvision
+	cfg.DefaultRole = in.DefaultRole
+	cfg.AllowedDomains = cfg.AllowedDomains[:0]
+	for _, domain := range strings.FieldsFunc(in.AllowedDomains, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" {
+			continue
+		}
+		if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@/:") {
+			errs["allowed_domains"] = "Enter domains like example.com, separated by commas"
+		}
+		cfg.AllowedDomains = append(cfg.AllowedDomains, domain)
+	}
+
+	if cfg.Issuer != "" {
+		u, err := url.Parse(cfg.Issuer)
+		switch {
+		case err != nil || u.Host == "":
+			errs["issuer"] = "Enter the issuer URL, e.g. https://accounts.google.com"
+		case u.Scheme != "https" && !(localIssuers && u.Scheme == "http" && isLocalhost(u.Hostname())):
+			errs["issuer"] = "The issuer must use https"
+		}
+	}
+	if in.Enabled {
+		if cfg.Issuer == "" {
+			errs["issuer"] = "Enter the issuer URL"
+		}
+		if cfg.ClientID == "" {
+			errs["client_id"] = "Enter the client ID"
+		}
+		if cfg.ClientSecret == "" {
+			errs["client_secret"] = "Enter the client secret"
+		}
+	}
+	if in.AutoProvision && len(cfg.AllowedDomains) == 0 {
+		errs["allowed_domains"] = "List the domains whose users may join automatically"
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// InviteInput holds the raw values posted by InviteForm
+type InviteInput struct {
+	Email string
+	Name  string
+	Role  string
+}
+
+func readInviteInput(r *http.Request) InviteInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	return InviteInput{
+		Email: value("email"),
+		Name:  value("name"),
+		Role:  value("role"),
+	}
+}
+
+// validate checks the fields that need no lookups
+func (in InviteInput) validate() forms.FieldErrors {
+	errs := forms.FieldErrors{}
+	if addr, err := mail.ParseAddress(in.Email); err != nil || addr.Address != in.Email {
+		errs["email"] = "Enter a valid email address"
+	}
+	if in.Name == "" {
+		errs["name"] = "Enter their name"
+	}
+	if in.Role == "" {
+		errs["role"] = "Choose a role"
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SMSInput holds the raw values posted by SMSForm
+type SMSInput struct {
+	Enabled            bool
+	Provider           string
+	AccountSID         string
+	AuthToken          string
+	FromNumber         string
+	BaseURL            string
+	DefaultCountryCode string
+}
+
+func readSMSInput(r *http.Request) SMSInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	return SMSInput{
+		Enabled:            value("enabled") != "",
+		Provider:           value("provider"),
+		AccountSID:         value("account_sid"),
+		AuthToken:          value("auth_token"),
+		FromNumber:         value("from_number"),
+		BaseURL:            strings.TrimSuffix(value("base_url"), "/"),
+		DefaultCountryCode: strings.TrimPrefix(value("default_country_code"), "+"),
+	}
+}
+
+// apply validates the input onto cfg. A blank auth token keeps the stored one.
+func (in SMSInput) apply(cfg *models.SMSConfig, texts sms.Providers) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+
+	cfg.Provider = models.SMSProvider(in.Provider)
+	cfg.AccountSID = in.AccountSID
+	if in.AuthToken != "" {
+		cfg.AuthToken = in.AuthToken
+	}
+	cfg.FromNumber = in.FromNumber
+	cfg.BaseURL = in.BaseURL
+	cfg.DefaultCountryCode = in.DefaultCountryCode
+
+	switch err := texts.Check(*cfg); {
+	case errors.Is(err, sms.ErrHostNotAllowed):
+		errs["base_url"] = "Enter an https API URL on a host this server allows, e.g. https://api.twilio.com"
+	case err != nil:
+		errs["provider"] = "Choose a provider"
+	}
+	if cfg.FromNumber != "" {
+		if from, err := sms.NormalizePhone(cfg.FromNumber, ""); err != nil {
+			errs["from_number"] = "Enter the number with its country code, e.g. +15415550123"
+		} else {
+			cfg.FromNumber = from
+		}
+	}
+	if cfg.DefaultCountryCode != "" {
+		if len(cfg.DefaultCountryCode) > 3 || strings.Trim(cfg.DefaultCountryCode, "0123456789") != "" || cfg.DefaultCountryCode[0] == '0' {
+			errs["default_country_code"] = "Enter a country calling code, e.g. 1 or 44"
+		}
+	}
+	if in.Enabled && cfg.Provider == models.SMSProviderTwilio {
+		if cfg.AccountSID == "" {
+			errs["account_sid"] = "Enter the account SID"
+		}
+		if cfg.AuthToken == "" {
+			errs["auth_token"] = "Enter the auth token"
+		}
+		if cfg.FromNumber == "" {
+			errs["from_number"] = "Enter the number texts are sent from"
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// NotificationInput holds the posted settings for one status
+type NotificationInput struct {
+	Notify       bool
+	EmailSubject string
+	EmailBody    string
+	SMSBody      string
+}
+
+func readNotificationInput(r *http.Request) NotificationInput {
+	return NotificationInput{
+		Notify:       r.PostFormValue("notify") != "",
+		EmailSubject: strings.TrimSpace(r.PostFormValue("email_subject")),
+		EmailBody:    strings.TrimSpace(strings.ReplaceAll(r.PostFormValue("email_body"), "\r\n", "\n")),
+		SMSBody:      strings.TrimSpace(strings.ReplaceAll(r.PostFormValue("sms_body"), "\r\n", "\n")),
+	}
+}
+
+// apply validates the input onto the status's settings
+func (in NotificationInput) apply(setting *StatusNotification) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+	setting.Status.NotifyCustomer = in.Notify
+	setting.Email.Subject = in.EmailSubject
+	setting.Email.Body = in.EmailBody
+	setting.SMS.Body = in.SMSBody
+	switch {
+	case in.EmailSubject == "":
+		errs["email_subject"] = "Enter a subject"
+	case len(in.EmailSubject) > 200:
+		errs["email_subject"] = "Keep the subject under 200 characters"
+	}
+	switch {
+	case in.EmailBody == "":
+		errs["email_body"] = "Enter the message"
+	case len(in.EmailBody) > 5000:
+		errs["email_body"] = "Keep the message under 5000 characters"
+	}
+	switch {
+	case in.SMSBody == "":
+		errs["sms_body"] = "Enter the text message"
+	case len(in.SMSBody) > 480:
+		errs["sms_body"] = "Keep the text under 480 characters, about three messages"
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// PortalInput holds the raw values posted by PortalForm
+type PortalInput struct {
+	Enabled     bool
+	Title       string
+	WelcomeText string
+	// Projects are the IDs of the projects whose tickets customers may look up
+	Projects []string
+}
+
+func readPortalInput(r *http.Request) PortalInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	return PortalInput{
+		Enabled:     value("enabled") != "",
+		Title:       value("title"),
+		WelcomeText: value("welcome_text"),
+		Projects:    r.PostForm["projects"],
+	}
+}
+
+// apply validates the input onto settings. Projects not listed are switched off.
+func (in PortalInput) apply(settings *models.PortalSettings) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+
+	settings.Enabled = in.Enabled
+	settings.Title = in.Title
+	settings.WelcomeText = in.WelcomeText
+	for i := range settings.Projects {
+		settings.Projects[i].Enabled = slices.Contains(in.Projects, settings.Projects[i].ProjectID)
+	}
+
+	if len(settings.Title) > 100 {
+		errs["title"] = "Keep the title under 100 characters"
+	}
+	if len(settings.WelcomeText) > 1000 {
+		errs["welcome_text"] = "Keep the welcome text under 1000 characters"
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// StatusInput holds the raw values posted by the status forms. Category is
+// only read when adding a status.
+type StatusInput struct {
+	Label    string
+	Colour   string
+	Category string
+}
+
+func readStatusInput(r *http.Request) StatusInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	return StatusInput{
+		Label:    value("label"),
+		Colour:   value("colour"),
+		Category: value("category"),
+	}
+}
+
+// apply validates the input onto status. A new status gets its key from the
+// label and keeps it when renamed.
+func (in StatusInput) apply(status *models.TicketStatus) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+
+	status.Label = in.Label
+	status.Colour = in.Colour
+	if status.ID == "" {
+		status.Key = statusKey(in.Label)
+		status.Category = models.StatusCategory(in.Category)
+	}
+
+	switch {
+	case status.Label == "":
+		errs["label"] = "Enter a name"
+	case len(status.Label) > 50:
+		errs["label"] = "Keep the name under 50 characters"
+	case status.Key == "":
+		errs["label"] = "Use at least one letter or digit in the name"
+	}
+	if _, ok := models.StatusColours[status.Colour]; !ok {
+		errs["colour"] = "Choose a colour"
+	}
+	switch status.Category {
+	case models.CategoryOpen, models.CategoryWaiting, models.CategoryDone:
+	default:
+		errs["category"] = "Choose whether tickets in this status are open, waiting or done"
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// statusKey turns a label like "Waiting for Parts" into waiting_for_parts
+func statusKey(label string) models.Status {
+	var key strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(label) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if underscore && key.Len() > 0 {
+				key.WriteByte('_')
+			}
+			key.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return models.Status(key.String())
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"testing"
+
+	"flexsupport/internal/models"
+)
+
+func TestSSOInputIssuer(t *testing.T) {
+	tests := []struct {
+		issuer       string
+		localIssuers bool
+		wantErr      bool
+	}{
+		{"https://accounts.google.com", false, false},
+		{"https://localhost:8443", false, false},
+		{"http://localhost:5556", true, false},
+		{"http://127.0.0.1:5556", true, false},
+		{"http://localhost:5556", false, true},
+		{"http://127.0.0.1:5556", false, true},
+		{"http://idp.example.com", true, true},
+		{"ftp://localhost", true, true},
+	}
+	for _, tt := range tests {
+		var cfg models.OIDCConfig
+		errs := SSOInput{Issuer: tt.issuer}.apply(&cfg, tt.localIssuers)
+		if _, got := errs["issuer"]; got != tt.wantErr {
+			t.Errorf("apply() with issuer %q and localIssuers %t gave issuer error %t, want %t", tt.issuer, tt.localIssuers, got, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,608 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"flexsupport/internal/forms"
+	"flexsupport/internal/httputil"
+	"flexsupport/internal/layout"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/routes/account"
+	"flexsupport/internal/routes/messaging"
+	"flexsupport/internal/routes/portal"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	Handler interface {
+		SSO(w http.ResponseWriter, r *http.Request)
+		SaveSSO(w http.ResponseWriter, r *http.Request)
+		Projects(w http.ResponseWriter, r *http.Request)
+		AddProjectMember(w http.ResponseWriter, r *http.Request)
+		RemoveProjectMember(w http.ResponseWriter, r *http.Request)
+		Statuses(w http.ResponseWriter, r *http.Request)
+		CreateStatus(w http.ResponseWriter, r *http.Request)
+		UpdateStatus(w http.ResponseWriter, r *http.Request)
+		MoveStatus(w http.ResponseWriter, r *http.Request)
+		Invitations(w http.ResponseWriter, r *http.Request)
+		Invite(w http.ResponseWriter, r *http.Request)
+		RevokeInvitation(w http.ResponseWriter, r *http.Request)
+		Notifications(w http.ResponseWriter, r *http.Request)
+		SaveNotification(w http.ResponseWriter, r *http.Request)
+		SaveSMS(w http.ResponseWriter, r *http.Request)
+		DuplicateCustomers(w http.ResponseWriter, r *http.Request)
+		MergeCustomers(w http.ResponseWriter, r *http.Request)
+		Portal(w http.ResponseWriter, r *http.Request)
+		SavePortal(w http.ResponseWriter, r *http.Request)
+	}
+
+	handler struct {
+		log     *slog.Logger
+		service Service
+		secure  bool
+	}
+)
+
+func NewHandler(log *slog.Logger, svc Service, secure bool) Handler {
+	return &handler{
+		log:     log.With("Handler", "Admin"),
+		service: svc,
+		secure:  secure,
+	}
+}
+
+func Mount(r chi.Router, h Handler) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(mw.RequirePermission(models.PermTenantAdmin))
+			r.Get("/sso", h.SSO)
+			r.Post("/sso", h.SaveSSO)
+			r.Get("/notifications", h.Notifications)
+			r.Post("/notifications/{status}", h.SaveNotification)
+			r.Post("/sms", h.SaveSMS)
+			r.Get("/customers/duplicates", h.DuplicateCustomers)
+			r.Post("/customers/merge", h.MergeCustomers)
+			r.Get("/portal", h.Portal)
+			r.Post("/portal", h.SavePortal)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(mw.RequirePermission(models.PermMemberManage))
+			r.Get("/projects", h.Projects)
+			r.Post("/projects/{projectId}/members", h.AddProjectMember)
+			r.Delete("/projects/{projectId}/members/{userId}", h.RemoveProjectMember)
+			r.Get("/invitations", h.Invitations)
+			r.Post("/invitations", h.Invite)
+			r.Post("/invitations/{invitationId}/revoke", h.RevokeInvitation)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(mw.RequirePermission(models.PermProjectAdmin))
+			r.Get("/statuses", h.Statuses)
+			r.Post("/statuses", h.CreateStatus)
+			r.Post("/statuses/{statusId}", h.UpdateStatus)
+			r.Post("/statuses/{statusId}/move", h.MoveStatus)
+		})
+	})
+}
+
+func (h handler) SSO(w http.ResponseWriter, r *http.Request) {
+	integration, cfg, err := h.service.SSO(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	roles, err := h.service.Roles(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params := SSOParams{
+		Enabled:     integration.Enabled,
+		Config:      cfg,
+		Roles:       roles,
+		CallbackURL: account.CallbackURL(r, h.secure),
+	}
+	err = layout.BaseLayout(SSOPage(params)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) SaveSSO(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	integration, cfg, err := h.service.SaveSSO(r.Context(), readSSOInput(r))
+	roles, rolesErr := h.service.Roles(r.Context())
+	if rolesErr != nil {
+		http.Error(w, rolesErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	params := SSOParams{
+		Enabled:     integration.Enabled,
+		Config:      cfg,
+		Roles:       roles,
+		CallbackURL: account.CallbackURL(r, h.secure),
+	}
+	if err != nil {
+		var errs forms.FieldErrors
+		if !errors.As(err, &errs) {
+			h.log.Error("failed to save SSO settings", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		params.Errors = errs
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		params.Saved = true
+	}
+
+	if httputil.IsHTMX(r) {
+		err = SSOForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(SSOPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render SSO settings", "error", err)
+	}
+}
+
+func (h handler) Projects(w http.ResponseWriter, r *http.Request) {
+	projects, err := h.service.Projects(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	members, err := h.service.Members(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = layout.BaseLayout(ProjectsPage(projects, members)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) AddProjectMember(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	project, err := h.service.AddProjectMember(r.Context(), chi.URLParam(r, "projectId"), r.PostFormValue("user_id"))
+	h.renderProject(w, r, project, err)
+}
+
+func (h handler) RemoveProjectMember(w http.ResponseWriter, r *http.Request) {
+	project, err := h.service.RemoveProjectMember(r.Context(), chi.URLParam(r, "projectId"), chi.URLParam(r, "userId"))
+	h.renderProject(w, r, project, err)
+}
+
+// renderProject swaps the project's card after a membership change, with the
+// form error when the change was rejected
+func (h handler) renderProject(w http.ResponseWriter, r *http.Request, project ProjectMembers, err error) {
+	var errs forms.FieldErrors
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	case errors.As(err, &errs):
+	case err != nil:
+		h.log.Error("failed to change project members", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	members, err := h.service.Members(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, "/admin/projects", http.StatusSeeOther)
+		return
+	}
+	if errs != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := ProjectCard(project, members, errs).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render project members", "error", err)
+	}
+}
+
+func (h handler) Statuses(w http.ResponseWriter, r *http.Request) {
+	statuses, err := h.service.Statuses(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = layout.BaseLayout(StatusesPage(StatusesParams{Statuses: statuses})).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) CreateStatus(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	in := readStatusInput(r)
+	_, err := h.service.CreateStatus(r.Context(), in)
+	if err == nil {
+		redirect(w, r, "/admin/statuses")
+		return
+	}
+	var errs forms.FieldErrors
+	if !errors.As(err, &errs) {
+		h.log.Error("failed to create status", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	params := StatusesParams{Input: in, Errors: errs}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if httputil.IsHTMX(r) {
+		err = StatusForm(params).Render(r.Context(), w)
+	} else {
+		params.Statuses, err = h.service.Statuses(r.Context())
+		if err == nil {
+			err = layout.BaseLayout(StatusesPage(params)).Render(r.Context(), w)
+		}
+	}
+	if err != nil {
+		h.log.Error("failed to render status form", "error", err)
+	}
+}
+
+// UpdateStatus renames a status and swaps the list, showing the submitted
+// values when they are rejected
+func (h handler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	status, err := h.service.UpdateStatus(r.Context(), chi.URLParam(r, "statusId"), readStatusInput(r))
+	var errs forms.FieldErrors
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		http.Error(w, "Status not found", http.StatusNotFound)
+		return
+	case errors.As(err, &errs):
+	case err != nil:
+		h.log.Error("failed to update status", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		if errs != nil {
+			http.Error(w, errs.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Redirect(w, r, "/admin/statuses", http.StatusSeeOther)
+		return
+	}
+	statuses, err := h.service.Statuses(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range statuses {
+		if statuses[i].ID == status.ID {
+			statuses[i] = status
+		}
+	}
+	if errs != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := StatusList(statuses, status.ID, errs).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render statuses", "error", err)
+	}
+}
+
+func (h handler) MoveStatus(w http.ResponseWriter, r *http.Request) {
+	up := r.URL.Query().Get("direction") == "up"
+	statuses, err := h.service.MoveStatus(r.Context(), chi.URLParam(r, "statusId"), up)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		http.Error(w, "Status not found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log.Error("failed to move status", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, "/admin/statuses", http.StatusSeeOther)
+		return
+	}
+	if err := StatusList(statuses, "", nil).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render statuses", "error", err)
+	}
+}
+
+func (h handler) Invitations(w http.ResponseWriter, r *http.Request) {
+	params, err := h.invitationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params.Sent = r.URL.Query().Get("sent")
+	err = layout.BaseLayout(InvitationsPage(params)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) Invite(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	in := readInviteInput(r)
+	invitation, err := h.service.Invite(r.Context(), in, account.InviteURL(r, h.secure))
+	if err == nil {
+		redirect(w, r, "/admin/invitations?sent="+url.QueryEscape(invitation.Email))
+		return
+	}
+	var errs forms.FieldErrors
+	if !errors.As(err, &errs) {
+		h.log.Error("failed to invite member", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	params, err := h.invitationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params.Input, params.Errors = in, errs
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if httputil.IsHTMX(r) {
+		err = InviteForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(InvitationsPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render invite form", "error", err)
+	}
+}
+
+func (h handler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	err := h.service.RevokeInvitation(r.Context(), chi.URLParam(r, "invitationId"))
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log.Error("failed to revoke invitation", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, "/admin/invitations", http.StatusSeeOther)
+		return
+	}
+	invitations, err := h.service.Invitations(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := InvitationList(invitations).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render invitations", "error", err)
+	}
+}
+
+func (h handler) invitationParams(r *http.Request) (InvitationsParams, error) {
+	invitations, err := h.service.Invitations(r.Context())
+	if err != nil {
+		return InvitationsParams{}, err
+	}
+	roles, err := h.service.Roles(r.Context())
+	if err != nil {
+		return InvitationsParams{}, err
+	}
+	return InvitationsParams{Invitations: invitations, Roles: roles}, nil
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if httputil.IsHTMX(r) {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+func (h handler) Notifications(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.service.Notifications(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	integration, cfg, err := h.service.SMS(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params := SMSParams{
+		Enabled:     integration.Enabled,
+		Config:      cfg,
+		WebhookURL:  messaging.WebhookURL(r, h.secure),
+		FakeAllowed: h.service.FakeSMSAllowed(),
+	}
+	err = layout.BaseLayout(NotificationsPage(settings, params)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SaveNotification saves one status's customer message and swaps its card
+func (h handler) SaveNotification(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	setting, err := h.service.SaveNotification(r.Context(), models.Status(chi.URLParam(r, "status")), readNotificationInput(r))
+	var errs forms.FieldErrors
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		http.Error(w, "Status not found", http.StatusNotFound)
+		return
+	case errors.As(err, &errs):
+	case err != nil:
+		h.log.Error("failed to save customer notification", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, "/admin/notifications", http.StatusSeeOther)
+		return
+	}
+	if errs != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := NotificationCard(setting, errs, errs == nil).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render customer notification", "error", err)
+	}
+}
+
+// SaveSMS saves the text message settings and swaps the form
+func (h handler) SaveSMS(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	integration, cfg, err := h.service.SaveSMS(r.Context(), readSMSInput(r))
+	params := SMSParams{
+		Enabled:     integration.Enabled,
+		Config:      cfg,
+		WebhookURL:  messaging.WebhookURL(r, h.secure),
+		FakeAllowed: h.service.FakeSMSAllowed(),
+	}
+	if err != nil {
+		var errs forms.FieldErrors
+		if !errors.As(err, &errs) {
+			h.log.Error("failed to save SMS settings", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		params.Errors = errs
+	} else {
+		params.Saved = true
+	}
+	if !httputil.IsHTMX(r) {
+		if params.Errors != nil {
+			http.Error(w, params.Errors.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Redirect(w, r, "/admin/notifications", http.StatusSeeOther)
+		return
+	}
+	if params.Errors != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := SMSForm(params).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render SMS settings", "error", err)
+	}
+}
+
+func (h handler) DuplicateCustomers(w http.ResponseWriter, r *http.Request) {
+	duplicates, err := h.service.DuplicateCustomers(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = layout.BaseLayout(DuplicatesPage(duplicates)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// MergeCustomers merges one customer of a pair into the other and swaps in
+// the refreshed list, since the merged customer may have been in other pairs
+func (h handler) MergeCustomers(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	merge, err := h.service.MergeCustomers(r.Context(), r.PostFormValue("keep"), r.PostFormValue("merge"))
+	if err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			http.Error(w, "Customer not found", http.StatusNotFound)
+			return
+		}
+		h.log.Error("failed to merge customers", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, "/admin/customers/duplicates", http.StatusSeeOther)
+		return
+	}
+	duplicates, err := h.service.DuplicateCustomers(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := DuplicateList(duplicates, &merge).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render duplicate customers", "error", err)
+	}
+}
+
+func (h handler) Portal(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.service.Portal(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params := PortalParams{Settings: settings, URL: portal.URL(r, h.secure)}
+	err = layout.BaseLayout(PortalPage(params)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SavePortal saves the customer portal settings and swaps the form
+func (h handler) SavePortal(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	settings, err := h.service.SavePortal(r.Context(), readPortalInput(r))
+	params := PortalParams{Settings: settings, URL: portal.URL(r, h.secure)}
+	if err != nil {
+		var errs forms.FieldErrors
+		if !errors.As(err, &errs) {
+			h.log.Error("failed to save portal settings", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		params.Errors = errs
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		params.Saved = true
+	}
+
+	if httputil.IsHTMX(r) {
+		err = PortalForm(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(PortalPage(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render portal settings", "error", err)
+	}
+}
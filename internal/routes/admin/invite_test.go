@@ -0,0 +1,351 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"flexsupport/internal/mail"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/routes/account"
+	"flexsupport/internal/sms"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// acceptPath is where the emailed invitation links point
+const acceptPath = "/invitations/accept"
+
+var tenant = models.Tenant{ID: "tenant-1", Slug: "shop", Name: "Shop"}
+
+// fakeMailer keeps sent messages so tests can follow their links
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+var tokenParam = regexp.MustCompile(`[?&]token=([A-Za-z0-9_-]+)`)
+
+// token returns the invitation token from the last message sent
+func (f *fakeMailer) token(t *testing.T) string {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.sent) == 0 {
+		t.Fatal("no invitation was emailed")
+	}
+	msg := f.sent[len(f.sent)-1]
+	match := tokenParam.FindStringSubmatch(msg.Text + msg.HTML)
+	if match == nil {
+		t.Fatalf("invitation email has no token link:\n%s", msg.HTML)
+	}
+	return match[1]
+}
+
+// inviteStore is the users, roles, invitations and sessions the invite flow
+// touches, in memory
+type inviteStore struct {
+	ports.UserRepository
+	users       map[string]models.User
+	memberships map[string]string
+	invitations map[string]models.Invitation
+}
+
+func newInviteStore() *inviteStore {
+	return &inviteStore{
+		users:       map[string]models.User{},
+		memberships: map[string]string{},
+		invitations: map[string]models.Invitation{},
+	}
+}
+
+func (s *inviteStore) GetUser(ctx context.Context, id string) (models.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ports.ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *inviteStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return models.User{}, ports.ErrNotFound
+}
+
+func (s *inviteStore) CreateUser(ctx context.Context, user *models.User) error {
+	user.ID = "user-" + user.Email
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *inviteStore) MembershipStatus(ctx context.Context, tenantID, userID string) (string, error) {
+	status, ok := s.memberships[tenantID+"/"+userID]
+	if !ok {
+		return "", ports.ErrNotFound
+	}
+	return status, nil
+}
+
+func (s *inviteStore) RecordLogin(ctx context.Context, userID string) error {
+	return nil
+}
+
+type inviteRoles struct {
+	ports.RoleRepository
+}
+
+func (inviteRoles) GetRoleByName(ctx context.Context, tenantID, name string) (models.Role, error) {
+	if name != "Technician" {
+		return models.Role{}, ports.ErrNotFound
+	}
+	return models.Role{ID: "2b1d3a4e-5f60-4a7b-8c9d-0e1f2a3b4c5d", TenantID: tenantID, Name: name}, nil
+}
+
+type inviteInvitations struct {
+	ports.InvitationRepository
+	*inviteStore
+}
+
+func (s inviteInvitations) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	invitation.ID = "6f1c2d3e-4a5b-4c6d-8e7f-9a0b1c2d3e4f"
+	s.invitations[invitation.ID] = *invitation
+	s.memberships[invitation.TenantID+"/"+invitation.UserID] = models.MembershipInvited
+	return nil
+}
+
+func (s inviteInvitations) GetInvitationByToken(ctx context.Context, tenantID, tokenHash string) (models.Invitation, error) {
+	for _, invitation := range s.invitations {
+		if invitation.TenantID == tenantID && invitation.TokenHash == tokenHash {
+			return invitation, nil
+		}
+	}
+	return models.Invitation{}, ports.ErrNotFound
+}
+
+func (s inviteInvitations) RevokeInvitation(ctx context.Context, tenantID, id string) error {
+	invitation, ok := s.invitations[id]
+	if !ok || invitation.TenantID != tenantID {
+		return ports.ErrNotFound
+	}
+	now := time.Now()
+	invitation.RevokedAt = &now
+	s.invitations[id] = invitation
+	return nil
+}
+
+func (s inviteInvitations) AcceptInvitation(ctx context.Context, invitation models.Invitation, passwordHash string) error {
+	stored := s.invitations[invitation.ID]
+	if stored.AcceptedAt != nil || stored.RevokedAt != nil || stored.IsExpired() {
+		return ports.ErrConflict
+	}
+	now := time.Now()
+	stored.AcceptedAt = &now
+	s.invitations[invitation.ID] = stored
+	user := s.users[invitation.UserID]
+	user.EmailVerified = true
+	if passwordHash != "" {
+		user.PasswordHash = passwordHash
+	}
+	s.users[user.ID] = user
+	s.memberships[invitation.TenantID+"/"+invitation.UserID] = models.MembershipActive
+	return nil
+}
+
+type inviteSessions struct {
+	ports.SessionRepository
+}
+
+func (inviteSessions) CreateSession(ctx context.Context, session *models.Session) error {
+	return nil
+}
+
+type inviteTest struct {
+	admin  Service
+	store  *inviteStore
+	mailer *fakeMailer
+	server *httptest.Server
+	ctx    context.Context
+}
+
+// newInviteTest wires the admin service that sends invitations to the
+// account pages that accept them
+func newInviteTest(t *testing.T, inviteTTL time.Duration) *inviteTest {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := newInviteStore()
+	invitations := inviteInvitations{inviteStore: store}
+	mailer := &fakeMailer{}
+	admin := NewService(log, nil, inviteRoles{}, nil, store, invitations, nil, nil, nil, nil, mailer, sms.Providers{}, inviteTTL, false)
+	accounts := account.NewService(log, store, inviteSessions{}, nil, nil, nil, invitations, nil, nil, mailer, time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(mw.WithTenant(r.Context(), tenant)))
+		})
+	})
+	account.Mount(r, account.NewHandler(log, accounts, false))
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return &inviteTest{
+		admin:  admin,
+		store:  store,
+		mailer: mailer,
+		server: server,
+		ctx:    mw.WithTenant(context.Background(), tenant),
+	}
+}
+
+// invite sends an invitation and returns it with the token from its email
+func (it *inviteTest) invite(t *testing.T) (models.Invitation, string) {
+	t.Helper()
+	in := InviteInput{Email: "erin@example.com", Name: "Erin", Role: "Technician"}
+	invitation, err := it.admin.Invite(it.ctx, in, it.server.URL+acceptPath)
+	if err != nil {
+		t.Fatalf("Invite() error = %v", err)
+	}
+	return invitation, it.mailer.token(t)
+}
+
+var noRedirects = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func (it *inviteTest) get(t *testing.T, token string) (*http.Response, string) {
+	t.Helper()
+	return readResponse(t)(noRedirects.Get(it.server.URL + acceptPath + "?token=" + url.QueryEscape(token)))
+}
+
+func (it *inviteTest) accept(t *testing.T, token, password string) (*http.Response, string) {
+	t.Helper()
+	form := url.Values{"token": {token}, "password": {password}, "confirm": {password}}
+	return readResponse(t)(noRedirects.PostForm(it.server.URL+acceptPath, form))
+}
+
+func readResponse(t *testing.T) func(*http.Response, error) (*http.Response, string) {
+	return func(resp *http.Response, err error) (*http.Response, string) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		return resp, string(body)
+	}
+}
+
+func sessionCookie(resp *http.Response) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == mw.SessionCookie && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	it := newInviteTest(t, time.Hour)
+	invitation, token := it.invite(t)
+
+	resp, body := it.get(t, token)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "erin@example.com") {
+		t.Fatalf("GET = %d, want 200 showing the invitee:\n%s", resp.StatusCode, body)
+	}
+
+	resp, _ = it.accept(t, token, "short")
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("POST with a short password = %d, want 422", resp.StatusCode)
+	}
+
+	resp, _ = it.accept(t, token, "correct horse battery")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/" {
+		t.Fatalf("POST = %d to %q, want 303 to /", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if sessionCookie(resp) == nil {
+		t.Error("accepting did not sign the invitee in")
+	}
+	user := it.store.users[invitation.UserID]
+	if user.PasswordHash == "" || !user.EmailVerified {
+		t.Errorf("invitee after accepting = %+v, want a password and a verified email", user)
+	}
+	if status := it.store.memberships[tenant.ID+"/"+user.ID]; status != models.MembershipActive {
+		t.Errorf("membership = %q, want active", status)
+	}
+}
+
+func TestAcceptInvitationRefused(t *testing.T) {
+	tests := []struct {
+		name      string
+		inviteTTL time.Duration
+		// spoil runs after the invitation is sent and returns the token to use
+		spoil func(t *testing.T, it *inviteTest, invitation models.Invitation, token string) string
+	}{
+		{"expired", -time.Minute, func(t *testing.T, it *inviteTest, invitation models.Invitation, token string) string {
+			return token
+		}},
+		{"revoked", time.Hour, func(t *testing.T, it *inviteTest, invitation models.Invitation, token string) string {
+			if err := it.admin.RevokeInvitation(it.ctx, invitation.ID); err != nil {
+				t.Fatalf("RevokeInvitation() error = %v", err)
+			}
+			return token
+		}},
+		{"reused after accept", time.Hour, func(t *testing.T, it *inviteTest, invitation models.Invitation, token string) string {
+			if resp, _ := it.accept(t, token, "correct horse battery"); resp.StatusCode != http.StatusSeeOther {
+				t.Fatalf("first POST = %d, want 303", resp.StatusCode)
+			}
+			return token
+		}},
+		{"unknown token", time.Hour, func(t *testing.T, it *inviteTest, invitation models.Invitation, token string) string {
+			return "not-" + token
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := newInviteTest(t, tt.inviteTTL)
+			invitation, token := it.invite(t)
+			token = tt.spoil(t, it, invitation, token)
+			before := it.store.users[invitation.UserID]
+
+			if resp, _ := it.get(t, token); resp.StatusCode != http.StatusGone {
+				t.Errorf("GET = %d, want 410", resp.StatusCode)
+			}
+			resp, _ := it.accept(t, token, "another password entirely")
+			if resp.StatusCode != http.StatusGone {
+				t.Errorf("POST = %d, want 410", resp.StatusCode)
+			}
+			if sessionCookie(resp) != nil {
+				t.Error("refused invitation signed someone in")
+			}
+			if after := it.store.users[invitation.UserID]; after.PasswordHash != before.PasswordHash {
+				t.Error("refused invitation changed the invitee's password")
+			}
+		})
+	}
+}
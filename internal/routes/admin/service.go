@@ -0,0 +1,659 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"flexsupport/internal/auth"
+	"flexsupport/internal/forms"
+	"flexsupport/internal/mail"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/notify"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/routes/account"
+	"flexsupport/internal/sms"
+	"flexsupport/internal/utils"
+)
+
+type (
+	Service interface {
+		SSO(ctx context.Context) (models.Integration, models.OIDCConfig, error)
+		SaveSSO(ctx context.Context, in SSOInput) (models.Integration, models.OIDCConfig, error)
+		Roles(ctx context.Context) ([]models.Role, error)
+		Projects(ctx context.Context) ([]ProjectMembers, error)
+		Members(ctx context.Context) ([]models.User, error)
+		AddProjectMember(ctx context.Context, projectID, userID string) (ProjectMembers, error)
+		RemoveProjectMember(ctx context.Context, projectID, userID string) (ProjectMembers, error)
+		Statuses(ctx context.Context) ([]models.TicketStatus, error)
+		CreateStatus(ctx context.Context, in StatusInput) (models.TicketStatus, error)
+		UpdateStatus(ctx context.Context, id string, in StatusInput) (models.TicketStatus, error)
+		MoveStatus(ctx context.Context, id string, up bool) ([]models.TicketStatus, error)
+		Invitations(ctx context.Context) ([]models.Invitation, error)
+		Invite(ctx context.Context, in InviteInput, acceptURL string) (models.Invitation, error)
+		RevokeInvitation(ctx context.Context, id string) error
+		Notifications(ctx context.Context) ([]StatusNotification, error)
+		SaveNotification(ctx context.Context, status models.Status, in NotificationInput) (StatusNotification, error)
+		SMS(ctx context.Context) (models.Integration, models.SMSConfig, error)
+		SaveSMS(ctx context.Context, in SMSInput) (models.Integration, models.SMSConfig, error)
+		FakeSMSAllowed() bool
+		DuplicateCustomers(ctx context.Context) ([]models.DuplicateCustomers, error)
+		MergeCustomers(ctx context.Context, keepID, mergeID string) (models.CustomerMerge, error)
+		Portal(ctx context.Context) (models.PortalSettings, error)
+		SavePortal(ctx context.Context, in PortalInput) (models.PortalSettings, error)
+	}
+
+	service struct {
+		log           *slog.Logger
+		integrations  ports.IntegrationRepository
+		roles         ports.RoleRepository
+		projects      ports.ProjectRepository
+		users         ports.UserRepository
+		invitations   ports.InvitationRepository
+		notifications ports.NotificationRepository
+		customers     ports.CustomerRepository
+		portal        ports.PortalRepository
+		oidc          *auth.OIDCClient
+		mailer        mail.Sender
+		texts         sms.Providers
+		inviteTTL     time.Duration
+		// localIssuers accepts plain http SSO issuers on localhost, as in
+		// development
+		localIssuers bool
+	}
+)
+
+// StatusNotification is a status with the message customers get when their
+// ticket enters it
+type StatusNotification struct {
+	Status models.TicketStatus
+	Email  models.NotificationTemplate
+	SMS    models.NotificationTemplate
+}
+
+// ProjectMembers is a project with the people who may work in it
+type ProjectMembers struct {
+	Project models.Project
+	Members []models.ProjectMember
+}
+
+func NewService(
+	log *slog.Logger,
+	integrations ports.IntegrationRepository,
+	roles ports.RoleRepository,
+	projects ports.ProjectRepository,
+	users ports.UserRepository,
+	invitations ports.InvitationRepository,
+	notifications ports.NotificationRepository,
+	customers ports.CustomerRepository,
+	portal ports.PortalRepository,
+	oidc *auth.OIDCClient,
+	mailer mail.Sender,
+	texts sms.Providers,
+	inviteTTL time.Duration,
+	localIssuers bool,
+) Service {
+	return &service{
+		log:           log.With("Service", "Admin"),
+		integrations:  integrations,
+		roles:         roles,
+		projects:      projects,
+		users:         users,
+		invitations:   invitations,
+		notifications: notifications,
+		customers:     customers,
+		portal:        portal,
+		oidc:          oidc,
+		mailer:        mailer,
+		texts:         texts,
+		inviteTTL:     inviteTTL,
+		localIssuers:  localIssuers,
+	}
+}
+
+func (s service) Roles(ctx context.Context) ([]models.Role, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.roles.ListRoles(ctx, tenantID)
+}
+
+// SSO loads the tenant's oidc integration, or a new disabled one
+func (s service) SSO(ctx context.Context) (models.Integration, models.OIDCConfig, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Integration{}, models.OIDCConfig{}, err
+	}
+	integration, err := s.integrations.GetIntegration(ctx, tenantID, models.IntegrationOIDC, account.SSOIntegration)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return models.Integration{
+			TenantID: tenantID,
+			Type:     models.IntegrationOIDC,
+			Name:     account.SSOIntegration,
+		}, models.OIDCConfig{}, nil
+	case err != nil:
+		return models.Integration{}, models.OIDCConfig{}, err
+	}
+	cfg, err := integration.OIDC()
+	if err != nil {
+		return integration, cfg, fmt.Errorf("failed to decode oidc config: %w", err)
+	}
+	return integration, cfg, nil
+}
+
+// SaveSSO validates and stores the single sign-on settings. When enabling, the
+// issuer's discovery document must load so a typo cannot lock staff out.
+func (s service) SaveSSO(ctx context.Context, in SSOInput) (models.Integration, models.OIDCConfig, error) {
+	integration, cfg, err := s.SSO(ctx)
+	if err != nil {
+		return integration, cfg, err
+	}
+	integration.Enabled = in.Enabled
+	errs := in.apply(&cfg, s.localIssuers)
+	if cfg.DefaultRole != "" {
+		if _, err := s.roles.GetRoleByName(ctx, integration.TenantID, cfg.DefaultRole); errors.Is(err, ports.ErrNotFound) {
+			if errs == nil {
+				errs = forms.FieldErrors{}
+			}
+			errs["default_role"] = "Choose one of the shop's roles"
+		} else if err != nil {
+			return integration, cfg, err
+		}
+	}
+	if errs != nil {
+		return integration, cfg, errs
+	}
+	if in.Enabled {
+		if _, err := s.oidc.Discover(ctx, cfg.Issuer); err != nil {
+			s.log.Warn("OIDC discovery failed", "issuer", cfg.Issuer, "error", err)
+			return integration, cfg, forms.FieldErrors{"issuer": "Could not load the discovery document from this issuer"}
+		}
+	}
+
+	integration.Config, err = json.Marshal(cfg)
+	if err != nil {
+		return integration, cfg, fmt.Errorf("failed to encode oidc config: %w", err)
+	}
+	if err := s.integrations.SaveIntegration(ctx, &integration); err != nil {
+		return integration, cfg, err
+	}
+	s.log.Info("Saved SSO settings", "enabled", integration.Enabled, "issuer", cfg.Issuer)
+	return integration, cfg, nil
+}
+
+// Projects lists every active project with its members
+func (s service) Projects(ctx context.Context) ([]ProjectMembers, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := s.projects.ListProjects(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ProjectMembers, 0, len(projects))
+	for _, project := range projects {
+		members, err := s.projects.ListProjectMembers(ctx, tenantID, project.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ProjectMembers{Project: project, Members: members})
+	}
+	return result, nil
+}
+
+// Members lists the shop's active staff, who can be added to projects
+func (s service) Members(ctx context.Context) ([]models.User, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.users.ListMembers(ctx, tenantID)
+}
+
+// AddProjectMember lets a member of the shop work in the project. Anyone else
+// is rejected as a forms.FieldErrors on user_id.
+func (s service) AddProjectMember(ctx context.Context, projectID, userID string) (ProjectMembers, error) {
+	project, err := s.project(ctx, projectID)
+	if err != nil {
+		return ProjectMembers{}, err
+	}
+	if !utils.IsUUID(userID) {
+		return project, forms.FieldErrors{"user_id": "Choose a member of this shop"}
+	}
+	err = s.projects.AddProjectMember(ctx, project.Project.TenantID, project.Project.ID, userID)
+	if errors.Is(err, ports.ErrNotFound) {
+		return project, forms.FieldErrors{"user_id": "Choose a member of this shop"}
+	}
+	if err != nil {
+		return project, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Added project member", "project", project.Project.Key, "user", userID, "by", by)
+	return s.project(ctx, projectID)
+}
+
+func (s service) RemoveProjectMember(ctx context.Context, projectID, userID string) (ProjectMembers, error) {
+	project, err := s.project(ctx, projectID)
+	if err != nil {
+		return ProjectMembers{}, err
+	}
+	if err := s.projects.RemoveProjectMember(ctx, project.Project.TenantID, project.Project.ID, userID); err != nil {
+		return project, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Removed project member", "project", project.Project.Key, "user", userID, "by", by)
+	return s.project(ctx, projectID)
+}
+
+func (s service) project(ctx context.Context, id string) (ProjectMembers, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return ProjectMembers{}, err
+	}
+	if !utils.IsUUID(id) {
+		return ProjectMembers{}, ports.ErrNotFound
+	}
+	project, err := s.projects.GetProject(ctx, tenantID, id)
+	if err != nil {
+		return ProjectMembers{}, err
+	}
+	members, err := s.projects.ListProjectMembers(ctx, tenantID, id)
+	if err != nil {
+		return ProjectMembers{}, err
+	}
+	return ProjectMembers{Project: project, Members: members}, nil
+}
+
+// Statuses lists the tenant-wide statuses in the order tickets move through
+// them
+func (s service) Statuses(ctx context.Context) ([]models.TicketStatus, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.projects.ListStatuses(ctx, tenantID, "")
+}
+
+// CreateStatus adds a status after the existing ones. Validation failures,
+// including a name taken by another status, are returned as forms.FieldErrors.
+func (s service) CreateStatus(ctx context.Context, in StatusInput) (models.TicketStatus, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.TicketStatus{}, err
+	}
+	status := models.TicketStatus{TenantID: tenantID}
+	if errs := in.apply(&status); errs != nil {
+		return status, errs
+	}
+	err = s.projects.CreateStatus(ctx, &status)
+	if errors.Is(err, ports.ErrConflict) {
+		return status, forms.FieldErrors{"label": "There is already a status with this name"}
+	}
+	if err != nil {
+		return status, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Created status", "status", status.Key, "by", by)
+	return status, nil
+}
+
+// UpdateStatus renames and recolours a status
+func (s service) UpdateStatus(ctx context.Context, id string, in StatusInput) (models.TicketStatus, error) {
+	status, _, err := s.status(ctx, id)
+	if err != nil {
+		return models.TicketStatus{}, err
+	}
+	if errs := in.apply(&status); errs != nil {
+		return status, errs
+	}
+	if err := s.projects.UpdateStatus(ctx, &status); err != nil {
+		return status, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Updated status", "status", status.Key, "label", status.Label, "by", by)
+	return status, nil
+}
+
+// MoveStatus swaps a status with the one before or after it and returns the
+// reordered list. Moving past either end leaves the order as it is.
+func (s service) MoveStatus(ctx context.Context, id string, up bool) ([]models.TicketStatus, error) {
+	_, statuses, err := s.status(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(statuses, func(status models.TicketStatus) bool { return status.ID == id })
+	j := i + 1
+	if up {
+		j = i - 1
+	}
+	if j < 0 || j >= len(statuses) {
+		return statuses, nil
+	}
+	statuses[i], statuses[j] = statuses[j], statuses[i]
+
+	ids := make([]string, len(statuses))
+	for k, status := range statuses {
+		ids[k] = status.ID
+		statuses[k].SortOrder = (k + 1) * 10
+	}
+	if err := s.projects.ReorderStatuses(ctx, statuses[0].TenantID, ids); err != nil {
+		return nil, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Moved status", "status", statuses[j].Key, "up", up, "by", by)
+	return statuses, nil
+}
+
+// status returns the tenant-wide status with the ID along with every
+// tenant-wide status
+func (s service) status(ctx context.Context, id string) (models.TicketStatus, []models.TicketStatus, error) {
+	if !utils.IsUUID(id) {
+		return models.TicketStatus{}, nil, ports.ErrNotFound
+	}
+	statuses, err := s.Statuses(ctx)
+	if err != nil {
+		return models.TicketStatus{}, nil, err
+	}
+	i := slices.IndexFunc(statuses, func(status models.TicketStatus) bool { return status.ID == id })
+	if i < 0 {
+		return models.TicketStatus{}, nil, ports.ErrNotFound
+	}
+	return statuses[i], statuses, nil
+}
+
+// Invitations lists invitations waiting to be accepted, newest first
+func (s service) Invitations(ctx context.Context) ([]models.Invitation, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.invitations.ListInvitations(ctx, tenantID)
+}
+
+// Invite emails someone a single-use link to join the shop with the chosen
+// role. People without an account get one, with no password until they
+// accept. Validation failures are returned as forms.FieldErrors.
+func (s service) Invite(ctx context.Context, in InviteInput, acceptURL string) (models.Invitation, error) {
+	tenant, ok := mw.TenantFromContext(ctx)
+	if !ok {
+		return models.Invitation{}, mw.ErrNoTenant
+	}
+	errs := in.validate()
+	if errs == nil {
+		errs = forms.FieldErrors{}
+	}
+	role, err := s.roles.GetRoleByName(ctx, tenant.ID, in.Role)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		errs["role"] = "Choose one of the shop's roles"
+	case err != nil:
+		return models.Invitation{}, err
+	}
+	if len(errs) > 0 {
+		return models.Invitation{}, errs
+	}
+
+	user, err := s.users.GetUserByEmail(ctx, in.Email)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		user = models.User{Name: in.Name, Email: in.Email}
+		if err := s.users.CreateUser(ctx, &user); err != nil {
+			return models.Invitation{}, err
+		}
+	case err != nil:
+		return models.Invitation{}, err
+	}
+	status, err := s.users.MembershipStatus(ctx, tenant.ID, user.ID)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+	case err != nil:
+		return models.Invitation{}, err
+	case status == models.MembershipActive:
+		return models.Invitation{}, forms.FieldErrors{"email": "They are already a member of this shop"}
+	case status == models.MembershipDisabled:
+		return models.Invitation{}, forms.FieldErrors{"email": "Their access to this shop has been disabled"}
+	}
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	invitation := models.Invitation{
+		TenantID:        tenant.ID,
+		UserID:          user.ID,
+		RoleID:          &role.ID,
+		TokenHash:       hash,
+		InvitedByUserID: mw.Actor(ctx),
+		ExpiresAt:       time.Now().Add(s.inviteTTL),
+		Email:           user.Email,
+		Name:            user.Name,
+		RoleName:        role.Name,
+	}
+	if err := s.invitations.CreateInvitation(ctx, &invitation); err != nil {
+		return models.Invitation{}, err
+	}
+
+	inviter, _ := mw.UserFromContext(ctx)
+	invitation.InvitedBy = inviter.Name
+	subject := fmt.Sprintf("You're invited to %s", tenant.Name)
+	msg, err := mail.Render(ctx, invitation.Email, subject, inviteEmail(tenant, invitation, acceptURL+"?token="+token))
+	if err != nil {
+		return invitation, err
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return invitation, fmt.Errorf("failed to email invitation: %w", err)
+	}
+	s.log.Info("Invited member", "user", user.ID, "role", role.Name, "by", inviter.ID)
+	return invitation, nil
+}
+
+func (s service) RevokeInvitation(ctx context.Context, id string) error {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+	if !utils.IsUUID(id) {
+		return ports.ErrNotFound
+	}
+	if err := s.invitations.RevokeInvitation(ctx, tenantID, id); err != nil {
+		return err
+	}
+	s.log.Info("Revoked invitation", "invitation", id)
+	return nil
+}
+
+// Notifications returns the tenant-wide statuses with their customer message,
+// the built-in wording where the tenant has not written its own
+func (s service) Notifications(ctx context.Context) ([]StatusNotification, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.projects.ListStatuses(ctx, tenantID, "")
+	if err != nil {
+		return nil, err
+	}
+	templates, err := s.notifications.ListNotificationTemplates(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	settings := make([]StatusNotification, 0, len(statuses))
+	for _, status := range statuses {
+		setting := StatusNotification{
+			Status: status,
+			Email:  models.DefaultNotificationTemplate(status.Key, models.ChannelEmail),
+			SMS:    models.DefaultNotificationTemplate(status.Key, models.ChannelSMS),
+		}
+		for _, t := range templates {
+			if t.StatusKey != status.Key {
+				continue
+			}
+			switch t.Channel {
+			case models.ChannelEmail:
+				setting.Email = t
+			case models.ChannelSMS:
+				setting.SMS = t
+			}
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// SaveNotification turns customer messages for the status on or off and
+// saves their wording. Validation failures are returned as forms.FieldErrors with
+// the submitted settings.
+func (s service) SaveNotification(ctx context.Context, status models.Status, in NotificationInput) (StatusNotification, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return StatusNotification{}, err
+	}
+	settings, err := s.Notifications(ctx)
+	if err != nil {
+		return StatusNotification{}, err
+	}
+	i := slices.IndexFunc(settings, func(n StatusNotification) bool { return n.Status.Key == status })
+	if i < 0 {
+		return StatusNotification{}, ports.ErrNotFound
+	}
+	setting := settings[i]
+	if errs := in.apply(&setting); errs != nil {
+		return setting, errs
+	}
+
+	if err := s.notifications.SetStatusNotify(ctx, tenantID, status, setting.Status.NotifyCustomer); err != nil {
+		return setting, err
+	}
+	for _, template := range []*models.NotificationTemplate{&setting.Email, &setting.SMS} {
+		template.TenantID = tenantID
+		if err := s.notifications.SaveNotificationTemplate(ctx, template); err != nil {
+			return setting, err
+		}
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Saved customer notification", "status", status, "notify", setting.Status.NotifyCustomer, "by", by)
+	return setting, nil
+}
+
+// SMS loads the tenant's sms integration, or a new disabled one
+func (s service) SMS(ctx context.Context) (models.Integration, models.SMSConfig, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Integration{}, models.SMSConfig{}, err
+	}
+	integration, err := s.integrations.GetIntegration(ctx, tenantID, models.IntegrationSMS, notify.SMSIntegration)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		return models.Integration{
+			TenantID: tenantID,
+			Type:     models.IntegrationSMS,
+			Name:     notify.SMSIntegration,
+		}, models.SMSConfig{Provider: models.SMSProviderTwilio}, nil
+	case err != nil:
+		return models.Integration{}, models.SMSConfig{}, err
+	}
+	cfg, err := integration.SMS()
+	if err != nil {
+		return integration, cfg, fmt.Errorf("failed to decode sms config: %w", err)
+	}
+	return integration, cfg, nil
+}
+
+// SaveSMS validates and stores the text message settings
+func (s service) SaveSMS(ctx context.Context, in SMSInput) (models.Integration, models.SMSConfig, error) {
+	integration, cfg, err := s.SMS(ctx)
+	if err != nil {
+		return integration, cfg, err
+	}
+	integration.Enabled = in.Enabled
+	if errs := in.apply(&cfg, s.texts); errs != nil {
+		return integration, cfg, errs
+	}
+
+	integration.Config, err = json.Marshal(cfg)
+	if err != nil {
+		return integration, cfg, fmt.Errorf("failed to encode sms config: %w", err)
+	}
+	if err := s.integrations.SaveIntegration(ctx, &integration); err != nil {
+		return integration, cfg, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Saved SMS settings", "enabled", integration.Enabled, "provider", cfg.Provider, "by", by)
+	return integration, cfg, nil
+}
+
+// FakeSMSAllowed reports whether the fake provider can be picked, which is
+// only outside production
+func (s service) FakeSMSAllowed() bool {
+	return s.texts.FakeAllowed()
+}
+
+// maxDuplicates caps the pairs listed at once; merging clears the way for more
+const maxDuplicates = 50
+
+// DuplicateCustomers lists pairs of customers who may be the same person,
+// contact matches first
+func (s service) DuplicateCustomers(ctx context.Context) ([]models.DuplicateCustomers, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.customers.FindDuplicateCustomers(ctx, tenantID, maxDuplicates)
+}
+
+// MergeCustomers folds the merge customer into the keep customer
+func (s service) MergeCustomers(ctx context.Context, keepID, mergeID string) (models.CustomerMerge, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.CustomerMerge{}, err
+	}
+	if !utils.IsUUID(keepID) || !utils.IsUUID(mergeID) || keepID == mergeID {
+		return models.CustomerMerge{}, ports.ErrNotFound
+	}
+	merge := models.CustomerMerge{
+		TenantID:         tenantID,
+		KeptCustomerID:   keepID,
+		MergedCustomerID: mergeID,
+		MergedByUserID:   mw.Actor(ctx),
+	}
+	if err := s.customers.MergeCustomers(ctx, &merge); err != nil {
+		return merge, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Merged customers", "kept", keepID, "merged", mergeID, "tickets", merge.TicketCount, "by", by)
+	return merge, nil
+}
+
+// Portal loads the customer portal settings with every active project's switch
+func (s service) Portal(ctx context.Context) (models.PortalSettings, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.PortalSettings{}, err
+	}
+	return s.portal.GetPortalSettings(ctx, tenantID)
+}
+
+// SavePortal validates and stores the customer portal settings
+func (s service) SavePortal(ctx context.Context, in PortalInput) (models.PortalSettings, error) {
+	settings, err := s.Portal(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if errs := in.apply(&settings); errs != nil {
+		return settings, errs
+	}
+	if err := s.portal.SavePortalSettings(ctx, &settings); err != nil {
+		return settings, err
+	}
+	by, _ := mw.UserID(ctx)
+	s.log.Info("Saved portal settings", "enabled", settings.Enabled, "by", by)
+	return settings, nil
+}
@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/sms"
+)
+
+func TestStatusKey(t *testing.T) {
+	tests := []struct {
+		label string
+		want  models.Status
+	}{
+		{"On Hold", "on_hold"},
+		{"  Waiting for Parts ", "waiting_for_parts"},
+		{"Ready -- for pickup!", "ready_for_pickup"},
+		{"QA 2", "qa_2"},
+		{"¿?", ""},
+	}
+	for _, tt := range tests {
+		if got := statusKey(tt.label); got != tt.want {
+			t.Errorf("statusKey(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
+
+// statusProjects keeps the tenant-wide statuses in memory
+type statusProjects struct {
+	ports.ProjectRepository
+	statuses []models.TicketStatus
+	order    []string
+}
+
+func (p *statusProjects) ListStatuses(ctx context.Context, tenantID, projectID string) ([]models.TicketStatus, error) {
+	return append([]models.TicketStatus(nil), p.statuses...), nil
+}
+
+func (p *statusProjects) ReorderStatuses(ctx context.Context, tenantID string, ids []string) error {
+	p.order = ids
+	return nil
+}
+
+func TestMoveStatus(t *testing.T) {
+	ids := []string{
+		"0b6f1c2d-3e4a-4b5c-8d6e-7f8091a2b3c4",
+		"1c7a2d3e-4f5b-4c6d-9e7f-8091a2b3c4d5",
+		"2d8b3e4f-5a6c-4d7e-8f80-91a2b3c4d5e6",
+	}
+	projects := &statusProjects{}
+	for i, id := range ids {
+		projects.statuses = append(projects.statuses, models.TicketStatus{ID: id, TenantID: tenant.ID, SortOrder: (i + 1) * 10})
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewService(log, nil, nil, projects, nil, nil, nil, nil, nil, nil, nil, sms.Providers{}, 0, false)
+	ctx := mw.WithTenant(context.Background(), tenant)
+
+	statuses, err := svc.MoveStatus(ctx, ids[2], true)
+	if err != nil {
+		t.Fatalf("MoveStatus() error = %v", err)
+	}
+	want := []string{ids[0], ids[2], ids[1]}
+	for i, id := range want {
+		if projects.order[i] != id || statuses[i].ID != id {
+			t.Fatalf("MoveStatus() saved %v and returned %v, want %v", projects.order, statuses, want)
+		}
+	}
+
+	projects.order = nil
+	if _, err := svc.MoveStatus(ctx, ids[0], true); err != nil || projects.order != nil {
+		t.Errorf("MoveStatus() of the first status up = %v, saved %v, want no change", err, projects.order)
+	}
+	if _, err := svc.MoveStatus(ctx, "not-a-status", false); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("MoveStatus() of an unknown status error = %v, want ErrNotFound", err)
+	}
+}
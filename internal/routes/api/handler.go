@@ -5,12 +5,17 @@ import (
 	"log/slog"
 	"net/http"
 
+	"flexsupport/internal/models"
+
 	"github.com/go-chi/chi/v5"
 )
 
 type (
 	Handler interface {
 		GetOpenTicketCount(w http.ResponseWriter, r *http.Request)
+		GetWaitingTicketCount(w http.ResponseWriter, r *http.Request)
+		GetOverdueTicketCount(w http.ResponseWriter, r *http.Request)
+		GetCompletedTodayCount(w http.ResponseWriter, r *http.Request)
 	}
 
 	handler struct {
@@ -30,19 +35,38 @@ func Mount(r chi.Router, h Handler) {
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/stats", func(r chi.Router) {
 			r.Get("/open", h.GetOpenTicketCount)
+			r.Get("/waiting", h.GetWaitingTicketCount)
+			r.Get("/overdue", h.GetOverdueTicketCount)
+			r.Get("/completed", h.GetCompletedTodayCount)
 		})
 	})
 }
 
 func (h *handler) GetOpenTicketCount(w http.ResponseWriter, r *http.Request) {
-	// TODO: Query database
-	count, err := h.service.OpenTicketsCount(r.Context())
+	h.writeStat(w, r, func(s models.TicketStats) int { return s.OpenTickets })
+}
+
+func (h *handler) GetWaitingTicketCount(w http.ResponseWriter, r *http.Request) {
+	h.writeStat(w, r, func(s models.TicketStats) int { return s.Waiting })
+}
+
+func (h *handler) GetOverdueTicketCount(w http.ResponseWriter, r *http.Request) {
+	h.writeStat(w, r, func(s models.TicketStats) int { return s.Overdue })
+}
+
+func (h *handler) GetCompletedTodayCount(w http.ResponseWriter, r *http.Request) {
+	h.writeStat(w, r, func(s models.TicketStats) int { return s.CompletedToday })
+}
+
+// writeStat renders one dashboard counter as plain text for htmx
+func (h *handler) writeStat(w http.ResponseWriter, r *http.Request, pick func(models.TicketStats) int) {
+	stats, err := h.service.Stats(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	countString := fmt.Sprintf("%d", count)
+	countString := fmt.Sprintf("%d", pick(stats))
 
 	fmt.Fprintf(w, "%s", countString)
 }
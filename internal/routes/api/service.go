@@ -3,23 +3,36 @@ package api
 import (
 	"context"
 	"log/slog"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
 )
 
 type (
 	Service interface {
-		OpenTicketsCount(ctx context.Context) (int, error)
+		Stats(ctx context.Context) (models.TicketStats, error)
 	}
 	service struct {
-		log *slog.Logger
+		log  *slog.Logger
+		repo ports.TicketRepository
 	}
 )
 
-func NewService(log *slog.Logger) Service {
+func NewService(log *slog.Logger, repo ports.TicketRepository) Service {
 	return &service{
-		log: log.With("Service", "api"),
+		log:  log.With("Service", "api"),
+		repo: repo,
 	}
 }
 
-func (s service) OpenTicketsCount(ctx context.Context) (int, error) {
-	return 2, nil
+func (s service) Stats(ctx context.Context) (models.TicketStats, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.TicketStats{}, err
+	}
+	return s.repo.TicketStats(ctx, models.TicketFilter{
+		TenantID:   tenantID,
+		ProjectIDs: mw.ProjectIDs(ctx),
+	})
 }
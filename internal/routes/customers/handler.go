@@ -0,0 +1,79 @@
+package customers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"flexsupport/internal/httputil"
+	"flexsupport/internal/layout"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	Handler interface {
+		List(w http.ResponseWriter, r *http.Request)
+		Get(w http.ResponseWriter, r *http.Request)
+	}
+
+	handler struct {
+		log     *slog.Logger
+		service Service
+	}
+)
+
+func NewHandler(log *slog.Logger, svc Service) Handler {
+	return &handler{
+		log:     log.With("Handler", "Customers"),
+		service: svc,
+	}
+}
+
+func Mount(r chi.Router, h Handler) {
+	r.Route("/customers", func(r chi.Router) {
+		r.Use(mw.RequirePermission(models.PermTicketRead))
+		r.Get("/", h.List)
+		r.Get("/{customerId}", h.Get)
+	})
+}
+
+// List shows the customer directory; htmx searches swap only the rows
+func (h handler) List(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
+	customers, err := h.service.Search(r.Context(), search)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if httputil.IsHTMX(r) {
+		err = CustomerRows(customers).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(CustomersPage(customers, search)).Render(r.Context(), w)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) Get(w http.ResponseWriter, r *http.Request) {
+	customer, tickets, err := h.service.Get(r.Context(), chi.URLParam(r, "customerId"))
+	if err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = layout.BaseLayout(CustomerPage(customer, tickets)).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,79 @@
+package customers
+
+import (
+	"context"
+	"log/slog"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/utils"
+)
+
+type (
+	Service interface {
+		Search(ctx context.Context, search string) ([]models.Customer, error)
+		Get(ctx context.Context, id string) (models.Customer, []models.Ticket, error)
+	}
+
+	service struct {
+		log       *slog.Logger
+		customers ports.CustomerRepository
+		tickets   ports.TicketRepository
+	}
+)
+
+func NewService(log *slog.Logger, customers ports.CustomerRepository, tickets ports.TicketRepository) Service {
+	return &service{
+		log:       log.With("Service", "Customers"),
+		customers: customers,
+		tickets:   tickets,
+	}
+}
+
+// Search lists customers by name, phone or email, counting only tickets in
+// the user's projects
+func (s service) Search(ctx context.Context, search string) ([]models.Customer, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.customers.ListCustomers(ctx, models.CustomerFilter{
+		TenantID:   tenantID,
+		ProjectIDs: mw.ProjectIDs(ctx),
+		Search:     search,
+		Limit:      100,
+	})
+}
+
+// Get loads a customer with their tickets in the user's projects, newest
+// first. TotalOrders and TotalSpend cover those tickets only.
+func (s service) Get(ctx context.Context, id string) (models.Customer, []models.Ticket, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Customer{}, nil, err
+	}
+	if !utils.IsUUID(id) {
+		return models.Customer{}, nil, ports.ErrNotFound
+	}
+	customer, err := s.customers.GetCustomer(ctx, tenantID, id, mw.ProjectIDs(ctx))
+	if err != nil {
+		return models.Customer{}, nil, err
+	}
+	tickets, err := s.tickets.ListTickets(ctx, models.TicketFilter{
+		TenantID:   tenantID,
+		ProjectIDs: mw.ProjectIDs(ctx),
+		CustomerID: customer.ID,
+	})
+	if err != nil {
+		return models.Customer{}, nil, err
+	}
+	customer.TotalOrders = len(tickets)
+	customer.TotalSpend = 0
+	for _, ticket := range tickets {
+		if ticket.IsClosed() {
+			customer.TotalSpend += ticket.TotalCost()
+		}
+	}
+	return customer, tickets, nil
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"flexsupport/internal/layout"
+	mw "flexsupport/internal/middleware"
 	"flexsupport/internal/models"
 	"flexsupport/internal/utils"
 
@@ -30,7 +31,7 @@ func NewHandler(log *slog.Logger, svc Service) Handler {
 }
 
 func Mount(r chi.Router, h Handler) {
-	r.Get("/", h.Get)
+	r.With(mw.RequirePermission(models.PermTicketRead)).Get("/", h.Get)
 }
 
 func (h handler) Get(w http.ResponseWriter, r *http.Request) {
@@ -39,10 +40,15 @@ func (h handler) Get(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	statuses, err := h.service.Statuses(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	isMobile := utils.IsMobileUA(r.UserAgent())
 	h.log.Debug("isMobile", "isMobile", isMobile)
 
-	v := layout.Handler(Dashboard(tickets, isMobile))
+	v := layout.Handler(Dashboard(tickets, statuses, isMobile))
 	v.ServeHTTP(w, r)
 }
 
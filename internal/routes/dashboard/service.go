@@ -3,56 +3,58 @@ package dashboard
 import (
 	"context"
 	"log/slog"
-	"time"
 
+	mw "flexsupport/internal/middleware"
 	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
 )
 
 type (
 	Service interface {
 		List(ctx context.Context) ([]models.Ticket, error)
+		Statuses(ctx context.Context) ([]models.TicketStatus, error)
 	}
 
 	service struct {
-		log *slog.Logger
+		log      *slog.Logger
+		repo     ports.TicketRepository
+		projects ports.ProjectRepository
 	}
 )
 
-func NewService(log *slog.Logger) Service {
+func NewService(log *slog.Logger, repo ports.TicketRepository, projects ports.ProjectRepository) Service {
 	return &service{
-		log: log.With("Dashboard Service"),
+		log:      log.With("Service", "Dashboard"),
+		repo:     repo,
+		projects: projects,
 	}
 }
 
-func (s service) List(context.Context) ([]models.Ticket, error) {
-	return getMockTickets(), nil
+func (s service) List(ctx context.Context) ([]models.Ticket, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListTickets(ctx, models.TicketFilter{
+		TenantID:   tenantID,
+		ProjectIDs: mw.ProjectIDs(ctx),
+		OpenOnly:   true,
+		Limit:      50,
+	})
 }
 
-func getMockTickets() []models.Ticket {
-	return []models.Ticket{
-		{
-			ID:               1001,
-			Status:           "new",
-			Priority:         "high",
-			CustomerName:     "John Doe",
-			CustomerPhone:    "(555) 123-4567",
-			ItemType:         models.Bag,
-			ItemModel:        "Backpack",
-			IssueDescription: "Broken strap, needs replacement",
-			AssignedTo:       "Mike Tech",
-			DueDate:          time.Now().Add(48 * time.Hour),
-		},
-		{
-			ID:               1002,
-			Status:           "in_progress",
-			Priority:         "normal",
-			CustomerName:     "Jane Smith",
-			CustomerPhone:    "(555) 987-6543",
-			ItemType:         models.Boot,
-			ItemModel:        "Keen",
-			IssueDescription: "Sole needs replaced",
-			AssignedTo:       "Sarah Tech",
-			DueDate:          time.Now().Add(72 * time.Hour),
-		},
+func (s service) Statuses(ctx context.Context) ([]models.TicketStatus, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	project, _ := mw.CurrentProject(ctx)
+	statuses, err := s.projects.ListStatuses(ctx, tenantID, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return models.DefaultStatuses, nil
 	}
+	return statuses, nil
 }
@@ -0,0 +1,77 @@
+package messaging
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"flexsupport/internal/httputil"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// WebhookPath receives inbound text messages from the sms provider
+const WebhookPath = "/webhooks/sms"
+
+// emptyTwiML tells Twilio not to reply; it sends its own STOP and START
+// confirmations
+const emptyTwiML = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+
+type (
+	Handler interface {
+		Inbound(w http.ResponseWriter, r *http.Request)
+	}
+
+	handler struct {
+		log     *slog.Logger
+		service Service
+		secure  bool
+	}
+)
+
+func NewHandler(log *slog.Logger, svc Service, secure bool) Handler {
+	return &handler{
+		log:     log.With("Handler", "messaging"),
+		service: svc,
+		secure:  secure,
+	}
+}
+
+func Mount(r chi.Router, h Handler) {
+	r.Post(WebhookPath, h.Inbound)
+}
+
+// WebhookURL returns the inbound message URL for the tenant host r was made
+// to, for display on the settings page
+func WebhookURL(r *http.Request, secure bool) string {
+	return httputil.BaseURL(r, secure) + WebhookPath
+}
+
+func (h handler) Inbound(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	// RequestURI keeps the /t/{slug} prefix the tenant middleware strips in
+	// development, and the signature covers the URL as called
+	err := h.service.Receive(r.Context(), Inbound{
+		URL:       httputil.BaseURL(r, h.secure) + r.RequestURI,
+		Params:    r.PostForm,
+		Signature: r.Header.Get("X-Twilio-Signature"),
+	})
+	switch {
+	case errors.Is(err, ErrNotEnabled):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, ErrBadSignature):
+		h.log.Warn("Rejected sms webhook", "error", err)
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	case err != nil:
+		h.log.Error("failed to handle inbound sms", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(emptyTwiML))
+}
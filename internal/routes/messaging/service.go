@@ -0,0 +1,91 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/notify"
+	"flexsupport/internal/sms"
+)
+
+var (
+	// ErrNotEnabled is returned for webhooks to tenants without text messages on
+	ErrNotEnabled = errors.New("sms is not enabled")
+	// ErrBadSignature is returned when a webhook was not signed with the
+	// tenant's auth token
+	ErrBadSignature = errors.New("invalid webhook signature")
+)
+
+type (
+	Service interface {
+		Receive(ctx context.Context, in Inbound) error
+	}
+
+	service struct {
+		log      *slog.Logger
+		notifier *notify.Notifier
+		texts    sms.Providers
+	}
+)
+
+// Inbound is a text message posted to the webhook by the provider
+type Inbound struct {
+	// URL is the full URL the provider called, which its signature covers
+	URL       string
+	Params    url.Values
+	Signature string
+}
+
+func NewService(log *slog.Logger, notifier *notify.Notifier, texts sms.Providers) Service {
+	return &service{
+		log:      log.With("Service", "messaging"),
+		notifier: notifier,
+		texts:    texts,
+	}
+}
+
+// Receive handles a customer's reply. STOP and the other carrier opt-out
+// keywords stop status updates by text to the sender's number; START resumes
+// them. Anything else is ignored.
+func (s service) Receive(ctx context.Context, in Inbound) error {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+	cfg, enabled, err := s.notifier.SMS(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNotEnabled
+	}
+	// The fake provider has no credentials to sign with, so its webhooks are
+	// only believed where the fake provider is allowed at all
+	if cfg.Provider == models.SMSProviderFake {
+		if !s.texts.FakeAllowed() {
+			return ErrBadSignature
+		}
+	} else if !sms.ValidSignature(cfg.AuthToken, in.URL, in.Params, in.Signature) {
+		return ErrBadSignature
+	}
+
+	var optOut bool
+	switch sms.ParseKeyword(in.Params.Get("Body")) {
+	case sms.KeywordStop:
+		optOut = true
+	case sms.KeywordStart:
+		optOut = false
+	default:
+		return nil
+	}
+	from, err := sms.NormalizePhone(in.Params.Get("From"), cfg.DefaultCountryCode)
+	if err != nil {
+		s.log.Warn("Ignoring text from invalid number", "from", in.Params.Get("From"))
+		return nil
+	}
+	return s.notifier.SetOptOut(ctx, models.ChannelSMS, from, optOut)
+}
@@ -0,0 +1,105 @@
+package messaging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"testing"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/notify"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/sms"
+)
+
+type fakeIntegrations struct {
+	ports.IntegrationRepository
+	cfg models.SMSConfig
+}
+
+func (f fakeIntegrations) GetIntegration(ctx context.Context, tenantID string, integrationType models.IntegrationType, name string) (models.Integration, error) {
+	config, err := json.Marshal(f.cfg)
+	if err != nil {
+		return models.Integration{}, err
+	}
+	return models.Integration{TenantID: tenantID, Type: integrationType, Name: name, Enabled: true, Config: config}, nil
+}
+
+type fakeNotifications struct {
+	ports.NotificationRepository
+	optOuts map[string]bool
+}
+
+func (f fakeNotifications) SetOptOut(ctx context.Context, tenantID string, channel models.NotificationChannel, address string, optOut bool, source models.OptOutSource) error {
+	f.optOuts[address] = optOut
+	return nil
+}
+
+const webhookURL = "https://shop.example.com/webhooks/sms"
+
+func newReceiveService(cfg models.SMSConfig, texts sms.Providers) (Service, fakeNotifications, context.Context) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	notifications := fakeNotifications{optOuts: map[string]bool{}}
+	notifier := notify.NewNotifier(log, notifications, fakeIntegrations{cfg: cfg}, nil, nil, nil)
+	ctx := mw.WithTenant(context.Background(), models.Tenant{ID: "tenant-1", Slug: "shop", Name: "Shop"})
+	return NewService(log, notifier, texts), notifications, ctx
+}
+
+func stop(signature string) Inbound {
+	return Inbound{
+		URL:       webhookURL,
+		Params:    url.Values{"From": {"+15415550123"}, "Body": {"STOP"}},
+		Signature: signature,
+	}
+}
+
+func sign(authToken string, in Inbound) string {
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(in.URL + "Body" + in.Params.Get("Body") + "From" + in.Params.Get("From")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestReceiveRefusesUnsignedFakeInProduction(t *testing.T) {
+	svc, notifications, ctx := newReceiveService(models.SMSConfig{Provider: models.SMSProviderFake}, sms.Providers{})
+
+	if err := svc.Receive(ctx, stop("")); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("Receive() error = %v, want ErrBadSignature", err)
+	}
+	if len(notifications.optOuts) != 0 {
+		t.Errorf("Receive() recorded opt-outs %v, want none", notifications.optOuts)
+	}
+}
+
+func TestReceiveAcceptsFakeInDevelopment(t *testing.T) {
+	texts := sms.Providers{Fake: sms.NewFake()}
+	svc, notifications, ctx := newReceiveService(models.SMSConfig{Provider: models.SMSProviderFake}, texts)
+
+	if err := svc.Receive(ctx, stop("")); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if !notifications.optOuts["+15415550123"] {
+		t.Errorf("Receive() did not opt the sender out")
+	}
+}
+
+func TestReceiveChecksTwilioSignature(t *testing.T) {
+	cfg := models.SMSConfig{Provider: models.SMSProviderTwilio, AuthToken: "secret"}
+	svc, notifications, ctx := newReceiveService(cfg, sms.Providers{})
+
+	if err := svc.Receive(ctx, stop(sign("wrong", stop("")))); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("Receive() with a bad signature error = %v, want ErrBadSignature", err)
+	}
+	if err := svc.Receive(ctx, stop(sign("secret", stop("")))); err != nil {
+		t.Fatalf("Receive() with a good signature error = %v", err)
+	}
+	if !notifications.optOuts["+15415550123"] {
+		t.Errorf("Receive() did not opt the sender out")
+	}
+}
@@ -0,0 +1,167 @@
+package portal
+
+import (
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+
+	"flexsupport/internal/forms"
+	"flexsupport/internal/httputil"
+	"flexsupport/internal/models"
+)
+
+// honeypotField is a text input hidden from people. Bots that fill in every
+// field give themselves away by filling it in.
+const honeypotField = "website"
+
+// IntakeInput holds the raw values posted by IntakeForm
+type IntakeInput struct {
+	CustomerName     string
+	CustomerPhone    string
+	CustomerEmail    string
+	ItemType         string
+	ItemDetails      string
+	IssueDescription string
+	// Fields holds the custom field values by field ID
+	Fields    map[string][]string
+	Honeypot  string
+	IPAddress string
+}
+
+func readIntakeInput(r *http.Request) IntakeInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	in := IntakeInput{
+		CustomerName:     value("customer_name"),
+		CustomerPhone:    value("customer_phone"),
+		CustomerEmail:    value("customer_email"),
+		ItemType:         value("item_type"),
+		ItemDetails:      value("other_details"),
+		IssueDescription: value("issue_description"),
+		Fields:           make(map[string][]string),
+		Honeypot:         value(honeypotField),
+		IPAddress:        httputil.ClientIP(r),
+	}
+	for name, values := range r.PostForm {
+		if id, ok := strings.CutPrefix(name, fieldPrefix); ok {
+			in.Fields[id] = values
+		}
+	}
+	return in
+}
+
+// fieldPrefix namespaces custom field inputs, which are named by field ID
+const fieldPrefix = "field_"
+
+const (
+	maxShortField = 200
+	maxLongField  = 10000
+)
+
+// apply validates the input and copies it onto ticket, returning the custom
+// field values to store. Only the fields customers can see are read.
+func (in IntakeInput) apply(ticket *models.Ticket, requestType models.RequestType) ([]models.FieldValue, forms.FieldErrors) {
+	errs := forms.FieldErrors{}
+
+	ticket.CustomerName = in.CustomerName
+	ticket.CustomerPhone = in.CustomerPhone
+	ticket.CustomerEmail = in.CustomerEmail
+	ticket.ItemType = models.ItemType(strings.ToLower(in.ItemType))
+	ticket.ItemDetails = in.ItemDetails
+	ticket.IssueDescription = in.IssueDescription
+
+	if in.CustomerName == "" {
+		errs["customer_name"] = "Enter your name"
+	} else if len(in.CustomerName) > maxShortField {
+		errs["customer_name"] = "Name is too long"
+	}
+	if in.CustomerPhone == "" {
+		errs["customer_phone"] = "Enter your phone number"
+	} else if !validPhone(in.CustomerPhone) {
+		errs["customer_phone"] = "Enter a valid phone number"
+	}
+	// The email is required here because the confirmation goes to it
+	if in.CustomerEmail == "" {
+		errs["customer_email"] = "Enter your email address"
+	} else if addr, err := mail.ParseAddress(in.CustomerEmail); err != nil || addr.Address != in.CustomerEmail {
+		errs["customer_email"] = "Enter a valid email address"
+	}
+
+	switch {
+	case in.ItemType == "":
+		errs["item_type"] = "Choose what you are bringing in"
+	case !slices.Contains(models.ItemTypes, ticket.ItemType):
+		errs["item_type"] = "Choose one of the listed item types"
+	case ticket.ItemType == models.Other && in.ItemDetails == "":
+		errs["other_details"] = "Describe the item"
+	case len(in.ItemDetails) > maxShortField:
+		errs["other_details"] = "Too long"
+	}
+	if ticket.ItemType != models.Other {
+		ticket.ItemDetails = ""
+	}
+
+	if in.IssueDescription == "" {
+		errs["issue_description"] = "Describe what needs doing"
+	} else if len(in.IssueDescription) > maxLongField {
+		errs["issue_description"] = "Description is too long"
+	}
+
+	values := make([]models.FieldValue, 0, len(requestType.Fields))
+	for _, field := range requestType.Fields {
+		if !field.RequesterVisible {
+			continue
+		}
+		name := fieldPrefix + field.ID
+		raw := slices.DeleteFunc(slices.Clone(in.Fields[field.ID]), func(v string) bool {
+			return strings.TrimSpace(v) == ""
+		})
+		if len(raw) == 0 {
+			if field.Required {
+				errs[name] = "This is required"
+			}
+			continue
+		}
+		switch field.FieldType {
+		case models.FieldSelect, models.FieldMultiselect:
+			for _, v := range raw {
+				if !field.HasOption(strings.TrimSpace(v)) {
+					errs[name] = "Choose one of the listed options"
+				}
+			}
+		default:
+			if len(raw[0]) > maxLongField {
+				errs[name] = "Too long"
+			}
+		}
+		value, err := models.EncodeFieldValue(field.FieldType, raw)
+		if err != nil {
+			errs[name] = "This " + err.Error()
+			continue
+		}
+		if _, failed := errs[name]; !failed {
+			values = append(values, models.FieldValue{FieldID: field.ID, Value: value})
+		}
+	}
+
+	if len(errs) > 0 {
+		return values, errs
+	}
+	return values, nil
+}
+
+func validPhone(phone string) bool {
+	digits := 0
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune(" +-().", r):
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
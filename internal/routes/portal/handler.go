@@ -0,0 +1,210 @@
+package portal
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"flexsupport/internal/forms"
+	"flexsupport/internal/httputil"
+	"flexsupport/internal/layout"
+	"flexsupport/internal/ports"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Path is where customers find the portal on their shop's domain
+const Path = "/portal"
+
+type (
+	Handler interface {
+		Home(w http.ResponseWriter, r *http.Request)
+		Lookup(w http.ResponseWriter, r *http.Request)
+		RequestTypes(w http.ResponseWriter, r *http.Request)
+		NewRequest(w http.ResponseWriter, r *http.Request)
+		SubmitRequest(w http.ResponseWriter, r *http.Request)
+	}
+
+	handler struct {
+		log     *slog.Logger
+		service Service
+		// secure builds https links to the portal in confirmation emails
+		secure bool
+	}
+)
+
+func NewHandler(log *slog.Logger, svc Service, secure bool) Handler {
+	return &handler{
+		log:     log.With("Handler", "Portal"),
+		service: svc,
+		secure:  secure,
+	}
+}
+
+// Mount adds the public portal routes. They need a tenant but no session.
+func Mount(r chi.Router, h Handler) {
+	r.Get(Path, h.Home)
+	r.Post(Path, h.Lookup)
+	r.Get(Path+"/new", h.RequestTypes)
+	r.Get(Path+"/new/{requestTypeId}", h.NewRequest)
+	r.Post(Path+"/new/{requestTypeId}", h.SubmitRequest)
+}
+
+// URL returns the portal's address on the tenant host r was made to, for
+// display on the settings page
+func URL(r *http.Request, secure bool) string {
+	return httputil.BaseURL(r, secure) + Path
+}
+
+func (h handler) Home(w http.ResponseWriter, r *http.Request) {
+	portal, err := h.service.Portal(r.Context())
+	if err != nil {
+		if errors.Is(err, ErrDisabled) {
+			http.NotFound(w, r)
+			return
+		}
+		h.serverError(w, "failed to load portal", err)
+		return
+	}
+	err = layout.PortalLayout(portal.Title, PortalPage(portal, LookupParams{})).Render(r.Context(), w)
+	if err != nil {
+		h.log.Error("failed to render portal", "error", err)
+	}
+}
+
+// Lookup shows the customer their ticket, or swaps the form back with an error
+func (h handler) Lookup(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	params := LookupParams{
+		Key:     strings.TrimSpace(r.PostFormValue("key")),
+		Contact: strings.TrimSpace(r.PostFormValue("contact")),
+	}
+	portal, view, err := h.service.Lookup(r.Context(), LookupInput{
+		Key:       params.Key,
+		Contact:   params.Contact,
+		IPAddress: httputil.ClientIP(r),
+	})
+	switch {
+	case errors.Is(err, ErrDisabled):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, ErrNoMatch):
+		params.Error = "We couldn't find a ticket with that number and contact detail. Check both and try again."
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrRateLimited):
+		params.Error = "Too many lookups. Try again later."
+		w.WriteHeader(http.StatusTooManyRequests)
+	case err != nil:
+		h.serverError(w, "failed to look up ticket", err)
+		return
+	default:
+		params.Ticket = &view
+	}
+
+	if httputil.IsHTMX(r) {
+		err = Lookup(params).Render(r.Context(), w)
+	} else {
+		err = layout.PortalLayout(portal.Title, PortalPage(portal, params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render portal lookup", "error", err)
+	}
+}
+
+// RequestTypes lets the customer pick what to ask for. With only one choice
+// it goes straight to the form.
+func (h handler) RequestTypes(w http.ResponseWriter, r *http.Request) {
+	portal, types, err := h.service.RequestTypes(r.Context())
+	if err != nil {
+		if errors.Is(err, ErrDisabled) {
+			http.NotFound(w, r)
+			return
+		}
+		h.serverError(w, "failed to list request types", err)
+		return
+	}
+	if len(types) == 1 {
+		http.Redirect(w, r, Path+"/new/"+types[0].ID, http.StatusSeeOther)
+		return
+	}
+	err = layout.PortalLayout(portal.Title, RequestTypesPage(types)).Render(r.Context(), w)
+	if err != nil {
+		h.log.Error("failed to render request types", "error", err)
+	}
+}
+
+func (h handler) NewRequest(w http.ResponseWriter, r *http.Request) {
+	portal, requestType, err := h.service.RequestType(r.Context(), chi.URLParam(r, "requestTypeId"))
+	if err != nil {
+		if errors.Is(err, ErrDisabled) || errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		h.serverError(w, "failed to load request type", err)
+		return
+	}
+	params := IntakeParams{RequestType: requestType}
+	err = layout.PortalLayout(portal.Title, IntakePage(params)).Render(r.Context(), w)
+	if err != nil {
+		h.log.Error("failed to render request form", "error", err)
+	}
+}
+
+// SubmitRequest opens a ticket from the intake form, or swaps the form back
+// with errors
+func (h handler) SubmitRequest(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	portal, requestType, err := h.service.RequestType(ctx, chi.URLParam(r, "requestTypeId"))
+	if err != nil {
+		if errors.Is(err, ErrDisabled) || errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		h.serverError(w, "failed to load request type", err)
+		return
+	}
+	in := readIntakeInput(r)
+	ticket, err := h.service.Submit(ctx, requestType.ID, in, URL(r, h.secure))
+	params := IntakeParams{RequestType: requestType, Ticket: ticket, Fields: in.Fields}
+	var errs forms.FieldErrors
+	switch {
+	case errors.Is(err, ErrDisabled), errors.Is(err, ports.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.As(err, &errs):
+		params.Errors = errs
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrRateLimited):
+		params.Error = "Too many requests from your connection. Try again later or contact the shop."
+		w.WriteHeader(http.StatusTooManyRequests)
+	case err != nil:
+		h.serverError(w, "failed to submit portal request", err)
+		return
+	default:
+		params.Submitted = true
+	}
+
+	if httputil.IsHTMX(r) {
+		err = IntakeForm(params).Render(ctx, w)
+	} else {
+		err = layout.PortalLayout(portal.Title, IntakePage(params)).Render(ctx, w)
+	}
+	if err != nil {
+		h.log.Error("failed to render portal request", "error", err)
+	}
+}
+
+// serverError logs err and answers with a generic message, so customers never
+// see database or template errors
+func (h handler) serverError(w http.ResponseWriter, msg string, err error) {
+	h.log.Error(msg, "error", err)
+	http.Error(w, "Something went wrong. Please try again later.", http.StatusInternalServerError)
+}
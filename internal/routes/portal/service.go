@@ -0,0 +1,331 @@
+package portal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"flexsupport/internal/mail"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/ratelimit"
+	"flexsupport/internal/utils"
+)
+
+var (
+	// ErrDisabled is returned for tenants that have not turned the portal on
+	ErrDisabled = errors.New("portal is not enabled")
+	// ErrNoMatch is returned when no ticket matches the key and contact given.
+	// It does not say which part was wrong.
+	ErrNoMatch = errors.New("no matching ticket")
+	// ErrRateLimited is returned when a client has made too many lookups or
+	// requests
+	ErrRateLimited = errors.New("too many requests")
+)
+
+type (
+	Service interface {
+		Portal(ctx context.Context) (Portal, error)
+		Lookup(ctx context.Context, in LookupInput) (Portal, TicketView, error)
+		RequestTypes(ctx context.Context) (Portal, []models.RequestType, error)
+		RequestType(ctx context.Context, id string) (Portal, models.RequestType, error)
+		Submit(ctx context.Context, requestTypeID string, in IntakeInput, portalURL string) (models.Ticket, error)
+	}
+
+	service struct {
+		log          *slog.Logger
+		settings     ports.PortalRepository
+		tickets      ports.TicketRepository
+		projects     ports.ProjectRepository
+		requestTypes ports.RequestTypeRepository
+		mailer       mail.Sender
+
+		lookupsByIP   *ratelimit.Limiter
+		failuresByKey *ratelimit.Limiter
+		requestsByIP  *ratelimit.Limiter
+	}
+)
+
+// Portal is the tenant's portal as customers see it
+type Portal struct {
+	ShopName    string
+	Title       string
+	WelcomeText string
+}
+
+// LookupInput is a customer's request to see a ticket
+type LookupInput struct {
+	Key string
+	// Contact is the phone number or email address on the ticket
+	Contact   string
+	IPAddress string
+}
+
+// TicketView holds only what a customer may see of their ticket
+type TicketView struct {
+	Ticket models.Ticket
+	Notes  []models.WorkNote
+}
+
+func NewService(
+	log *slog.Logger,
+	settings ports.PortalRepository,
+	tickets ports.TicketRepository,
+	projects ports.ProjectRepository,
+	requestTypes ports.RequestTypeRepository,
+	mailer mail.Sender,
+) Service {
+	return &service{
+		log:           log.With("Service", "Portal"),
+		settings:      settings,
+		tickets:       tickets,
+		projects:      projects,
+		requestTypes:  requestTypes,
+		mailer:        mailer,
+		lookupsByIP:   ratelimit.New(30, 15*time.Minute),
+		failuresByKey: ratelimit.New(10, time.Hour),
+		requestsByIP:  ratelimit.New(5, time.Hour),
+	}
+}
+
+// Portal returns the tenant's portal, or ErrDisabled
+func (s service) Portal(ctx context.Context) (Portal, error) {
+	_, portal, err := s.load(ctx)
+	return portal, err
+}
+
+func (s service) load(ctx context.Context) (models.PortalSettings, Portal, error) {
+	tenant, ok := mw.TenantFromContext(ctx)
+	if !ok {
+		return models.PortalSettings{}, Portal{}, mw.ErrNoTenant
+	}
+	settings, err := s.settings.GetPortalSettings(ctx, tenant.ID)
+	if err != nil {
+		return settings, Portal{}, err
+	}
+	if !settings.Enabled {
+		return settings, Portal{}, ErrDisabled
+	}
+	return settings, Portal{
+		ShopName:    tenant.Name,
+		Title:       settings.DisplayTitle(tenant.Name),
+		WelcomeText: settings.WelcomeText,
+	}, nil
+}
+
+// Lookup finds the ticket with the given key whose customer phone or email
+// matches the contact given. Tickets in projects with the portal switched off
+// are treated as missing.
+func (s service) Lookup(ctx context.Context, in LookupInput) (Portal, TicketView, error) {
+	settings, portal, err := s.load(ctx)
+	if err != nil {
+		return portal, TicketView{}, err
+	}
+	if !s.lookupsByIP.Allow(in.IPAddress) {
+		s.log.Warn("Rate limited portal lookups", "ip", in.IPAddress)
+		return portal, TicketView{}, ErrRateLimited
+	}
+	projectKey, number, ok := models.ParseTicketKey(in.Key)
+	if !ok || in.Contact == "" {
+		return portal, TicketView{}, ErrNoMatch
+	}
+	// Only failed guesses count against a ticket, and per address, so nobody
+	// can lock a customer out of their own ticket by guessing wrong
+	failures := settings.TenantID + "/" + in.IPAddress + "/" + strings.ToUpper(in.Key)
+	if s.failuresByKey.Exceeded(failures) {
+		s.log.Warn("Rate limited portal lookups", "key", in.Key, "ip", in.IPAddress)
+		return portal, TicketView{}, ErrRateLimited
+	}
+
+	ticket, err := s.tickets.GetTicketByKey(ctx, settings.TenantID, projectKey, number)
+	if errors.Is(err, ports.ErrNotFound) {
+		s.failuresByKey.Allow(failures)
+		return portal, TicketView{}, ErrNoMatch
+	}
+	if err != nil {
+		return portal, TicketView{}, err
+	}
+	if !settings.ProjectEnabled(ticket.ProjectID) || !contactMatches(ticket, in.Contact) {
+		s.failuresByKey.Allow(failures)
+		return portal, TicketView{}, ErrNoMatch
+	}
+
+	notes, err := s.tickets.ListPublicComments(ctx, ticket.ID)
+	if err != nil {
+		return portal, TicketView{}, err
+	}
+	return portal, TicketView{Ticket: ticket, Notes: notes}, nil
+}
+
+// RequestTypes lists what customers can ask for: the request types of
+// projects with the portal switched on, with only the fields customers see
+func (s service) RequestTypes(ctx context.Context) (Portal, []models.RequestType, error) {
+	settings, portal, err := s.load(ctx)
+	if err != nil {
+		return portal, nil, err
+	}
+	all, err := s.requestTypes.ListRequestTypes(ctx, settings.TenantID)
+	if err != nil {
+		return portal, nil, err
+	}
+	types := make([]models.RequestType, 0, len(all))
+	for _, requestType := range all {
+		if settings.ProjectEnabled(requestType.ProjectID) {
+			types = append(types, requesterView(requestType))
+		}
+	}
+	return portal, types, nil
+}
+
+// RequestType loads one request type as RequestTypes describes. Types in
+// projects with the portal switched off are reported as not found.
+func (s service) RequestType(ctx context.Context, id string) (Portal, models.RequestType, error) {
+	settings, portal, err := s.load(ctx)
+	if err != nil {
+		return portal, models.RequestType{}, err
+	}
+	requestType, err := s.requestType(ctx, settings, id)
+	return portal, requestType, err
+}
+
+func (s service) requestType(ctx context.Context, settings models.PortalSettings, id string) (models.RequestType, error) {
+	if !utils.IsUUID(id) {
+		return models.RequestType{}, ports.ErrNotFound
+	}
+	requestType, err := s.requestTypes.GetRequestType(ctx, settings.TenantID, id)
+	if err != nil {
+		return models.RequestType{}, err
+	}
+	if !settings.ProjectEnabled(requestType.ProjectID) {
+		return models.RequestType{}, ports.ErrNotFound
+	}
+	return requesterView(requestType), nil
+}
+
+// requesterView drops the fields only staff see
+func requesterView(requestType models.RequestType) models.RequestType {
+	fields := make([]models.RequestTypeField, 0, len(requestType.Fields))
+	for _, field := range requestType.Fields {
+		if field.RequesterVisible {
+			fields = append(fields, field)
+		}
+	}
+	requestType.Fields = fields
+	return requestType
+}
+
+// Submit opens a ticket in the new status from a customer's request and
+// emails them its key. Validation failures are returned as forms.FieldErrors.
+// Submissions that fill in the honeypot are dropped but answered as if they
+// worked, with a ticket that has no ID, so bots learn nothing.
+func (s service) Submit(ctx context.Context, requestTypeID string, in IntakeInput, portalURL string) (models.Ticket, error) {
+	settings, portal, err := s.load(ctx)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	requestType, err := s.requestType(ctx, settings, requestTypeID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if in.Honeypot != "" {
+		s.log.Warn("Dropped portal request that filled in the honeypot", "ip", in.IPAddress)
+		return models.Ticket{}, nil
+	}
+
+	ticket := models.Ticket{
+		TenantID:      settings.TenantID,
+		ProjectID:     requestType.ProjectID,
+		RequestTypeID: requestType.ID,
+		Priority:      models.PriorityNormal,
+	}
+	values, errs := in.apply(&ticket, requestType)
+	if errs != nil {
+		return ticket, errs
+	}
+	if !s.requestsByIP.Allow(in.IPAddress) {
+		s.log.Warn("Rate limited portal requests", "ip", in.IPAddress)
+		return ticket, ErrRateLimited
+	}
+
+	statuses, err := s.projects.ListStatuses(ctx, settings.TenantID, ticket.ProjectID)
+	if err != nil {
+		return ticket, err
+	}
+	if len(statuses) == 0 {
+		statuses = models.DefaultStatuses
+	}
+	status, ok := models.FindStatus(statuses, models.StatusNew)
+	if !ok {
+		status = models.TicketStatus{Key: models.StatusNew, Category: models.CategoryOpen}
+	}
+	ticket.SetStatus(status)
+	ticket.Title = ticket.DefaultTitle()
+
+	if err := s.tickets.CreateTicket(ctx, &ticket); err != nil {
+		return ticket, err
+	}
+	s.log.Info("Created ticket from portal", "ticket", ticket.Key(), "request_type", requestType.Key)
+
+	if len(values) > 0 {
+		if err := s.tickets.SetFieldValues(ctx, ticket.TenantID, ticket.ID, values); err != nil {
+			s.log.Error("failed to save portal request fields", "ticket", ticket.ID, "error", err)
+		}
+	}
+	payload, err := json.Marshal(map[string]string{"source": "portal"})
+	if err != nil {
+		return ticket, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	if err := s.tickets.AddEvent(ctx, &models.TicketEvent{
+		TenantID: ticket.TenantID,
+		TicketID: ticket.ID,
+		Type:     models.EventCreated,
+		Payload:  payload,
+	}); err != nil {
+		s.log.Error("failed to record ticket event", "ticket", ticket.ID, "error", err)
+	}
+	s.confirm(ctx, portal, requestType, ticket, portalURL)
+	return ticket, nil
+}
+
+// confirm emails the customer their ticket key. The ticket is open either way,
+// so failures are only logged.
+func (s service) confirm(ctx context.Context, portal Portal, requestType models.RequestType, ticket models.Ticket, portalURL string) {
+	subject := fmt.Sprintf("%s received your request %s", portal.ShopName, ticket.Key())
+	msg, err := mail.Render(ctx, ticket.CustomerEmail, subject, confirmationEmail(portal.ShopName, requestType.Name, ticket, portalURL))
+	if err != nil {
+		s.log.Error("failed to render portal confirmation", "ticket", ticket.ID, "error", err)
+		return
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Error("failed to email portal confirmation", "ticket", ticket.ID, "error", err)
+	}
+}
+
+// minPhoneDigits stops a few digits matching the end of a longer number
+const minPhoneDigits = 7
+
+// contactMatches reports whether contact is the ticket's email address or
+// phone number. Phone numbers match on their last ten digits, so a country
+// code given on one side but not the other does not matter.
+func contactMatches(ticket models.Ticket, contact string) bool {
+	if strings.Contains(contact, "@") {
+		return ticket.CustomerEmail != "" && models.NormalizeEmail(ticket.CustomerEmail) == models.NormalizeEmail(contact)
+	}
+	given, stored := models.PhoneKey(contact), models.PhoneKey(ticket.CustomerPhone)
+	if len(given) < minPhoneDigits || len(stored) < minPhoneDigits {
+		return false
+	}
+	return lastDigits(given, 10) == lastDigits(stored, 10)
+}
+
+func lastDigits(digits string, n int) string {
+	if len(digits) > n {
+		return digits[len(digits)-n:]
+	}
+	return digits
+}
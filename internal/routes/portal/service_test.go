@@ -0,0 +1,87 @@
+package portal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+type fakeSettings struct {
+	ports.PortalRepository
+	settings models.PortalSettings
+}
+
+func (f fakeSettings) GetPortalSettings(ctx context.Context, tenantID string) (models.PortalSettings, error) {
+	return f.settings, nil
+}
+
+type fakeTickets struct {
+	ports.TicketRepository
+	ticket models.Ticket
+}
+
+func (f fakeTickets) GetTicketByKey(ctx context.Context, tenantID, projectKey string, number int64) (models.Ticket, error) {
+	if projectKey != "REPAIR" || number != f.ticket.Number {
+		return models.Ticket{}, ports.ErrNotFound
+	}
+	return f.ticket, nil
+}
+
+func (f fakeTickets) ListPublicComments(ctx context.Context, ticketID string) ([]models.WorkNote, error) {
+	return nil, nil
+}
+
+func newLookupService() (Service, context.Context) {
+	settings := models.PortalSettings{
+		TenantID: "tenant-1",
+		Enabled:  true,
+		Projects: []models.PortalProject{{ProjectID: "project-1", Key: "REPAIR", Enabled: true}},
+	}
+	ticket := models.Ticket{
+		ID:            "ticket-1",
+		TenantID:      "tenant-1",
+		ProjectID:     "project-1",
+		Number:        1042,
+		CustomerPhone: "+15551234567",
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewService(log, fakeSettings{settings: settings}, fakeTickets{ticket: ticket}, nil, nil, nil)
+	ctx := mw.WithTenant(context.Background(), models.Tenant{ID: "tenant-1", Slug: "shop", Name: "Shop"})
+	return svc, ctx
+}
+
+func TestLookupFailuresDoNotLockOutCustomer(t *testing.T) {
+	svc, ctx := newLookupService()
+
+	wrong := LookupInput{Key: "REPAIR-1042", Contact: "555 000 0000", IPAddress: "198.51.100.1"}
+	for range 10 {
+		if _, _, err := svc.Lookup(ctx, wrong); !errors.Is(err, ErrNoMatch) {
+			t.Fatalf("Lookup() error = %v, want ErrNoMatch", err)
+		}
+	}
+	if _, _, err := svc.Lookup(ctx, wrong); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Lookup() after 10 failures error = %v, want ErrRateLimited", err)
+	}
+
+	customer := LookupInput{Key: "REPAIR-1042", Contact: "(555) 123-4567", IPAddress: "203.0.113.7"}
+	if _, view, err := svc.Lookup(ctx, customer); err != nil || view.Ticket.ID != "ticket-1" {
+		t.Fatalf("Lookup() from the customer's address = %v, %v, want the ticket", view.Ticket.ID, err)
+	}
+}
+
+func TestLookupSuccessesAreNotCounted(t *testing.T) {
+	svc, ctx := newLookupService()
+
+	customer := LookupInput{Key: "REPAIR-1042", Contact: "555-123-4567", IPAddress: "203.0.113.7"}
+	for i := range 20 {
+		if _, _, err := svc.Lookup(ctx, customer); err != nil {
+			t.Fatalf("Lookup() #%d error = %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package tickets
+
+import (
+	"math"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"flexsupport/internal/forms"
+	"flexsupport/internal/models"
+	"flexsupport/internal/utils"
+)
+
+// TicketInput holds the raw values posted by TicketForm
+type TicketInput struct {
+	ProjectID        string
+	CustomerID       string // picked in the customer search
+	CustomerName     string
+	CustomerPhone    string
+	CustomerEmail    string
+	ItemType         string
+	ItemDetails      string
+	ItemBrand        string
+	ItemModel        string
+	SerialNumber     string
+	IssueDescription string
+	Priority         string
+	EstimatedCost    string
+	DueDate          string
+	InternalNotes    string
+}
+
+func readTicketInput(r *http.Request) TicketInput {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	return TicketInput{
+		ProjectID:        value("project_id"),
+		CustomerID:       value("customer_id"),
+		CustomerName:     value("customer_name"),
+		CustomerPhone:    value("customer_phone"),
+		CustomerEmail:    value("customer_email"),
+		ItemType:         value("item_type"),
+		ItemDetails:      value("other_details"),
+		ItemBrand:        value("item_brand"),
+		ItemModel:        value("item_model"),
+		SerialNumber:     value("serial_number"),
+		IssueDescription: value("issue_description"),
+		Priority:         value("priority"),
+		EstimatedCost:    value("estimated_cost"),
+		DueDate:          value("due_date"),
+		InternalNotes:    value("internal_notes"),
+	}
+}
+
+const (
+	maxShortField = 200
+	maxLongField  = 10000
+)
+
+// apply validates the input and copies it onto ticket. Fields that fail to
+// parse are still copied as far as possible so the form can be re-rendered
+// with what the user typed.
+func (in TicketInput) apply(ticket *models.Ticket) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+
+	if ticket.ID == "" {
+		ticket.ProjectID = in.ProjectID
+		ticket.CustomerID = nil
+		if utils.IsUUID(in.CustomerID) {
+			ticket.CustomerID = &in.CustomerID
+		}
+	}
+	ticket.CustomerName = in.CustomerName
+	ticket.CustomerPhone = in.CustomerPhone
+	ticket.CustomerEmail = in.CustomerEmail
+	ticket.ItemType = models.ItemType(strings.ToLower(in.ItemType))
+	ticket.ItemDetails = in.ItemDetails
+	ticket.ItemBrand = in.ItemBrand
+	ticket.ItemModel = in.ItemModel
+	ticket.SerialNumber = in.SerialNumber
+	ticket.IssueDescription = in.IssueDescription
+	ticket.InternalNotes = in.InternalNotes
+	ticket.Priority = models.Priority(strings.ToLower(in.Priority))
+
+	if in.CustomerName == "" {
+		errs["customer_name"] = "Customer name is required"
+	} else if len(in.CustomerName) > maxShortField {
+		errs["customer_name"] = "Customer name is too long"
+	}
+
+	if in.CustomerPhone == "" {
+		errs["customer_phone"] = "Phone number is required"
+	} else if !validPhone(in.CustomerPhone) {
+		errs["customer_phone"] = "Enter a valid phone number"
+	}
+
+	if in.CustomerEmail != "" {
+		if addr, err := mail.ParseAddress(in.CustomerEmail); err != nil || addr.Address != in.CustomerEmail {
+			errs["customer_email"] = "Enter a valid email address"
+		}
+	}
+
+	switch {
+	case in.ItemType == "":
+		errs["item_type"] = "Item type is required"
+	case !slices.Contains(models.ItemTypes, ticket.ItemType):
+		errs["item_type"] = "Choose one of the listed item types"
+	case ticket.ItemType == models.Other && in.ItemDetails == "":
+		errs["other_details"] = "Describe the item"
+	}
+	if ticket.ItemType != models.Other {
+		ticket.ItemDetails = ""
+	}
+
+	for name, v := range map[string]string{
+		"item_brand":    in.ItemBrand,
+		"item_model":    in.ItemModel,
+		"serial_number": in.SerialNumber,
+		"other_details": in.ItemDetails,
+	} {
+		if len(v) > maxShortField {
+			errs[name] = "Too long"
+		}
+	}
+
+	if in.IssueDescription == "" {
+		errs["issue_description"] = "Describe the issue"
+	} else if len(in.IssueDescription) > maxLongField {
+		errs["issue_description"] = "Issue description is too long"
+	}
+	if len(in.InternalNotes) > maxLongField {
+		errs["internal_notes"] = "Internal notes are too long"
+	}
+
+	if in.Priority == "" {
+		ticket.Priority = models.PriorityNormal
+	} else if !slices.Contains(models.Priorities, ticket.Priority) {
+		errs["priority"] = "Choose a valid priority"
+	}
+
+	ticket.EstimatedCost = 0
+	if in.EstimatedCost != "" {
+		cost, err := strconv.ParseFloat(in.EstimatedCost, 64)
+		switch {
+		case err != nil || math.IsNaN(cost) || math.IsInf(cost, 0):
+			errs["estimated_cost"] = "Enter an amount such as 45.00"
+		case cost < 0:
+			errs["estimated_cost"] = "Estimated cost cannot be negative"
+		case cost >= 1e10:
+			errs["estimated_cost"] = "Estimated cost is too large"
+		default:
+			ticket.EstimatedCost = cost
+		}
+	}
+
+	ticket.DueDate = nil
+	if in.DueDate != "" {
+		due, err := time.Parse("2006-01-02", in.DueDate)
+		if err != nil {
+			errs["due_date"] = "Enter a valid date"
+		} else {
+			ticket.DueDate = &due
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validPhone accepts common human formats such as "(555) 123-4567" or
+// "+1 555 123 4567" as long as they contain 7 to 15 digits
+func validPhone(phone string) bool {
+	digits := 0
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune(" +-().", r):
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// PartInput holds the raw values posted by the add and edit part forms
+type PartInput struct {
+	Name     string
+	Quantity string
+	Cost     string
+}
+
+func readPartInput(r *http.Request) PartInput {
+	return PartInput{
+		Name:     strings.TrimSpace(r.PostFormValue("part_name")),
+		Quantity: strings.TrimSpace(r.PostFormValue("quantity")),
+		Cost:     strings.TrimSpace(r.PostFormValue("cost")),
+	}
+}
+
+// apply validates the input and copies it onto part
+func (in PartInput) apply(part *models.Part) forms.FieldErrors {
+	errs := forms.FieldErrors{}
+
+	part.Name = in.Name
+	if in.Name == "" {
+		errs["part_name"] = "Part name is required"
+	} else if len(in.Name) > maxShortField {
+		errs["part_name"] = "Part name is too long"
+	}
+
+	quantity, err := strconv.Atoi(in.Quantity)
+	switch {
+	case in.Quantity == "":
+		part.Quantity = 1
+	case err != nil || quantity < 1:
+		errs["quantity"] = "Quantity must be a whole number of at least 1"
+	case quantity > 10000:
+		errs["quantity"] = "Quantity is too large"
+	default:
+		part.Quantity = quantity
+	}
+
+	cost, err := strconv.ParseFloat(in.Cost, 64)
+	switch {
+	case in.Cost == "":
+		errs["cost"] = "Cost is required"
+	case err != nil || math.IsNaN(cost) || math.IsInf(cost, 0):
+		errs["cost"] = "Enter an amount such as 12.50"
+	case cost < 0:
+		errs["cost"] = "Cost cannot be negative"
+	case cost >= 1e10:
+		errs["cost"] = "Cost is too large"
+	default:
+		part.Cost = cost
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// NoteInput holds the raw values posted by the work log form
+type NoteInput struct {
+	Body     string
+	Internal bool
+}
+
+// readNoteInput treats anything but an explicit "public" as internal so a
+// note is never exposed to the customer by accident
+func readNoteInput(r *http.Request) NoteInput {
+	return NoteInput{
+		Body:     strings.TrimSpace(r.PostFormValue("note")),
+		Internal: r.PostFormValue("visibility") != "public",
+	}
+}
+
+func (in NoteInput) apply(note *models.WorkNote) forms.FieldErrors {
+	note.Content = in.Body
+	note.IsInternal = in.Internal
+	switch {
+	case in.Body == "":
+		return forms.FieldErrors{"note": "Write something before adding the note"}
+	case len(in.Body) > maxLongField:
+		return forms.FieldErrors{"note": "Note is too long"}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package tickets
+
+import (
+	"testing"
+
+	"flexsupport/internal/models"
+)
+
+func TestTicketInputEstimatedCost(t *testing.T) {
+	tests := []struct {
+		cost    string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"45.50", 45.5, false},
+		{"-1", 0, true},
+		{"1e10", 0, true},
+		{"abc", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"-Infinity", 0, true},
+	}
+	for _, tt := range tests {
+		in := TicketInput{
+			CustomerName:     "Ada",
+			CustomerPhone:    "+1 541 555 0123",
+			ItemType:         string(models.ItemTypes[0]),
+			IssueDescription: "Cracked screen",
+			EstimatedCost:    tt.cost,
+		}
+		var ticket models.Ticket
+		errs := in.apply(&ticket)
+		if _, got := errs["estimated_cost"]; got != tt.wantErr {
+			t.Errorf("apply() with cost %q gave estimated_cost error %t, want %t", tt.cost, got, tt.wantErr)
+		}
+		if ticket.EstimatedCost != tt.want {
+			t.Errorf("apply() with cost %q set %v, want %v", tt.cost, ticket.EstimatedCost, tt.want)
+		}
+	}
+}
+
+func TestPartInputCost(t *testing.T) {
+	tests := []struct {
+		cost    string
+		want    float64
+		wantErr bool
+	}{
+		{"12.50", 12.5, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"-0.01", 0, true},
+		{"1e10", 0, true},
+		{"NaN", 0, true},
+		{"+Inf", 0, true},
+		{"-inf", 0, true},
+	}
+	for _, tt := range tests {
+		var part models.Part
+		errs := PartInput{Name: "Screen", Cost: tt.cost}.apply(&part)
+		if _, got := errs["cost"]; got != tt.wantErr {
+			t.Errorf("apply() with cost %q gave cost error %t, want %t", tt.cost, got, tt.wantErr)
+		}
+		if part.Cost != tt.want {
+			t.Errorf("apply() with cost %q set %v, want %v", tt.cost, part.Cost, tt.want)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package tickets
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"flexsupport/internal/forms"
+	"flexsupport/internal/httputil"
 	"flexsupport/internal/layout"
+	mw "flexsupport/internal/middleware"
 	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
 	"flexsupport/internal/utils"
 	"flexsupport/ui/partials/rows"
 
@@ -18,6 +25,18 @@ type (
 		Search(w http.ResponseWriter, r *http.Request)
 		Get(w http.ResponseWriter, r *http.Request)
 		New(w http.ResponseWriter, r *http.Request)
+		Create(w http.ResponseWriter, r *http.Request)
+		Edit(w http.ResponseWriter, r *http.Request)
+		Update(w http.ResponseWriter, r *http.Request)
+		UpdateStatus(w http.ResponseWriter, r *http.Request)
+		AddPart(w http.ResponseWriter, r *http.Request)
+		UpdatePart(w http.ResponseWriter, r *http.Request)
+		DeletePart(w http.ResponseWriter, r *http.Request)
+		AddNote(w http.ResponseWriter, r *http.Request)
+		SetNoteVisibility(w http.ResponseWriter, r *http.Request)
+		SetCustomerOptOut(w http.ResponseWriter, r *http.Request)
+		CustomerMatches(w http.ResponseWriter, r *http.Request)
+		PickCustomer(w http.ResponseWriter, r *http.Request)
 	}
 
 	handler struct {
@@ -28,18 +47,41 @@ type (
 
 func NewHandler(log *slog.Logger, svc Service) Handler {
 	return &handler{
-		log:     log.With("Tickets Handler"),
+		log:     log.With("Handler", "Tickets"),
 		service: svc,
 	}
 }
 
 func Mount(r chi.Router, h Handler) {
+	read := mw.RequirePermission(models.PermTicketRead)
+	create := mw.RequirePermission(models.PermTicketCreate)
+	write := mw.RequirePermission(models.PermTicketWrite)
+	status := mw.RequirePermission(models.PermTicketStatus)
+
 	r.Route("/tickets", func(r chi.Router) {
-		r.Get("/", h.Search)
+		r.With(read).Get("/", h.Search)
+		r.With(create).Post("/", h.Create)
 		r.Route("/{ticketId}", func(r chi.Router) {
-			r.Get("/", h.Get)
+			r.With(read).Get("/", h.Get)
+			r.With(write).Post("/", h.Update)
+			r.With(write).Get("/edit", h.Edit)
+			r.With(status).Post("/status", h.UpdateStatus)
+			r.Route("/parts", func(r chi.Router) {
+				r.Use(write)
+				r.Post("/", h.AddPart)
+				r.Post("/{partId}", h.UpdatePart)
+				r.Delete("/{partId}", h.DeletePart)
+			})
+			r.Route("/notes", func(r chi.Router) {
+				r.Use(write)
+				r.Post("/", h.AddNote)
+				r.Post("/{noteId}/visibility", h.SetNoteVisibility)
+			})
+			r.With(write).Post("/notifications", h.SetCustomerOptOut)
 		})
-		r.Get("/new", h.New)
+		r.With(create).Get("/new", h.New)
+		r.With(create).Get("/new/customers", h.CustomerMatches)
+		r.With(create).Get("/new/customers/{customerId}", h.PickCustomer)
 	})
 }
 
@@ -52,7 +94,7 @@ func (h handler) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	isMobile := utils.IsMobileUA(r.UserAgent())
-	switch isHTMX(r) {
+	switch httputil.IsHTMX(r) {
 	case true:
 		err = rows.TicketRows(tickets, isMobile).Render(r.Context(), w)
 		if err != nil {
@@ -60,7 +102,12 @@ func (h handler) Search(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	default:
-		err = layout.BaseLayout(TicketsPage(tickets, search, status)).Render(r.Context(), w)
+		statuses, err := h.service.Statuses(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = layout.BaseLayout(TicketsPage(tickets, statuses, search, status)).Render(r.Context(), w)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -69,19 +116,31 @@ func (h handler) Search(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) Get(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "ticketId")
-	ticketID, err := strconv.ParseInt(id, 10, 64)
+	// ticketId is either the UUID or the human-readable key, e.g. REPAIR-1042
+	ticketID := chi.URLParam(r, "ticketId")
+	ticket, err := h.service.Get(r.Context(), ticketID)
 	if err != nil {
-		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		if errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	ticket, err := h.service.Get(r.Context(), ticketID)
+
+	next, err := h.service.NextStatuses(r.Context(), ticket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	channels, err := h.service.CustomerChannels(r.Context(), ticket)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	page := TicketPage(ticket)
+	page := TicketPage(ticket, next, channels)
 	err = layout.BaseLayout(page).Render(r.Context(), w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -90,19 +149,318 @@ func (h handler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) New(w http.ResponseWriter, r *http.Request) {
-	page := TicketForm(models.Ticket{})
-	err := layout.BaseLayout(page).Render(r.Context(), w)
+	projects, err := h.service.Projects(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Start in the project picked in the switcher
+	var ticket models.Ticket
+	if project, ok := mw.CurrentProject(r.Context()); ok {
+		ticket.ProjectID = project.ID
+	}
+	// Prefill a returning customer, e.g. from their customer page
+	if id := r.URL.Query().Get("customer"); id != "" {
+		customer, err := h.service.Customer(r.Context(), id)
+		switch {
+		case err == nil:
+			prefillCustomer(&ticket, customer)
+		case !errors.Is(err, ports.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	page := TicketForm(TicketFormParams{Ticket: ticket, Projects: projects})
+	err = layout.BaseLayout(page).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) Create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ticket, err := h.service.Create(r.Context(), readTicketInput(r))
+	if err != nil {
+		var errs forms.FieldErrors
+		if errors.As(err, &errs) {
+			projects, err := h.service.Projects(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			h.renderInvalid(w, r, TicketFormParams{Ticket: ticket, Projects: projects, Errors: errs})
+			return
+		}
+		h.log.Error("failed to create ticket", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redirect(w, r, fmt.Sprintf("/tickets/%s", ticket.ID))
+}
+
+func (h handler) Edit(w http.ResponseWriter, r *http.Request) {
+	ticket, err := h.service.Get(r.Context(), chi.URLParam(r, "ticketId"))
+	if err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := TicketForm(TicketFormParams{Ticket: ticket})
+	err = layout.BaseLayout(page).Render(r.Context(), w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func isHTMX(r *http.Request) bool {
-	// Check for "HX-Request" header
-	if r.Header.Get("HX-Request") != "" {
-		return true
+func (h handler) Update(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ticket, err := h.service.Update(r.Context(), chi.URLParam(r, "ticketId"), readTicketInput(r))
+	if err != nil {
+		var errs forms.FieldErrors
+		switch {
+		case errors.As(err, &errs):
+			h.renderInvalid(w, r, TicketFormParams{Ticket: ticket, Errors: errs})
+		case errors.Is(err, ports.ErrNotFound):
+			http.NotFound(w, r)
+		default:
+			h.log.Error("failed to update ticket", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	redirect(w, r, fmt.Sprintf("/tickets/%s", ticket.ID))
+}
+
+func (h handler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	status := models.Status(r.FormValue("status"))
+	ticket, err := h.service.ChangeStatus(r.Context(), chi.URLParam(r, "ticketId"), status)
+	if err != nil {
+		switch {
+		case errors.Is(err, ports.ErrNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, ErrInvalidTransition):
+			http.Error(w, "That status change is not allowed for this ticket", http.StatusUnprocessableEntity)
+		case errors.Is(err, ports.ErrConflict):
+			http.Error(w, "The ticket was changed by someone else, reload and try again", http.StatusConflict)
+		default:
+			h.log.Error("failed to change ticket status", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, fmt.Sprintf("/tickets/%s", ticket.ID), http.StatusSeeOther)
+		return
+	}
+	next, err := h.service.NextStatuses(r.Context(), ticket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = StatusUpdate(ticket, next).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+}
+
+// SetCustomerOptOut pauses or resumes status updates to the customer and
+// swaps in the updated toggle
+func (h handler) SetCustomerOptOut(w http.ResponseWriter, r *http.Request) {
+	optOut := r.FormValue("opt_out") == "true"
+	ticket, channels, err := h.service.SetCustomerOptOut(r.Context(), chi.URLParam(r, "ticketId"), optOut)
+	if err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		h.log.Error("failed to change customer notifications", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !httputil.IsHTMX(r) {
+		http.Redirect(w, r, fmt.Sprintf("/tickets/%s", ticket.ID), http.StatusSeeOther)
+		return
+	}
+	if err := CustomerUpdates(ticket, channels).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h handler) AddPart(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ticket, err := h.service.AddPart(r.Context(), chi.URLParam(r, "ticketId"), readPartInput(r))
+	h.renderParts(w, r, ticket, err)
+}
+
+func (h handler) UpdatePart(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ticket, err := h.service.UpdatePart(r.Context(), chi.URLParam(r, "ticketId"), chi.URLParam(r, "partId"), readPartInput(r))
+	h.renderParts(w, r, ticket, err)
+}
+
+func (h handler) DeletePart(w http.ResponseWriter, r *http.Request) {
+	ticket, err := h.service.RemovePart(r.Context(), chi.URLParam(r, "ticketId"), chi.URLParam(r, "partId"))
+	h.renderParts(w, r, ticket, err)
+}
+
+// renderParts answers a parts change with the refreshed parts card, or the
+// card with validation errors and a 422
+func (h handler) renderParts(w http.ResponseWriter, r *http.Request, ticket models.Ticket, err error) {
+	var errs forms.FieldErrors
+	switch {
+	case errors.As(err, &errs):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case errors.Is(err, ports.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		h.log.Error("failed to change ticket parts", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !httputil.IsHTMX(r) {
+		if errs == nil {
+			http.Redirect(w, r, fmt.Sprintf("/tickets/%s", ticket.ID), http.StatusSeeOther)
+			return
+		}
+		http.Error(w, errs.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := PartsUpdate(ticket, errs).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render parts", "error", err)
+	}
+}
+
+func (h handler) AddNote(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	ticket, err := h.service.AddNote(r.Context(), chi.URLParam(r, "ticketId"), readNoteInput(r))
+	h.renderNotes(w, r, ticket, err)
+}
+
+func (h handler) SetNoteVisibility(w http.ResponseWriter, r *http.Request) {
+	internal, err := strconv.ParseBool(r.FormValue("internal"))
+	if err != nil {
+		http.Error(w, "Invalid visibility", http.StatusBadRequest)
+		return
+	}
+	ticket, err := h.service.SetNoteVisibility(r.Context(), chi.URLParam(r, "ticketId"), chi.URLParam(r, "noteId"), internal)
+	h.renderNotes(w, r, ticket, err)
+}
+
+// renderNotes answers a work log change with the refreshed notes card
+func (h handler) renderNotes(w http.ResponseWriter, r *http.Request, ticket models.Ticket, err error) {
+	var errs forms.FieldErrors
+	switch {
+	case errors.As(err, &errs):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case errors.Is(err, ports.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		h.log.Error("failed to change ticket notes", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !httputil.IsHTMX(r) {
+		if errs == nil {
+			http.Redirect(w, r, fmt.Sprintf("/tickets/%s", ticket.ID), http.StatusSeeOther)
+			return
+		}
+		http.Error(w, errs.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := NotesCard(ticket, errs).Render(r.Context(), w); err != nil {
+		h.log.Error("failed to render notes", "error", err)
+	}
+}
+
+// renderInvalid re-renders the form with per-field errors. htmx requests only
+// get the form back, which replaces itself via hx-target-422="this".
+func (h handler) renderInvalid(w http.ResponseWriter, r *http.Request, params TicketFormParams) {
+	var err error
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if httputil.IsHTMX(r) {
+		err = TicketFormBody(params).Render(r.Context(), w)
+	} else {
+		err = layout.BaseLayout(TicketForm(params)).Render(r.Context(), w)
+	}
+	if err != nil {
+		h.log.Error("failed to render ticket form", "error", err)
+	}
+}
+
+// redirect sends htmx requests to url with a full page navigation and falls
+// back to a regular See Other redirect
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if httputil.IsHTMX(r) {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// CustomerMatches lists customers matching the ticket form's customer search
+func (h handler) CustomerMatches(w http.ResponseWriter, r *http.Request) {
+	customers, err := h.service.Customers(r.Context(), strings.TrimSpace(r.URL.Query().Get("customer_search")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := CustomerMatches(customers).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PickCustomer swaps in the ticket form's customer fields filled with the
+// chosen customer's details
+func (h handler) PickCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, err := h.service.Customer(r.Context(), chi.URLParam(r, "customerId"))
+	if err != nil {
+		if errors.Is(err, ports.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var ticket models.Ticket
+	prefillCustomer(&ticket, customer)
+	if err := PickedCustomer(ticket).Render(r.Context(), w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
 
-	return false
+func prefillCustomer(ticket *models.Ticket, customer models.Customer) {
+	ticket.CustomerID = &customer.ID
+	ticket.CustomerName = customer.Name
+	ticket.CustomerPhone = customer.Phone
+	ticket.CustomerEmail = customer.Email
 }
@@ -2,122 +2,531 @@ package tickets
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
-	"strings"
 	"time"
 
+	"flexsupport/internal/forms"
+	mw "flexsupport/internal/middleware"
 	"flexsupport/internal/models"
+	"flexsupport/internal/notify"
+	"flexsupport/internal/ports"
+	"flexsupport/internal/utils"
 )
 
+// ErrInvalidTransition is returned when the project's workflow does not allow
+// moving a ticket to the requested status
+var ErrInvalidTransition = errors.New("status transition not allowed")
+
 type (
 	Service interface {
 		Search(ctx context.Context, search, status string) ([]models.Ticket, error)
-		Get(ctx context.Context, id int64) (models.Ticket, error)
+		Get(ctx context.Context, ref string) (models.Ticket, error)
+		Projects(ctx context.Context) ([]models.Project, error)
+		Create(ctx context.Context, in TicketInput) (models.Ticket, error)
+		Update(ctx context.Context, ref string, in TicketInput) (models.Ticket, error)
+		AddPart(ctx context.Context, ref string, in PartInput) (models.Ticket, error)
+		UpdatePart(ctx context.Context, ref, partID string, in PartInput) (models.Ticket, error)
+		RemovePart(ctx context.Context, ref, partID string) (models.Ticket, error)
+		AddNote(ctx context.Context, ref string, in NoteInput) (models.Ticket, error)
+		SetNoteVisibility(ctx context.Context, ref, noteID string, internal bool) (models.Ticket, error)
+		Statuses(ctx context.Context) ([]models.TicketStatus, error)
+		NextStatuses(ctx context.Context, ticket models.Ticket) ([]models.TicketStatus, error)
+		ChangeStatus(ctx context.Context, ref string, to models.Status) (models.Ticket, error)
+		CustomerChannels(ctx context.Context, ticket models.Ticket) ([]notify.ChannelStatus, error)
+		SetCustomerOptOut(ctx context.Context, ref string, optOut bool) (models.Ticket, []notify.ChannelStatus, error)
+		Customers(ctx context.Context, search string) ([]models.Customer, error)
+		Customer(ctx context.Context, id string) (models.Customer, error)
 	}
 
 	service struct {
-		log *slog.Logger
+		log       *slog.Logger
+		repo      ports.TicketRepository
+		projects  ports.ProjectRepository
+		customers ports.CustomerRepository
+		notifier  *notify.Notifier
 	}
 )
 
-func NewService(log *slog.Logger) Service {
+func NewService(
+	log *slog.Logger,
+	repo ports.TicketRepository,
+	projects ports.ProjectRepository,
+	customers ports.CustomerRepository,
+	notifier *notify.Notifier,
+) Service {
 	return &service{
-		log: log.With("Service", "Tickets"),
+		log:       log.With("Service", "Tickets"),
+		repo:      repo,
+		projects:  projects,
+		customers: customers,
+		notifier:  notifier,
 	}
 }
 
 func (s service) Search(ctx context.Context, search, status string) ([]models.Ticket, error) {
 	s.log.Debug("Searching for tickets", "search", search, "status", status)
-	tickets := getMockTickets()
-	if status != "" {
-		tickets = filterTicketsByStatus(tickets, status)
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListTickets(ctx, models.TicketFilter{
+		TenantID:   tenantID,
+		ProjectIDs: mw.ProjectIDs(ctx),
+		Search:     search,
+		Status:     status,
+	})
+}
+
+// Get loads a ticket by its UUID or by its human-readable key, e.g. REPAIR-1042
+func (s service) Get(ctx context.Context, ref string) (models.Ticket, error) {
+	ticket, err := s.lookup(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
 	}
-	if search != "" {
-		tickets = filterTicketsBySearch(tickets, search)
+	ticket.Parts, err = s.repo.ListParts(ctx, ticket.ID)
+	if err != nil {
+		return models.Ticket{}, err
 	}
-	return tickets, nil
+	ticket.Notes, err = s.repo.ListComments(ctx, ticket.ID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	ticket.Fields, err = s.repo.ListFieldValues(ctx, ticket.ID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	return ticket, nil
 }
 
-func (s service) Get(ctx context.Context, id int64) (models.Ticket, error) {
-	tickets := getMockTickets()
-	for _, ticket := range tickets {
-		if ticket.ID == id {
-			return ticket, nil
+// lookup finds a ticket by reference. Tickets in projects the user cannot
+// work in are reported as not found.
+func (s service) lookup(ctx context.Context, ref string) (models.Ticket, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	var ticket models.Ticket
+	if utils.IsUUID(ref) {
+		ticket, err = s.repo.GetTicket(ctx, tenantID, ref)
+	} else {
+		projectKey, number, ok := models.ParseTicketKey(ref)
+		if !ok {
+			return models.Ticket{}, ports.ErrNotFound
 		}
+		ticket, err = s.repo.GetTicketByKey(ctx, tenantID, projectKey, number)
+	}
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if !mw.CanAccessProject(ctx, ticket.ProjectID) {
+		return models.Ticket{}, ports.ErrNotFound
+	}
+	return ticket, nil
+}
+
+// Projects returns the projects the user may open tickets in
+func (s service) Projects(ctx context.Context) ([]models.Project, error) {
+	return mw.Projects(ctx), nil
+}
+
+// Create validates the input and opens a new ticket in the chosen project.
+// Validation failures are returned as forms.FieldErrors together with the
+// partially filled ticket so the form can be re-rendered.
+func (s service) Create(ctx context.Context, in TicketInput) (models.Ticket, error) {
+	var ticket models.Ticket
+	errs := in.apply(&ticket)
+	if errs == nil {
+		errs = forms.FieldErrors{}
 	}
-	return models.Ticket{}, errors.New("ticket not found")
-}
-
-/**
-* Temporary mock data and filtering
-* TODO: Fetch real data from database
- */
-
-func getMockTickets() []models.Ticket {
-	return []models.Ticket{
-		{
-			ID:               1001,
-			Status:           "new",
-			Priority:         "high",
-			CustomerName:     "John Doe",
-			CustomerPhone:    "(555) 123-4567",
-			ItemType:         models.Bag,
-			ItemModel:        "Backpack",
-			IssueDescription: "Broken strap, needs replacement",
-			AssignedTo:       "Mike Tech",
-			DueDate:          time.Now().Add(48 * time.Hour),
-		},
-		{
-			ID:               1002,
-			Status:           "in_progress",
-			Priority:         "normal",
-			CustomerName:     "Jane Smith",
-			CustomerPhone:    "(555) 987-6543",
-			ItemType:         models.Boot,
-			ItemModel:        "Keen",
-			IssueDescription: "Sole needs replaced",
-			AssignedTo:       "Sarah Tech",
-			DueDate:          time.Now().Add(72 * time.Hour),
-		},
-	}
-}
-
-func getMockTicket(id int64) models.Ticket {
-	return models.Ticket{
-		ID:               id,
-		Status:           "in_progress",
-		Priority:         "high",
-		CustomerName:     "John Doe",
-		CustomerPhone:    "(555) 123-4567",
-		ItemType:         models.Bag,
-		ItemModel:        "Backpack",
-		IssueDescription: "Broken strap, needs replacement",
-		AssignedTo:       "Mike Tech",
-		DueDate:          time.Now().Add(48 * time.Hour),
-	}
-}
-
-func filterTicketsByStatus(tickets []models.Ticket, status string) []models.Ticket {
-	result := make([]models.Ticket, 0)
-	if status != "" {
-		for _, ticket := range tickets {
-			if ticket.Status.String() == status {
-				result = append(result, ticket)
-			}
+
+	project, err := s.resolveProject(ctx, in.ProjectID)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		errs["project_id"] = "Choose a project"
+	case err != nil:
+		return ticket, err
+	case project.DefaultRequestTypeID == nil:
+		errs["project_id"] = "This project has no request types configured"
+	default:
+		ticket.ProjectID = project.ID
+		ticket.TenantID = project.TenantID
+		ticket.RequestTypeID = *project.DefaultRequestTypeID
+	}
+	if len(errs) > 0 {
+		return ticket, errs
+	}
+
+	// New tickets start in the project's first status
+	statuses, err := s.statuses(ctx, project.ID)
+	if err != nil {
+		return ticket, err
+	}
+	ticket.SetStatus(statuses[0])
+
+	ticket.Title = ticket.DefaultTitle()
+	ticket.CreatedByUserID = mw.Actor(ctx)
+	if err := s.repo.CreateTicket(ctx, &ticket); err != nil {
+		return ticket, err
+	}
+	s.log.Info("Created ticket", "ticket", ticket.Key())
+
+	if err := s.repo.AddEvent(ctx, &models.TicketEvent{
+		TenantID:    ticket.TenantID,
+		TicketID:    ticket.ID,
+		ActorUserID: ticket.CreatedByUserID,
+		Type:        models.EventCreated,
+	}); err != nil {
+		s.log.Error("failed to record ticket event", "ticket", ticket.ID, "error", err)
+	}
+	return ticket, nil
+}
+
+// resolveProject loads the selected project, falling back to the only project
+// when the form did not need to ask. Only the user's projects can be chosen.
+func (s service) resolveProject(ctx context.Context, id string) (models.Project, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Project{}, err
+	}
+	if id != "" {
+		if !utils.IsUUID(id) || !mw.CanAccessProject(ctx, id) {
+			return models.Project{}, ports.ErrNotFound
 		}
+		return s.projects.GetProject(ctx, tenantID, id)
+	}
+	projects := mw.Projects(ctx)
+	if len(projects) != 1 {
+		return models.Project{}, ports.ErrNotFound
+	}
+	return projects[0], nil
+}
+
+// Update applies the edited form to an existing ticket and records which
+// fields changed
+func (s service) Update(ctx context.Context, ref string, in TicketInput) (models.Ticket, error) {
+	ticket, err := s.lookup(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	before := ticket
+	if errs := in.apply(&ticket); errs != nil {
+		return ticket, errs
+	}
+	if before.Title == before.DefaultTitle() {
+		ticket.Title = ticket.DefaultTitle()
+	}
+	// New contact details may belong to a different customer
+	if before.CustomerName != ticket.CustomerName || before.CustomerPhone != ticket.CustomerPhone || before.CustomerEmail != ticket.CustomerEmail {
+		ticket.CustomerID = nil
+	}
+
+	changed := changedFields(before, ticket)
+	if len(changed) == 0 {
+		return ticket, nil
 	}
-	return result
+	if err := s.repo.UpdateTicket(ctx, &ticket); err != nil {
+		return ticket, err
+	}
+
+	payload, err := json.Marshal(map[string][]string{"fields": changed})
+	if err != nil {
+		return ticket, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	if err := s.repo.AddEvent(ctx, &models.TicketEvent{
+		TenantID:    ticket.TenantID,
+		TicketID:    ticket.ID,
+		ActorUserID: mw.Actor(ctx),
+		Type:        models.EventUpdated,
+		Payload:     payload,
+	}); err != nil {
+		s.log.Error("failed to record ticket event", "ticket", ticket.ID, "error", err)
+	}
+	return ticket, nil
 }
 
-func filterTicketsBySearch(tickets []models.Ticket, search string) []models.Ticket {
-	result := make([]models.Ticket, 0)
-	if search != "" {
-		for _, ticket := range tickets {
-			if strings.Contains(ticket.CustomerName, search) || strings.Contains(ticket.IssueDescription, search) {
-				result = append(result, ticket)
-			}
+// changedFields lists the form fields that differ between two versions of a ticket
+func changedFields(before, after models.Ticket) []string {
+	changed := make([]string, 0)
+	check := func(name string, same bool) {
+		if !same {
+			changed = append(changed, name)
 		}
 	}
-	return result
+	check("title", before.Title == after.Title)
+	check("customer_name", before.CustomerName == after.CustomerName)
+	check("customer_phone", before.CustomerPhone == after.CustomerPhone)
+	check("customer_email", before.CustomerEmail == after.CustomerEmail)
+	check("item_type", before.ItemType == after.ItemType)
+	check("item_details", before.ItemDetails == after.ItemDetails)
+	check("item_brand", before.ItemBrand == after.ItemBrand)
+	check("item_model", before.ItemModel == after.ItemModel)
+	check("serial_number", before.SerialNumber == after.SerialNumber)
+	check("issue_description", before.IssueDescription == after.IssueDescription)
+	check("priority", before.Priority == after.Priority)
+	check("estimated_cost", before.EstimatedCost == after.EstimatedCost)
+	check("due_date", before.DueDateDisplay("2006-01-02") == after.DueDateDisplay("2006-01-02"))
+	check("internal_notes", before.InternalNotes == after.InternalNotes)
+	return changed
+}
+
+// workflow returns the project's status transitions, or the defaults when the
+// project has not configured any
+func (s service) workflow(ctx context.Context, projectID string) ([]models.StatusTransition, error) {
+	transitions, err := s.projects.ListStatusTransitions(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(transitions) == 0 {
+		return models.DefaultStatusTransitions, nil
+	}
+	return transitions, nil
+}
+
+// AddPart validates and records a part used on the ticket and returns the
+// ticket reloaded with its parts and totals
+func (s service) AddPart(ctx context.Context, ref string, in PartInput) (models.Ticket, error) {
+	ticket, err := s.Get(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	part := models.Part{TenantID: ticket.TenantID, TicketID: ticket.ID, AddedByUserID: mw.Actor(ctx)}
+	if errs := in.apply(&part); errs != nil {
+		return ticket, errs
+	}
+	if err := s.repo.AddPart(ctx, &part); err != nil {
+		return ticket, err
+	}
+	return s.Get(ctx, ticket.ID)
+}
+
+// UpdatePart changes a part's name, quantity or cost
+func (s service) UpdatePart(ctx context.Context, ref, partID string, in PartInput) (models.Ticket, error) {
+	ticket, err := s.Get(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if !utils.IsUUID(partID) {
+		return ticket, ports.ErrNotFound
+	}
+	part := models.Part{ID: partID, TenantID: ticket.TenantID, TicketID: ticket.ID}
+	if errs := in.apply(&part); errs != nil {
+		return ticket, errs
+	}
+	if err := s.repo.UpdatePart(ctx, &part, mw.Actor(ctx)); err != nil {
+		return ticket, err
+	}
+	return s.Get(ctx, ticket.ID)
+}
+
+func (s service) RemovePart(ctx context.Context, ref, partID string) (models.Ticket, error) {
+	ticket, err := s.lookup(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if !utils.IsUUID(partID) {
+		return ticket, ports.ErrNotFound
+	}
+	if err := s.repo.DeletePart(ctx, ticket.ID, partID, mw.Actor(ctx)); err != nil {
+		return ticket, err
+	}
+	return s.Get(ctx, ticket.ID)
+}
+
+// AddNote adds a work log entry to the ticket. Notes are internal unless the
+// input explicitly makes them public.
+func (s service) AddNote(ctx context.Context, ref string, in NoteInput) (models.Ticket, error) {
+	ticket, err := s.Get(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	note := models.WorkNote{TenantID: ticket.TenantID, TicketID: ticket.ID, AuthorUserID: mw.Actor(ctx)}
+	if errs := in.apply(&note); errs != nil {
+		return ticket, errs
+	}
+	if err := s.repo.AddComment(ctx, &note); err != nil {
+		return ticket, err
+	}
+	s.recordNoteEvent(ctx, models.EventCommentAdded, note)
+	return s.Get(ctx, ticket.ID)
+}
+
+// SetNoteVisibility switches a note between internal and customer-visible
+func (s service) SetNoteVisibility(ctx context.Context, ref, noteID string, internal bool) (models.Ticket, error) {
+	ticket, err := s.lookup(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if !utils.IsUUID(noteID) {
+		return ticket, ports.ErrNotFound
+	}
+	note, err := s.repo.SetCommentVisibility(ctx, ticket.ID, noteID, internal)
+	if err != nil {
+		return ticket, err
+	}
+	s.recordNoteEvent(ctx, models.EventCommentUpdated, note)
+	return s.Get(ctx, ticket.ID)
+}
+
+func (s service) recordNoteEvent(ctx context.Context, eventType models.EventType, note models.WorkNote) {
+	payload, err := json.Marshal(map[string]any{
+		"comment_id":  note.ID,
+		"is_internal": note.IsInternal,
+	})
+	if err != nil {
+		s.log.Error("failed to encode event payload", "error", err)
+		return
+	}
+	if err := s.repo.AddEvent(ctx, &models.TicketEvent{
+		TenantID:    note.TenantID,
+		TicketID:    note.TicketID,
+		ActorUserID: mw.Actor(ctx),
+		Type:        eventType,
+		Payload:     payload,
+	}); err != nil {
+		s.log.Error("failed to record ticket event", "ticket", note.TicketID, "error", err)
+	}
+}
+
+// statuses returns the project's statuses, or the defaults when the tenant
+// has not configured any
+func (s service) statuses(ctx context.Context, projectID string) ([]models.TicketStatus, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.projects.ListStatuses(ctx, tenantID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return models.DefaultStatuses, nil
+	}
+	return statuses, nil
+}
+
+// Statuses returns the statuses to filter by: the current project's when one
+// is picked in the switcher, otherwise the tenant-wide ones
+func (s service) Statuses(ctx context.Context) ([]models.TicketStatus, error) {
+	project, _ := mw.CurrentProject(ctx)
+	return s.statuses(ctx, project.ID)
+}
+
+// NextStatuses returns the statuses the workflow allows from the ticket's
+// current one, skipping any that are archived or not defined
+func (s service) NextStatuses(ctx context.Context, ticket models.Ticket) ([]models.TicketStatus, error) {
+	transitions, err := s.workflow(ctx, ticket.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.statuses(ctx, ticket.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]models.TicketStatus, 0)
+	for _, key := range models.NextStatuses(transitions, ticket.Status) {
+		if status, ok := models.FindStatus(statuses, key); ok {
+			next = append(next, status)
+		}
+	}
+	return next, nil
+}
+
+// ChangeStatus moves a ticket to a new status if the project's workflow allows
+// it, keeping closed_at in step with the status category and recording a
+// status_changed event
+func (s service) ChangeStatus(ctx context.Context, ref string, to models.Status) (models.Ticket, error) {
+	ticket, err := s.lookup(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	transitions, err := s.workflow(ctx, ticket.ProjectID)
+	if err != nil {
+		return ticket, err
+	}
+	statuses, err := s.statuses(ctx, ticket.ProjectID)
+	if err != nil {
+		return ticket, err
+	}
+	from := ticket.Status
+	target, ok := models.FindStatus(statuses, to)
+	if !ok || !models.CanTransition(transitions, from, to) {
+		return ticket, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	ticket.SetStatus(target)
+	switch {
+	case target.IsDone() && ticket.ClosedAt == nil:
+		now := time.Now()
+		ticket.ClosedAt = &now
+	case !target.IsDone():
+		ticket.ClosedAt = nil
+	}
+
+	payload, err := json.Marshal(map[string]models.Status{"from": from, "to": to})
+	if err != nil {
+		return ticket, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	event := &models.TicketEvent{
+		TenantID:    ticket.TenantID,
+		TicketID:    ticket.ID,
+		ActorUserID: mw.Actor(ctx),
+		Type:        models.EventStatusChanged,
+		Payload:     payload,
+	}
+	if err := s.repo.ChangeTicketStatus(ctx, &ticket, from, event); err != nil {
+		return ticket, err
+	}
+	s.log.Info("Changed ticket status", "ticket", ticket.Key(), "from", from, "to", to)
+	s.notifier.StatusChanged(ctx, ticket, target)
+	return ticket, nil
+}
+
+// CustomerChannels returns where the ticket's customer gets status update
+// messages and whether each has been stopped
+func (s service) CustomerChannels(ctx context.Context, ticket models.Ticket) ([]notify.ChannelStatus, error) {
+	return s.notifier.Channels(ctx, ticket)
+}
+
+// SetCustomerOptOut pauses or resumes status update messages to the ticket's
+// customer, on this and every other ticket with the same contact details
+func (s service) SetCustomerOptOut(ctx context.Context, ref string, optOut bool) (models.Ticket, []notify.ChannelStatus, error) {
+	ticket, err := s.lookup(ctx, ref)
+	if err != nil {
+		return models.Ticket{}, nil, err
+	}
+	channels, err := s.notifier.SetPaused(ctx, ticket, optOut)
+	return ticket, channels, err
+}
+
+// Customers returns the customers whose name, phone or email matches, for
+// the customer search on the ticket form
+func (s service) Customers(ctx context.Context, search string) ([]models.Customer, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(search) < 2 {
+		return []models.Customer{}, nil
+	}
+	return s.customers.ListCustomers(ctx, models.CustomerFilter{
+		TenantID:   tenantID,
+		ProjectIDs: mw.ProjectIDs(ctx),
+		Search:     search,
+		Limit:      8,
+	})
+}
+
+// Customer loads a customer to prefill a new ticket with
+func (s service) Customer(ctx context.Context, id string) (models.Customer, error) {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return models.Customer{}, err
+	}
+	if !utils.IsUUID(id) {
+		return models.Customer{}, ports.ErrNotFound
+	}
+	return s.customers.GetCustomer(ctx, tenantID, id, mw.ProjectIDs(ctx))
 }
@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"context"
+	"sync"
+)
+
+// Message is a text recorded by Fake
+type Message struct {
+	To   string
+	Body string
+}
+
+// Fake records messages instead of sending them, for tests
+type Fake struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+var _ Provider = (*Fake)(nil)
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) Send(ctx context.Context, to, body string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, Message{To: to, Body: body})
+	return nil
+}
+
+// Sent returns the messages sent so far, oldest first
+func (f *Fake) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
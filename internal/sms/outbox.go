@@ -0,0 +1,31 @@
+package sms
+
+import (
+	"context"
+
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+// Outbox is the Provider services use. It queues texts in sms_outbox for the
+// notify worker to send through the tenant's integration, so a slow provider
+// never holds up a request and failed sends are retried.
+type Outbox struct {
+	store ports.TextOutboxRepository
+}
+
+var _ Provider = (*Outbox)(nil)
+
+func NewOutbox(store ports.TextOutboxRepository) *Outbox {
+	return &Outbox{store: store}
+}
+
+// Send queues the text for the tenant on the context
+func (o *Outbox) Send(ctx context.Context, to, body string) error {
+	tenantID, err := mw.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+	return o.store.EnqueueText(ctx, &models.OutboxText{TenantID: tenantID, To: to, Body: body})
+}
@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPhone is returned for numbers that cannot be put in E.164 form
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// NormalizePhone returns the number in E.164 form, e.g. +15415550123.
+// Numbers without an international prefix ("+" or "00") are taken to be in
+// the country with defaultCountryCode; a leading trunk 0 is dropped, and for
+// country code 1 a leading 1 is accepted. Punctuation and spaces are ignored.
+func NormalizePhone(raw, defaultCountryCode string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case defaultCountryCode == "":
+		return "", ErrInvalidPhone
+	case defaultCountryCode == "1" && len(number) == 11 && number[0] == '1':
+	default:
+		number = defaultCountryCode + strings.TrimPrefix(number, "0")
+	}
+	// E.164 allows at most 15 digits and country codes never start with 0
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
@@ -0,0 +1,141 @@
+// Package sms sends text messages through a pluggable Provider
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"flexsupport/internal/models"
+)
+
+// Provider delivers text messages. to is an E.164 number. Implementations
+// must be safe for concurrent use.
+type Provider interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+var (
+	// ErrNotConfigured is returned by New when the integration is missing
+	// settings the provider needs
+	ErrNotConfigured = errors.New("sms provider is not configured")
+	// ErrFakeProvider is returned for integrations set to the fake provider
+	// where it is not allowed, as in production
+	ErrFakeProvider = errors.New("the fake sms provider is not available")
+	// ErrHostNotAllowed is returned for integrations whose base URL is not
+	// https on one of the allowed hosts
+	ErrHostNotAllowed = errors.New("sms api host is not allowed")
+)
+
+// Providers builds the Provider each tenant's sms integration is set up for
+type Providers struct {
+	// Client calls the providers' APIs; one with a timeout is used when nil
+	Client *http.Client
+	// Fake receives the texts of integrations set to the fake provider. It is
+	// nil in production, where the fake provider is refused, and a Fake in
+	// tests.
+	Fake Provider
+	// AllowedHosts are the hosts, with their port if it is not 443, that an
+	// integration's base URL may point at. Tenants set the base URL and the
+	// app posts their credentials to it, so it cannot be left open.
+	AllowedHosts []string
+}
+
+// FakeAllowed reports whether integrations may use the fake provider
+func (p Providers) FakeAllowed() bool {
+	return p.Fake != nil
+}
+
+// Check reports whether the integration's settings can be used, without
+// building its provider
+func (p Providers) Check(cfg models.SMSConfig) error {
+	switch cfg.Provider {
+	case models.SMSProviderTwilio:
+		return p.checkBaseURL(cfg.BaseURL)
+	case models.SMSProviderFake:
+		if !p.FakeAllowed() {
+			return ErrFakeProvider
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown provider %q", ErrNotConfigured, cfg.Provider)
+	}
+}
+
+func (p Providers) checkBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return fmt.Errorf("%w: %q", ErrHostNotAllowed, baseURL)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Host), ":443")
+	if !slices.Contains(p.AllowedHosts, host) {
+		return fmt.Errorf("%w: %q", ErrHostNotAllowed, u.Host)
+	}
+	return nil
+}
+
+// New returns the provider an sms integration is configured for
+func (p Providers) New(cfg models.SMSConfig) (Provider, error) {
+	if err := p.Check(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Provider == models.SMSProviderFake {
+		return p.Fake, nil
+	}
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.FromNumber == "" {
+		return nil, ErrNotConfigured
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+			// a redirect could send the credentials somewhere not allowed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return NewTwilio(cfg, client), nil
+}
+
+// Keyword is what an inbound message asks for
+type Keyword int
+
+const (
+	KeywordNone Keyword = iota
+	KeywordStop
+	KeywordStart
+)
+
+// ParseKeyword recognises the standard carrier opt-out and opt-in keywords,
+// which must be the whole message
+func ParseKeyword(body string) Keyword {
+	switch strings.ToUpper(strings.TrimSpace(body)) {
+	case "STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT", "OPTOUT", "REVOKE":
+		return KeywordStop
+	case "START", "YES", "UNSTOP", "OPTIN":
+		return KeywordStart
+	default:
+		return KeywordNone
+	}
+}
+
+// ParseHosts reads a comma-separated list of hosts for AllowedHosts
+func ParseHosts(s string) []string {
+	var hosts []string
+	for _, host := range strings.Split(s, ",") {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ":443")
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,92 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"flexsupport/internal/models"
+)
+
+func TestProvidersCheck(t *testing.T) {
+	providers := Providers{AllowedHosts: ParseHosts("api.twilio.com, sms.example.com:8443")}
+
+	tests := []struct {
+		name string
+		cfg  models.SMSConfig
+		want error
+	}{
+		{"twilio default", models.SMSConfig{Provider: models.SMSProviderTwilio}, nil},
+		{"allowed host", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "https://API.twilio.com"}, nil},
+		{"allowed host on 443", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "https://api.twilio.com:443"}, nil},
+		{"allowed host and port", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "https://sms.example.com:8443"}, nil},
+		{"other port", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "https://sms.example.com"}, ErrHostNotAllowed},
+		{"http", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "http://api.twilio.com"}, ErrHostNotAllowed},
+		{"internal host", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "https://169.254.169.254"}, ErrHostNotAllowed},
+		{"credentials in url", models.SMSConfig{Provider: models.SMSProviderTwilio, BaseURL: "https://user@api.twilio.com"}, ErrHostNotAllowed},
+		{"fake in production", models.SMSConfig{Provider: models.SMSProviderFake}, ErrFakeProvider},
+		{"unknown provider", models.SMSConfig{Provider: "carrier-pigeon"}, ErrNotConfigured},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := providers.Check(tt.cfg)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvidersFake(t *testing.T) {
+	fake := NewFake()
+	provider, err := Providers{Fake: fake}.New(models.SMSConfig{Provider: models.SMSProviderFake})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := provider.Send(context.Background(), "+15415550123", "Ready"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if sent := fake.Sent(); len(sent) != 1 || sent[0].To != "+15415550123" {
+		t.Errorf("Sent() = %v, want the one text", sent)
+	}
+}
+
+func TestTwilioSend(t *testing.T) {
+	var got url.Values
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sid, token, ok := r.BasicAuth(); !ok || sid != "AC123" || token != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = r.ParseForm()
+		got = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	providers := Providers{Client: server.Client(), AllowedHosts: []string{u.Host}}
+	provider, err := providers.New(models.SMSConfig{
+		Provider:   models.SMSProviderTwilio,
+		AccountSID: "AC123",
+		AuthToken:  "secret",
+		FromNumber: "+15415550100",
+		BaseURL:    server.URL,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := provider.Send(context.Background(), "+15415550123", "Ready"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.Get("To") != "+15415550123" || got.Get("From") != "+15415550100" || got.Get("Body") != "Ready" {
+		t.Errorf("posted %v", got)
+	}
+}
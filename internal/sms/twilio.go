@@ -0,0 +1,122 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"flexsupport/internal/models"
+)
+
+// TwilioBaseURL is the Twilio REST API; compatible providers set their own in
+// the integration
+const TwilioBaseURL = "https://api.twilio.com"
+
+// Twilio sends messages through Twilio's Messages API or a compatible one
+type Twilio struct {
+	client     *http.Client
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+}
+
+var _ Provider = (*Twilio)(nil)
+
+func NewTwilio(cfg models.SMSConfig, client *http.Client) *Twilio {
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = TwilioBaseURL
+	}
+	return &Twilio{
+		client:     client,
+		baseURL:    baseURL,
+		accountSID: cfg.AccountSID,
+		authToken:  cfg.AuthToken,
+		from:       cfg.FromNumber,
+	}
+}
+
+func (t *Twilio) Send(ctx context.Context, to, body string) error {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.baseURL, url.PathEscape(t.accountSID))
+	form := url.Values{"To": {to}, "From": {t.from}, "Body": {body}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach sms provider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	apiErr := &APIError{Status: resp.Status, StatusCode: resp.StatusCode}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(apiErr)
+	return apiErr
+}
+
+// APIError is a provider's refusal to send a message
+type APIError struct {
+	Status     string `json:"-"`
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("sms provider returned %s: %d %s", e.Status, e.Code, e.Message)
+}
+
+// IsPermanent reports whether sending the message again will not help: the
+// provider rejected it outright, such as for an invalid number, or the
+// integration cannot be used as configured
+func IsPermanent(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.StatusCode
+		return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+	}
+	return errors.Is(err, ErrNotConfigured) || errors.Is(err, ErrFakeProvider) || errors.Is(err, ErrHostNotAllowed)
+}
+
+// ValidSignature checks the X-Twilio-Signature of an inbound webhook: the
+// base64 HMAC-SHA1, keyed with the auth token, of the full URL Twilio called
+// followed by each POST parameter's name and value in name order
+func ValidSignature(authToken, fullURL string, params url.Values, signature string) bool {
+	if authToken == "" || signature == "" {
+		return false
+	}
+	var b strings.Builder
+	b.WriteString(fullURL)
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range params[name] {
+			b.WriteString(name)
+			b.WriteString(value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
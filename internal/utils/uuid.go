@@ -0,0 +1,11 @@
+package utils
+
+import (
+	"regexp"
+)
+
+var uuidPattern = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func IsUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
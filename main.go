@@ -31,7 +31,16 @@ func init() {
 
 func main() {
 	ctx := context.Background()
-	if err := App(ctx, os.Stdout, getEnv); err != nil {
+	var err error
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "migrate":
+		err = Migrate(ctx, os.Stdout, getEnv, os.Args[2:])
+	case len(os.Args) > 1 && os.Args[1] == "user":
+		err = User(ctx, os.Stdin, os.Stdout, getEnv, os.Args[2:])
+	default:
+		err = App(ctx, os.Stdout, getEnv)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
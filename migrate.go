@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	cfg "flexsupport/internal/config"
+	db "flexsupport/internal/domain"
+)
+
+const migrateUsage = `usage: flexsupport migrate <command>
+
+commands:
+  status      list migrations and when they were applied
+  up          apply all pending migrations
+  up-to N     apply pending migrations up to and including version N
+  down [N]    revert the N most recently applied migrations (default 1)
+  redo        revert and re-apply the most recently applied migration`
+
+// Migrate runs the `flexsupport migrate` subcommand
+func Migrate(ctx context.Context, stdout io.Writer, getenv func(string, string) string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	config := cfg.New(getenv)
+	database := db.NewDB(ctx, config.DatabaseUrl)
+	defer database.Close()
+
+	switch args[0] {
+	case "status":
+		return printMigrationStatus(ctx, stdout, database)
+	case "up":
+		return database.Migrate(ctx)
+	case "up-to":
+		if len(args) < 2 {
+			return errors.New("up-to requires a version\n\n" + migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+		return database.MigrateTo(ctx, version)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		return database.Rollback(ctx, steps)
+	case "redo":
+		return database.Redo(ctx)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], migrateUsage)
+	}
+}
+
+func printMigrationStatus(ctx context.Context, stdout io.Writer, database *db.DB) error {
+	statuses, err := database.MigrationStatuses(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tDOWN")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05 MST")
+		}
+		if status.Modified {
+			state = "modified"
+		}
+		down := "no"
+		if status.DownSQL != "" {
+			down = "yes"
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt, down)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"flexsupport/internal/auth"
+	cfg "flexsupport/internal/config"
+	db "flexsupport/internal/domain"
+	mw "flexsupport/internal/middleware"
+	"flexsupport/internal/models"
+	"flexsupport/internal/ports"
+)
+
+const userUsage = `usage: flexsupport user <command>
+
+commands:
+  add <tenant-slug> <email> <name> [role]   create a user, or add an existing one, as a member of the
+                                             tenant with role (default Owner)
+
+The password is read from FLEXSUPPORT_PASSWORD, or from the first line of stdin.`
+
+// User runs the `flexsupport user` subcommand
+func User(ctx context.Context, stdin io.Reader, stdout io.Writer, getenv func(string, string) string, args []string) error {
+	if len(args) == 0 || args[0] != "add" {
+		return errors.New(userUsage)
+	}
+	if len(args) != 4 && len(args) != 5 {
+		return errors.New("add requires a tenant slug, email and name\n\n" + userUsage)
+	}
+	slug, email, name := args[1], strings.TrimSpace(args[2]), strings.TrimSpace(args[3])
+	roleName := models.RoleOwner
+	if len(args) == 5 {
+		roleName = strings.TrimSpace(args[4])
+	}
+
+	config := cfg.New(getenv)
+	database := db.NewDB(ctx, config.DatabaseUrl)
+	defer database.Close()
+
+	tenant, ok, err := db.NewTenantResolver(database, 0).ResolveBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no tenant with slug %q", slug)
+	}
+	ctx = mw.WithTenant(ctx, *tenant)
+
+	role, err := database.GetRoleByName(ctx, tenant.ID, roleName)
+	if errors.Is(err, ports.ErrNotFound) {
+		return fmt.Errorf("%s has no role named %q", tenant.Name, roleName)
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := database.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, ports.ErrNotFound):
+		password, err := readPassword(stdin, getenv)
+		if err != nil {
+			return err
+		}
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user = models.User{Name: name, Email: email, PasswordHash: hash}
+		if err := database.CreateUser(ctx, &user); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "created user %s\n", user.Email)
+	case err != nil:
+		return err
+	}
+
+	if err := database.AddMembership(ctx, tenant.ID, user.ID); err != nil {
+		return err
+	}
+	active, err := database.IsActiveMember(ctx, tenant.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return fmt.Errorf("%s's membership of %s is disabled", user.Email, tenant.Name)
+	}
+	if err := database.AddMemberRole(ctx, tenant.ID, user.ID, role.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s is a member of %s with role %s\n", user.Email, tenant.Name, role.Name)
+	return nil
+}
+
+func readPassword(stdin io.Reader, getenv func(string, string) string) (string, error) {
+	password := getenv("FLEXSUPPORT_PASSWORD", "")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) < auth.MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength)
+	}
+	return password, nil
+}